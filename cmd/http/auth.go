@@ -0,0 +1,39 @@
+package http
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+// parseSigningKey parses the PEM private key signing tokens, a PKCS #8, EC
+// or PKCS #1 key. No key signs tokens with the secret.
+func parseSigningKey(data string) (crypto.Signer, error) {
+	if data == "" {
+		return nil, nil
+	}
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("signing key is not pem")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse signing key fail : %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("signing key %T cannot sign", key)
+	}
+
+	return signer, nil
+}
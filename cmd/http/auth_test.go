@@ -0,0 +1,32 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSigningKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+	sec1, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	for typ, der := range map[string][]byte{"PRIVATE KEY": pkcs8, "EC PRIVATE KEY": sec1} {
+		signer, err := parseSigningKey(string(pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})))
+		assert.Nil(t, err, typ)
+		assert.True(t, key.Equal(signer), typ)
+	}
+
+	signer, err := parseSigningKey("")
+	assert.Nil(t, err)
+	assert.Nil(t, signer)
+	_, err = parseSigningKey("not a key")
+	assert.Error(t, err)
+}
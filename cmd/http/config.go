@@ -0,0 +1,36 @@
+package http
+
+import (
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	_configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "configuration",
+	}
+	_configPrintCmd = &cobra.Command{
+		Use:   "print",
+		Short: "print the effective configuration after env and flag overrides",
+		RunE:  printConfig,
+	}
+)
+
+func init() {
+	_configPrintCmd.Flags().Bool("redacted", true, "mask secrets")
+	_configCmd.AddCommand(_configPrintCmd)
+	_rootCmd.AddCommand(_configCmd)
+}
+
+func printConfig(cmd *cobra.Command, args []string) error {
+	cfg := *_cfg
+	if redacted, _ := cmd.Flags().GetBool("redacted"); redacted {
+		cfg = cfg.Redacted()
+	}
+	enc := yaml.NewEncoder(cmd.OutOrStdout())
+	enc.SetIndent(2)
+	defer enc.Close()
+
+	return enc.Encode(cfg)
+}
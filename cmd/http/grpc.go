@@ -0,0 +1,52 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/rpc"
+	"github.com/reddtsai/goAPI/pkg/blockaction/service"
+)
+
+// newGRPCServer listens on the grpc port, serving tls when tlsConfig is set.
+func newGRPCServer(svc *service.Service, tlsConfig *tls.Config) (*grpc.Server, net.Listener, error) {
+	var grpcOptions []grpc.ServerOption
+	if tlsConfig != nil {
+		grpcOptions = append(grpcOptions, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server, err := rpc.NewServer(
+		rpc.SetService(svc),
+		rpc.SetTrustedClients(_cfg.Auth.TrustedClients),
+		rpc.SetGRPCOptions(grpcOptions...),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", _cfg.GRPC.Port))
+	if err != nil {
+		return nil, nil, fmt.Errorf("grpc server, listen error : %w", err)
+	}
+
+	return server, lis, nil
+}
+
+// stopGRPC drains in-flight calls until ctx is done, then closes the
+// remaining connections.
+func stopGRPC(ctx context.Context, server *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		server.Stop()
+		<-done
+	}
+}
@@ -2,51 +2,340 @@ package http
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/api"
+	"github.com/reddtsai/goAPI/pkg/blockaction/config"
+	"github.com/reddtsai/goAPI/pkg/blockaction/health"
+	"github.com/reddtsai/goAPI/pkg/blockaction/service"
 )
 
 var (
 	_rootCmd = &cobra.Command{
-		Use:   "api",
-		Short: "http server",
+		Use:               "api",
+		Short:             "http server",
+		SilenceUsage:      true,
+		SilenceErrors:     true,
+		PersistentPreRunE: loadConfig,
+		RunE:              runServer,
+	}
+	_cfg      *config.Config
+	_viper    *viper.Viper
+	_logLevel = new(slog.LevelVar)
+
+	// server flags override the config key they are bound to
+	_flagKeys = map[string]string{
+		"port":                "server-options.port",
+		"read-timeout":        "server-options.read-timeout",
+		"read-header-timeout": "server-options.read-header-timeout",
+		"write-timeout":       "server-options.write-timeout",
+		"idle-timeout":        "server-options.idle-timeout",
+		"shutdown-delay":      "server-options.shutdown-delay",
+		"shutdown-timeout":    "server-options.shutdown-timeout",
+		"hook-timeout":        "server-options.hook-timeout",
+		"tls-cert-file":       "server-options.tls.cert-file",
+		"tls-key-file":        "server-options.tls.key-file",
+		"tls-min-version":     "server-options.tls.min-version",
+		"tls-client-ca-file":  "server-options.tls.client-ca-file",
+		"tls-client-auth":     "server-options.tls.client-auth",
+		"tls-reload-interval": "server-options.tls.reload-interval",
+		"grpc-port":           "grpc-options.port",
 	}
-	_httpHandler http.Handler
 )
 
+// ShutdownHook releases a resource once the server has stopped serving.
+type ShutdownHook func(ctx context.Context) error
+
 func init() {
-	port := 80
-	_rootCmd.Flags().IntVar(&port, "port", port, "http listen port")
+	_rootCmd.PersistentFlags().String("config", "conf.d/config.yaml", "config file path")
+
+	flags := _rootCmd.Flags()
+	flags.Int("port", 80, "http listen port")
+	flags.Duration("read-timeout", 15*time.Second, "max duration for reading the entire request")
+	flags.Duration("read-header-timeout", 5*time.Second, "max duration for reading request headers")
+	flags.Duration("write-timeout", 30*time.Second, "max duration before timing out writes of the response")
+	flags.Duration("idle-timeout", 120*time.Second, "max time to wait for the next request on keep-alive connections")
+	flags.Duration("shutdown-delay", 5*time.Second, "time readiness reports failing before the listener closes")
+	flags.Duration("shutdown-timeout", 25*time.Second, "max time to drain in-flight requests")
+	flags.Duration("hook-timeout", 5*time.Second, "max time to run the shutdown hooks once drained")
+	flags.String("tls-cert-file", "", "serve https with this certificate file")
+	flags.String("tls-key-file", "", "private key file of the tls certificate")
+	flags.String("tls-min-version", "1.2", "minimum tls version, one of 1.0, 1.1, 1.2, 1.3")
+	flags.String("tls-client-ca-file", "", "ca bundle used to verify client certificates")
+	flags.String("tls-client-auth", "none", "client certificate policy, one of none, request, verify-if-given, require")
+	flags.Duration("tls-reload-interval", time.Minute, "interval to check certificate files for changes, 0 disables reload")
+	flags.Int("grpc-port", 0, "grpc listen port, 0 disables grpc")
+}
+
+func loadConfig(cmd *cobra.Command, args []string) error {
+	path, _ := cmd.Flags().GetString("config")
+	v := config.NewViper(path)
+	for name, key := range _flagKeys {
+		if f := cmd.Flags().Lookup(name); f != nil {
+			err := v.BindPFlag(key, f)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	cfg, err := config.Load(v, !cmd.Flags().Changed("config"))
+	if err != nil {
+		return err
+	}
+	err = cfg.ResolveSecrets(cmd.Context(), cfg.NewSecretResolver())
+	if err != nil {
+		return err
+	}
+	_cfg = cfg
+	_viper = v
+	slog.SetDefault(cfg.Log.NewLogger(_logLevel))
+
+	return nil
 }
 
-func runServer(cmd *cobra.Command, args []string) {
+func runServer(cmd *cobra.Command, args []string) error {
+	cfg := _cfg
+	var hooks []ShutdownHook
+	shutdown := func(ctx context.Context) error {
+		var errs []error
+		for i := len(hooks) - 1; i >= 0; i-- {
+			err := hooks[i](ctx)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("http server, shutdown hook error : %w", err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	db, migrators, err := openStorage(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("init storage : %w", err)
+	}
+	hooks = append(hooks, func(ctx context.Context) error {
+		return db.Close()
+	})
+	for _, m := range migrators {
+		if !cfg.Storage.MigrateOnStart {
+			break
+		}
+		applied, err := m.Up(cmd.Context(), 0)
+		if err != nil {
+			return errors.Join(fmt.Errorf("migrate %s on start : %w", m.Name, err), shutdown(context.Background()))
+		}
+		slog.Info("migrate on start", "db", m.Name, "applied", len(applied), "version", m.Latest())
+	}
+	ids, releaseID, idLost, err := newIDGenerator(cmd.Context(), db)
+	if err != nil {
+		return errors.Join(fmt.Errorf("init id generator : %w", err), shutdown(context.Background()))
+	}
+	if releaseID != nil {
+		hooks = append(hooks, releaseID)
+	}
+	cached, closeCache := withCache(db)
+	if closeCache != nil {
+		hooks = append(hooks, closeCache)
+	}
+	hc := health.New()
+	hc.AddReadinessCheck(cfg.Storage.Backend, health.PingChecker(db))
+	// reads fail over to the primary, so a replica down does not fail readiness
+	for _, mysqlDB := range mysqlDBs(db) {
+		mysqlDB := mysqlDB
+		for i, addr := range mysqlDB.Replicas() {
+			i := i
+			hc.AddOptionalReadinessCheck("mysql-replica-"+addr, health.CheckerFunc(func(ctx context.Context) error {
+				return mysqlDB.PingReplica(ctx, i)
+			}))
+		}
+	}
+	for _, m := range migrators {
+		name := "migration"
+		if len(migrators) > 1 {
+			name += "-" + m.Name
+		}
+		hc.AddReadinessCheck(name, health.MigrationChecker(m.Version, m.Latest()))
+	}
+	signingKey, err := parseSigningKey(cfg.Auth.SigningKey)
+	if err != nil {
+		return errors.Join(fmt.Errorf("init service : %w", err), shutdown(context.Background()))
+	}
+	// validated with the config
+	legacyUntil, _ := cfg.Auth.LegacySecretDeadline()
+	svc, err := service.New(
+		service.SetStorage(cached),
+		service.SetIDGenerator(ids),
+		service.SetSecret(cfg.Auth.Secret),
+		service.SetSigningKey(signingKey),
+		service.SetLegacySecretUntil(legacyUntil),
+		service.SetAudience(cfg.Auth.Audience),
+		service.SetTokenTTL(cfg.Auth.TokenTTL),
+		service.SetRefreshTTL(cfg.Auth.RefreshTTL),
+		service.SetRateLimit(cfg.RateLimit.RPS, cfg.RateLimit.Burst),
+	)
+	if err != nil {
+		return errors.Join(fmt.Errorf("init service : %w", err), shutdown(context.Background()))
+	}
+	watcher := config.NewWatcher(_viper, cfg)
+	// validated with the config
+	deprecatedAt, sunsetAt, _ := cfg.Version.V1.Dates()
+	httpHandler, err := api.NewBlockActionApi(
+		api.SetService(svc),
+		api.SetHealth(hc),
+		api.SetTrustedClients(cfg.Auth.TrustedClients),
+		api.SetAdminClients(cfg.Auth.AdminClients),
+		api.SetAllowOrigins(cfg.CORS.AllowOrigins),
+		api.SetAllowMethods(cfg.CORS.AllowMethods),
+		api.SetAllowHeaders(cfg.CORS.AllowHeaders),
+		api.SetExposeHeaders(cfg.CORS.ExposeHeaders),
+		api.SetAllowCredentials(cfg.CORS.AllowCredentials),
+		api.SetMaxAge(cfg.CORS.MaxAge),
+		api.SetTrustedProxies(cfg.Server.TrustedProxies),
+		api.SetV1Deprecation(api.Deprecation{
+			DeprecatedAt: deprecatedAt,
+			SunsetAt:     sunsetAt,
+			Link:         cfg.Version.V1.Link,
+		}),
+		api.SetMetricsClients(cfg.Version.Clients),
+		api.SetConfigVersion(func() interface{} {
+			return watcher.Version()
+		}),
+		api.SetOpenAPIValidation(cfg.Env == config.ENV_DEVELOPMENT),
+	)
+	if err != nil {
+		return errors.Join(fmt.Errorf("init api : %w", err), shutdown(context.Background()))
+	}
+	watcher.OnReload(func(r config.RuntimeCfg) error {
+		return httpHandler.Reload(api.RuntimeOptions{
+			AllowOrigins: r.AllowOrigins,
+			RateLimit:    r.RateLimit.RPS,
+			RateBurst:    r.RateLimit.Burst,
+			TokenTTL:     r.TokenTTL,
+		})
+	})
+	watcher.OnReload(func(r config.RuntimeCfg) error {
+		_logLevel.Set(config.ParseLogLevel(r.LogLevel))
+		return nil
+	})
+	if _, err := os.Stat(_viper.ConfigFileUsed()); err == nil {
+		watcher.Start()
+	}
+
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%s", cmd.Flag("port").Value.String()),
-		Handler: _httpHandler,
+		Addr:              fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler:           httpHandler,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if cfg.Server.TLS.CertFile != "" {
+		// the reloader outlives the signal context until the server is drained
+		reloadCtx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		tlsConfig, err := newTLSConfig(reloadCtx, cfg.Server.TLS)
+		if err != nil {
+			return errors.Join(fmt.Errorf("http server, tls config error : %w", err), shutdown(context.Background()))
+		}
+		server.TLSConfig = tlsConfig
 	}
+	// nil when grpc is disabled, never ready in the select below
+	var grpcErr chan error
+	var grpcServer *grpc.Server
+	if cfg.GRPC.Port > 0 {
+		gs, lis, err := newGRPCServer(svc, server.TLSConfig)
+		if err != nil {
+			return errors.Join(err, shutdown(context.Background()))
+		}
+		grpcServer = gs
+		grpcErr = make(chan error, 1)
+		go func() {
+			log.Printf("grpc server, listen on %s\n", lis.Addr())
+			grpcErr <- grpcServer.Serve(lis)
+		}()
+	}
+	serveErr := make(chan error, 1)
 	go func() {
-		err := server.ListenAndServe()
-		if err != nil && err != http.ErrServerClosed {
-			log.Fatalf("http server, listen and serve error : %s\n", err.Error())
+		if server.TLSConfig != nil {
+			log.Printf("https server, listen on %s\n", server.Addr)
+			serveErr <- server.ListenAndServeTLS("", "")
+			return
 		}
+		log.Printf("http server, listen on %s\n", server.Addr)
+		serveErr <- server.ListenAndServe()
 	}()
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
-	err := server.Shutdown(cmd.Context())
+
+	// stopNow closes both listeners without draining
+	stopNow := func() error {
+		if grpcServer != nil {
+			grpcServer.Stop()
+		}
+		return server.Close()
+	}
+	select {
+	case err := <-serveErr:
+		hookCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.HookTimeout)
+		defer cancel()
+		return errors.Join(fmt.Errorf("http server, listen and serve error : %w", err), stopNow(), shutdown(hookCtx))
+	case err := <-grpcErr:
+		hookCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.HookTimeout)
+		defer cancel()
+		return errors.Join(fmt.Errorf("grpc server, serve error : %w", err), stopNow(), shutdown(hookCtx))
+	case <-idLost:
+		// another instance may generate the same ids, stop serving at once
+		hookCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.HookTimeout)
+		defer cancel()
+		return errors.Join(errors.New("http server, snowflake node id lease lost"), stopNow(), shutdown(hookCtx))
+	case <-ctx.Done():
+	}
+	// a second signal terminates the process immediately
+	stop()
+
+	log.Printf("http server, shutting down in %s\n", cfg.Server.ShutdownDelay)
+	hc.Shutdown()
+	time.Sleep(cfg.Server.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	var errs []error
+	err = server.Shutdown(shutdownCtx)
 	if err != nil {
-		log.Printf("http server, shutdown error : %s\n", err.Error())
+		errs = append(errs, fmt.Errorf("http server, shutdown error : %w", err))
 	}
-}
+	err = <-serveErr
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		errs = append(errs, fmt.Errorf("http server, listen and serve error : %w", err))
+	}
+	if grpcServer != nil {
+		stopGRPC(shutdownCtx, grpcServer)
+		err = <-grpcErr
+		if err != nil {
+			errs = append(errs, fmt.Errorf("grpc server, serve error : %w", err))
+		}
+	}
+	// a slow drain must not leave the hooks an expired context, storage and
+	// the id lease are released within their own deadline
+	hookCtx, cancelHooks := context.WithTimeout(context.Background(), cfg.Server.HookTimeout)
+	defer cancelHooks()
+	errs = append(errs, shutdown(hookCtx))
 
-func Execute(ctx context.Context, httpHandler http.Handler) error {
-	_httpHandler = httpHandler
-	_rootCmd.Run = runServer
+	return errors.Join(errs...)
+}
 
+// Execute runs the command line. The server runs until SIGINT or SIGTERM,
+// then drains and runs the shutdown hooks. Errors are returned to the caller.
+func Execute(ctx context.Context) error {
 	return _rootCmd.ExecuteContext(ctx)
 }
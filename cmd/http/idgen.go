@@ -0,0 +1,68 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/config"
+	"github.com/reddtsai/goAPI/pkg/blockaction/idgen"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage/shard"
+)
+
+// newIDGenerator takes the snowflake node ID from the configured source.
+// A leased ID comes with a hook releasing it and a channel closed when the
+// lease is lost, it is nil otherwise.
+func newIDGenerator(ctx context.Context, db storage.Backend) (*idgen.Snowflake, ShutdownHook, <-chan struct{}, error) {
+	c := _cfg.IDGen
+	var nodeID int64
+	var hook ShutdownHook
+	var lost <-chan struct{}
+	switch c.Source {
+	case config.NODE_ID_ENV:
+		id, err := idgen.NodeIDFromEnv(c.Env)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		nodeID = id
+	case config.NODE_ID_LEASE:
+		leaser, ok := leaseDB(db)
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("%s backend cannot lease node ids", _cfg.Storage.Backend)
+		}
+		host, _ := os.Hostname()
+		lease, err := idgen.NewLease(ctx, leaser, fmt.Sprintf("%s/%d", host, os.Getpid()), c.LeaseTTL, c.HeartbeatInterval)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		nodeID, hook, lost = lease.NodeID(), lease.Close, lease.Lost()
+	default:
+		nodeID = c.NodeID
+	}
+	g, err := idgen.NewSnowflake(nodeID)
+	if err != nil {
+		if hook != nil {
+			hook(context.Background())
+		}
+		return nil, nil, nil, err
+	}
+	slog.Info("snowflake node id", "source", c.Source, "node_id", nodeID)
+
+	return g, hook, lost, nil
+}
+
+// leaseDB returns the database holding the node id leases, the directory
+// shard of the sharded backend.
+func leaseDB(db storage.Backend) (idgen.Leaser, bool) {
+	switch db := db.(type) {
+	case *storage.BlockActionDB:
+		return db, true
+	case *shard.Storage:
+		leaser, ok := db.Node(_cfg.Shard.Directory).(idgen.Leaser)
+		return leaser, ok
+	}
+
+	return nil, false
+}
@@ -0,0 +1,170 @@
+package http
+
+import (
+	"fmt"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/config"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage/migration"
+)
+
+var (
+	_migrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "schema migration",
+	}
+	_migrateUpCmd = &cobra.Command{
+		Use:   "up",
+		Short: "apply pending migrations",
+		Args:  cobra.NoArgs,
+		RunE:  migrateUp,
+	}
+	_migrateDownCmd = &cobra.Command{
+		Use:   "down",
+		Short: "revert applied migrations",
+		Args:  cobra.NoArgs,
+		RunE:  migrateDown,
+	}
+	_migrateStatusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "list migrations and whether they are applied",
+		Args:  cobra.NoArgs,
+		RunE:  migrateStatus,
+	}
+	_migrateCreateCmd = &cobra.Command{
+		Use:   "create <name>",
+		Short: "create empty up and down files for a new migration",
+		Args:  cobra.ExactArgs(1),
+		RunE:  migrateCreate,
+	}
+)
+
+func init() {
+	_migrateUpCmd.Flags().Int("steps", 0, "number of migrations to apply, 0 applies all")
+	_migrateDownCmd.Flags().Int("steps", 1, "number of migrations to revert")
+	_migrateCreateCmd.Flags().String("dir", "", "migration directory, defaults to the one of the configured backend")
+	_migrateCmd.AddCommand(_migrateUpCmd, _migrateDownCmd, _migrateStatusCmd, _migrateCreateCmd)
+	_rootCmd.AddCommand(_migrateCmd)
+}
+
+func newMigrators(cmd *cobra.Command) ([]dbMigrator, func() error, error) {
+	db, migrators, err := openStorage(cmd.Context())
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(migrators) == 0 {
+		db.Close()
+		return nil, nil, fmt.Errorf("%s backend has no migrations", _cfg.Storage.Backend)
+	}
+
+	return migrators, db.Close, nil
+}
+
+// prefix labels the output of a shard when there are several databases.
+func prefix(migrators []dbMigrator, m dbMigrator) string {
+	if len(migrators) == 1 {
+		return ""
+	}
+
+	return m.Name + ": "
+}
+
+func migrateUp(cmd *cobra.Command, args []string) error {
+	steps, _ := cmd.Flags().GetInt("steps")
+	migrators, closeDB, err := newMigrators(cmd)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+	for _, m := range migrators {
+		applied, err := m.Up(cmd.Context(), steps)
+		for _, mig := range applied {
+			fmt.Fprintf(cmd.OutOrStdout(), "%sapplied %04d_%s\n", prefix(migrators, m), mig.Version, mig.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintf(cmd.OutOrStdout(), "%sno pending migration\n", prefix(migrators, m))
+		}
+	}
+
+	return nil
+}
+
+func migrateDown(cmd *cobra.Command, args []string) error {
+	steps, _ := cmd.Flags().GetInt("steps")
+	if steps < 1 {
+		return fmt.Errorf("steps must be at least 1")
+	}
+	migrators, closeDB, err := newMigrators(cmd)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+	for _, m := range migrators {
+		reverted, err := m.Down(cmd.Context(), steps)
+		for _, mig := range reverted {
+			fmt.Fprintf(cmd.OutOrStdout(), "%sreverted %04d_%s\n", prefix(migrators, m), mig.Version, mig.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func migrateStatus(cmd *cobra.Command, args []string) error {
+	migrators, closeDB, err := newMigrators(cmd)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	if len(migrators) > 1 {
+		fmt.Fprint(w, "SHARD\t")
+	}
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, m := range migrators {
+		statuses, err := m.Status(cmd.Context())
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = time.UnixMilli(s.AppliedAt).Format(time.RFC3339)
+			}
+			if len(migrators) > 1 {
+				fmt.Fprintf(w, "%s\t", m.Name)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+	}
+
+	return w.Flush()
+}
+
+func migrateCreate(cmd *cobra.Command, args []string) error {
+	dir, _ := cmd.Flags().GetString("dir")
+	if dir == "" {
+		backend := _cfg.Storage.Backend
+		if backend == config.BACKEND_SHARDED {
+			// shards are MySQL databases
+			backend = config.BACKEND_MYSQL
+		}
+		dir = filepath.Join("pkg/blockaction/storage/migration", backend)
+	}
+	up, down, err := migration.Create(dir, args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "created %s\ncreated %s\n", up, down)
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/config"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage/schema"
+)
+
+var (
+	_schemaCmd = &cobra.Command{
+		Use:   "schema",
+		Short: "database schema tools",
+	}
+	_schemaDiffCmd = &cobra.Command{
+		Use:   "diff",
+		Short: "compare the database schema with the storage models, exit non-zero on drift",
+		Args:  cobra.NoArgs,
+		RunE:  schemaDiff,
+	}
+
+	errSchemaDrift = errors.New("schema drift detected")
+)
+
+func init() {
+	_schemaDiffCmd.Flags().String("format", "text", "output format, one of text, json")
+	_schemaCmd.AddCommand(_schemaDiffCmd)
+	_rootCmd.AddCommand(_schemaCmd)
+}
+
+func schemaDiff(cmd *cobra.Command, args []string) error {
+	format, _ := cmd.Flags().GetString("format")
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown format %s", format)
+	}
+	if _cfg.Storage.Backend != config.BACKEND_MYSQL {
+		return fmt.Errorf("schema diff needs the %s backend, got %s", config.BACKEND_MYSQL, _cfg.Storage.Backend)
+	}
+	expected, err := schema.FromModels(storage.Models()...)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(expected))
+	for _, t := range expected {
+		names = append(names, t.Name)
+	}
+	db, err := storage.ConnMySQL(cmd.Context(), dbCfg().GetDSN(), 1, 1, 0)
+	if err != nil {
+		return fmt.Errorf("conn mysql fail : %w", err)
+	}
+	defer db.Close()
+	actual, err := schema.Inspect(cmd.Context(), db, names...)
+	if err != nil {
+		return fmt.Errorf("inspect schema fail : %w", err)
+	}
+
+	report := schema.Diff(expected, actual)
+	if format == "json" {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		err = report.WriteText(cmd.OutOrStdout())
+	}
+	if err != nil {
+		return err
+	}
+	if report.Drift {
+		return errSchemaDrift
+	}
+
+	return nil
+}
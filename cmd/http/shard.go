@@ -0,0 +1,57 @@
+package http
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/config"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage/shard"
+)
+
+var (
+	_shardCmd = &cobra.Command{
+		Use:   "shard",
+		Short: "sharded storage tools",
+	}
+	_shardBackfillCmd = &cobra.Command{
+		Use:   "backfill",
+		Short: "move users to the shard owning them and fill the account directory",
+		Args:  cobra.NoArgs,
+		RunE:  shardBackfill,
+	}
+)
+
+func init() {
+	_shardBackfillCmd.Flags().Int("batch", shard.BACKFILL_BATCH, "number of users read at a time")
+	_shardBackfillCmd.Flags().Bool("prune", false, "delete moved users from the shard they were copied from")
+	_shardBackfillCmd.Flags().Bool("dry-run", false, "count the users to move without writing")
+	_shardCmd.AddCommand(_shardBackfillCmd)
+	_rootCmd.AddCommand(_shardCmd)
+}
+
+func shardBackfill(cmd *cobra.Command, args []string) error {
+	if _cfg.Storage.Backend != config.BACKEND_SHARDED {
+		return fmt.Errorf("shard backfill needs the %s backend, got %s", config.BACKEND_SHARDED, _cfg.Storage.Backend)
+	}
+	var opts shard.BackfillOptions
+	opts.Batch, _ = cmd.Flags().GetInt("batch")
+	opts.Prune, _ = cmd.Flags().GetBool("prune")
+	opts.DryRun, _ = cmd.Flags().GetBool("dry-run")
+	db, _, err := openStorage(cmd.Context())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	stats, err := db.(*shard.Storage).Backfill(cmd.Context(), opts)
+	fmt.Fprintf(cmd.OutOrStdout(), "scanned %d, moved %d, pruned %d, reserved %d, conflicts %d\n",
+		stats.Scanned, stats.Moved, stats.Pruned, stats.Reserved, stats.Conflicts)
+	if err != nil {
+		return err
+	}
+	if stats.Conflicts > 0 {
+		return fmt.Errorf("%d users conflict with another user in the directory or on their shard, check the logs", stats.Conflicts)
+	}
+
+	return nil
+}
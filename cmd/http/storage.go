@@ -0,0 +1,182 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/config"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage/cache"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage/migration"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage/shard"
+)
+
+// dbMigrator is the migrator of one database, named after its shard when
+// the backend is sharded.
+type dbMigrator struct {
+	Name string
+	*migration.Migrator
+}
+
+// openStorage opens the backend selected by the config with a migrator per
+// database. There is no migrator for the memory backend, which has no
+// schema.
+func openStorage(ctx context.Context) (storage.Backend, []dbMigrator, error) {
+	var db *storage.BlockActionDB
+	var dialect migration.Dialect
+	var err error
+	switch _cfg.Storage.Backend {
+	case config.BACKEND_MEMORY:
+		return storage.NewMemoryStorage(), nil, nil
+	case config.BACKEND_SHARDED:
+		return openShards(ctx)
+	case config.BACKEND_POSTGRES:
+		connectCtx, cancel := context.WithTimeout(ctx, _cfg.Postgres.ConnectTimeout)
+		defer cancel()
+		db, err = storage.NewBlockActionPostgres(connectCtx, storage.BlockActionPostgresCfg{
+			DSN:             _cfg.Postgres.DSN,
+			UserName:        _cfg.Postgres.Username,
+			Password:        _cfg.Postgres.Password,
+			Address:         _cfg.Postgres.Addr,
+			DBName:          _cfg.Postgres.DB,
+			SSLMode:         _cfg.Postgres.SSLMode,
+			MaxOpenConn:     _cfg.Postgres.MaxOpenConn,
+			MaxIdleConn:     _cfg.Postgres.MaxIdleConn,
+			ConnMaxLifetime: _cfg.Postgres.ConnMaxLifetime,
+			QueryTimeout:    _cfg.Postgres.QueryTimeout,
+		})
+		dialect = migration.Postgres{}
+	case config.BACKEND_SQLITE:
+		db, err = storage.NewBlockActionSQLite(ctx, storage.BlockActionSQLiteCfg{
+			File:         _cfg.SQLite.File,
+			QueryTimeout: _cfg.MySQL.QueryTimeout,
+		})
+		dialect = migration.SQLite{}
+	default:
+		connectCtx, cancel := context.WithTimeout(ctx, _cfg.MySQL.ConnectTimeout)
+		defer cancel()
+		db, err = storage.NewBlockActionDB(connectCtx, dbCfg())
+		dialect = migration.MySQL{}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	migrator, err := newDBMigrator(db, dialect)
+	if err != nil {
+		return nil, nil, errors.Join(err, db.Close())
+	}
+
+	return db, []dbMigrator{{Name: _cfg.Storage.Backend, Migrator: migrator}}, nil
+}
+
+// openShards connects every shard of the sharded backend, the account
+// directory lives in the shard named by shard-options.directory.
+func openShards(ctx context.Context) (storage.Backend, []dbMigrator, error) {
+	nodes := make(map[string]shard.Node)
+	closeAll := func() error {
+		var errs []error
+		for _, node := range nodes {
+			errs = append(errs, node.Close())
+		}
+		return errors.Join(errs...)
+	}
+	var migrators []dbMigrator
+	for _, node := range _cfg.Shard.Shards {
+		cfg := dbCfg()
+		cfg.Address = node.Addr
+		cfg.DBName = node.DB
+		cfg.Replicas = node.Replicas
+		connectCtx, cancel := context.WithTimeout(ctx, _cfg.MySQL.ConnectTimeout)
+		db, err := storage.NewBlockActionDB(connectCtx, cfg)
+		cancel()
+		if err != nil {
+			return nil, nil, errors.Join(fmt.Errorf("shard %s : %w", node.Name, err), closeAll())
+		}
+		nodes[node.Name] = db
+		migrator, err := newDBMigrator(db, migration.MySQL{})
+		if err != nil {
+			return nil, nil, errors.Join(fmt.Errorf("shard %s : %w", node.Name, err), closeAll())
+		}
+		migrators = append(migrators, dbMigrator{Name: node.Name, Migrator: migrator})
+	}
+	directory := nodes[_cfg.Shard.Directory].(*storage.BlockActionDB)
+	s, err := shard.New(nodes, _cfg.Shard.SlotOwners(), directory)
+	if err != nil {
+		return nil, nil, errors.Join(err, closeAll())
+	}
+
+	return s, migrators, nil
+}
+
+func newDBMigrator(db *storage.BlockActionDB, dialect migration.Dialect) (*migration.Migrator, error) {
+	sqlDB, err := db.SQLDB()
+	if err != nil {
+		return nil, err
+	}
+	migrator, err := migration.NewMigrator(sqlDB, dialect)
+	if err != nil {
+		return nil, fmt.Errorf("init migrator : %w", err)
+	}
+
+	return migrator, nil
+}
+
+// mysqlDBs returns the MySQL databases of s, which may have replicas.
+func mysqlDBs(s storage.Backend) []*storage.BlockActionDB {
+	switch s := s.(type) {
+	case *storage.BlockActionDB:
+		return []*storage.BlockActionDB{s}
+	case *shard.Storage:
+		var dbs []*storage.BlockActionDB
+		for _, name := range s.Shards() {
+			dbs = append(dbs, s.Node(name).(*storage.BlockActionDB))
+		}
+		return dbs
+	}
+
+	return nil
+}
+
+func dbCfg() storage.BlockActionDBCfg {
+	return storage.BlockActionDBCfg{
+		DSN:             _cfg.MySQL.DSN,
+		UserName:        _cfg.MySQL.Username,
+		Password:        _cfg.MySQL.Password,
+		Address:         _cfg.MySQL.Addr,
+		DBName:          _cfg.MySQL.DB,
+		MaxOpenConn:     _cfg.MySQL.MaxOpenConn,
+		MaxIdleConn:     _cfg.MySQL.MaxIdleConn,
+		ConnMaxLifetime: _cfg.MySQL.ConnMaxLifetime,
+		QueryTimeout:    _cfg.MySQL.QueryTimeout,
+		ConnectTimeout:  _cfg.MySQL.ConnectTimeout,
+		Replicas:        _cfg.MySQL.Replicas,
+	}
+}
+
+// withCache wraps s with the configured read-through cache. A failing cache
+// degrades to reading through, so it is not a readiness check.
+func withCache(s storage.IStorage) (storage.IStorage, ShutdownHook) {
+	c := _cfg.Cache
+	opts := []cache.CacheOption{
+		cache.SetTTL(c.TTL),
+		cache.SetNegativeTTL(c.NegativeTTL),
+	}
+	switch c.Backend {
+	case config.CACHE_LRU:
+		return cache.New(s, cache.NewLRU(c.Size), opts...), nil
+	case config.CACHE_REDIS:
+		client := redis.NewClient(&redis.Options{
+			Addr:     c.Redis.Addr,
+			Password: c.Redis.Password,
+			DB:       c.Redis.DB,
+		})
+		return cache.New(s, cache.NewRedis(client, c.KeyPrefix), opts...), func(ctx context.Context) error {
+			return client.Close()
+		}
+	}
+
+	return s, nil
+}
@@ -0,0 +1,167 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/config"
+)
+
+var _tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var _tlsClientAuth = map[string]tls.ClientAuthType{
+	"none":            tls.NoClientCert,
+	"request":         tls.RequestClientCert,
+	"verify-if-given": tls.VerifyClientCertIfGiven,
+	"require":         tls.RequireAndVerifyClientCert,
+}
+
+// certReloader serves the certificate, key and client CA bundle currently on
+// disk. Files are polled so rotated certificates apply without a restart.
+type certReloader struct {
+	cfg config.TLSCfg
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	modTime  time.Time
+}
+
+func newTLSConfig(ctx context.Context, cfg config.TLSCfg) (*tls.Config, error) {
+	minVersion, ok := _tlsVersions[cfg.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported tls min version %q", cfg.MinVersion)
+	}
+	clientAuth, ok := _tlsClientAuth[cfg.ClientAuth]
+	if !ok {
+		return nil, fmt.Errorf("unsupported tls client auth %q", cfg.ClientAuth)
+	}
+	if clientAuth != tls.NoClientCert && clientAuth != tls.RequestClientCert && cfg.ClientCAFile == "" {
+		return nil, fmt.Errorf("tls client auth %q requires a client ca file", cfg.ClientAuth)
+	}
+	r := &certReloader{cfg: cfg}
+	err := r.reload()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ReloadInterval > 0 {
+		go r.watch(ctx)
+	}
+
+	base := &tls.Config{
+		MinVersion: minVersion,
+		ClientAuth: clientAuth,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		},
+	}
+	// client CAs can only be swapped per handshake through a derived config
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cert, clientCA := r.current()
+		c := base.Clone()
+		c.GetConfigForClient = nil
+		c.Certificates = []tls.Certificate{*cert}
+		c.ClientCAs = clientCA
+		return c, nil
+	}
+
+	return base, nil
+}
+
+func (r *certReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, r.clientCA
+}
+
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load tls key pair fail : %w", err)
+	}
+	var clientCA *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("read tls client ca fail : %w", err)
+		}
+		clientCA = x509.NewCertPool()
+		if !clientCA.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in tls client ca %s", r.cfg.ClientCAFile)
+		}
+	}
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCA = clientCA
+	r.modTime = modTime
+
+	return nil
+}
+
+func (r *certReloader) latestModTime() (modTime time.Time, err error) {
+	for _, name := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile} {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return modTime, fmt.Errorf("stat tls file fail : %w", err)
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+
+	return
+}
+
+// watch keeps serving the previous certificate when a reload fails, e.g.
+// while the files are only partially written.
+func (r *certReloader) watch(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		modTime, err := r.latestModTime()
+		if err != nil {
+			log.Printf("tls, reload error : %s\n", err.Error())
+			continue
+		}
+		r.mu.RLock()
+		changed := modTime.After(r.modTime)
+		r.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		err = r.reload()
+		if err != nil {
+			log.Printf("tls, reload error : %s\n", err.Error())
+			continue
+		}
+		log.Printf("tls, certificates reloaded\n")
+	}
+}
@@ -0,0 +1,78 @@
+package http
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/config"
+)
+
+func writeCert(t *testing.T, dir, cn string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	err = os.WriteFile(filepath.Join(dir, "tls.crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	assert.Nil(t, err)
+	err = os.WriteFile(filepath.Join(dir, "tls.key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	assert.Nil(t, err)
+}
+
+func TestTLSConfigReload(t *testing.T) {
+	dir := t.TempDir()
+	writeCert(t, dir, "first")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg, err := newTLSConfig(ctx, config.TLSCfg{
+		CertFile:       filepath.Join(dir, "tls.crt"),
+		KeyFile:        filepath.Join(dir, "tls.key"),
+		ClientAuth:     "none",
+		MinVersion:     "1.2",
+		ReloadInterval: 10 * time.Millisecond,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), cfg.MinVersion)
+
+	commonName := func() string {
+		c, err := cfg.GetConfigForClient(&tls.ClientHelloInfo{})
+		assert.Nil(t, err)
+		leaf, err := x509.ParseCertificate(c.Certificates[0].Certificate[0])
+		assert.Nil(t, err)
+		return leaf.Subject.CommonName
+	}
+	assert.Equal(t, "first", commonName())
+
+	time.Sleep(20 * time.Millisecond)
+	writeCert(t, dir, "second")
+	future := time.Now().Add(time.Second)
+	os.Chtimes(filepath.Join(dir, "tls.crt"), future, future)
+	assert.Eventually(t, func() bool { return commonName() == "second" }, time.Second, 10*time.Millisecond)
+}
+
+func TestTLSConfigInvalid(t *testing.T) {
+	_, err := newTLSConfig(context.Background(), config.TLSCfg{MinVersion: "1.4", ClientAuth: "none"})
+	assert.NotNil(t, err)
+	_, err = newTLSConfig(context.Background(), config.TLSCfg{MinVersion: "1.2", ClientAuth: "require"})
+	assert.NotNil(t, err)
+}
@@ -1,25 +1,24 @@
 package api
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/bwmarrin/snowflake"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	swaggerfiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 
 	docs "github.com/reddtsai/goAPI/pkg/blockaction/api/swagger"
+	"github.com/reddtsai/goAPI/pkg/blockaction/auth"
+	"github.com/reddtsai/goAPI/pkg/blockaction/health"
+	"github.com/reddtsai/goAPI/pkg/blockaction/service"
 	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
 )
 
@@ -27,32 +26,34 @@ type IBlockActionApi interface {
 	http.Handler
 
 	Health(c *gin.Context)
+	Livez(c *gin.Context)
+	Readyz(c *gin.Context)
 	Signup(c *gin.Context)
 	Signin(c *gin.Context)
+	RefreshToken(c *gin.Context)
 	GetPersonalInfo(c *gin.Context)
+	JWKS(c *gin.Context)
 }
 
 const (
-	SECRET            = "8w+uSC4vD136hOaT1m1fWeuuULid9LiLSJ52kAPHC33bY9lK5/3ZAS+nm+HaJz93qCWDXcrJLl/9mcXzwUL3DQ=="
-	TOKEN_EXPIRE_TIME = 900
+	TOKEN_EXPIRE_TIME = service.TOKEN_EXPIRE_TIME
 	CTX_REQUEST_ID    = "c_request_id"
 	CTX_USER_ID       = "c_user_id"
 	CTX_USER_ACCOUNT  = "c_user_account"
+	CTX_CLIENT_ID     = "c_client_identity"
+	// 與 auth.DEFAULT_CACHE_TTL 相同
+	JWKS_CACHE_CONTROL = "public, max-age=300"
 )
 
 var (
 	_ IBlockActionApi = (*BlockActionApi)(nil)
 
-	_snowNode      *snowflake.Node
 	_routerMetrics *RouterMetrics
 )
 
+type IDGenerator = service.IDGenerator
+
 func init() {
-	node, err := snowflake.NewNode(1)
-	if err != nil {
-		panic(err)
-	}
-	_snowNode = node
 	_routerMetrics = &RouterMetrics{
 		RequestTotal: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
@@ -68,66 +69,140 @@ func init() {
 			},
 			[]string{"http_code", "http_method", "http_url_path", "http_service"},
 		),
+		VersionRequestTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "api_router_version_requests_total",
+				Help: "Requests total count per api version and client",
+			},
+			[]string{"api_version", "client"},
+		),
 	}
 }
 
 // @title BlockAction API
 // @version 1.0
 // @description This is a BlockAction API.
+// @securityDefinitions.apikey BearerAuth
 // @in header
 // @name Authorization
+// @description Bearer token of signin, e.g. "Bearer eyJhbGciOiJIUzI1NiJ9..."
 // @tag.name BlockAction
 func NewBlockActionApi(opts ...BlockActionApiOption) (*BlockActionApi, error) {
+	var err error
 	api := new(BlockActionApi)
 	api.opts = DefaultOptions()
 	for _, opt := range opts {
 		opt(&api.opts)
 	}
-	if api.opts.storage == nil {
-		return nil, fmt.Errorf("storage is nil")
+	err = api.checkOrigins(api.opts.allowOrigins)
+	if err != nil {
+		return nil, err
+	}
+	if api.opts.service == nil {
+		svc, err := service.New(
+			service.SetStorage(api.opts.storage),
+			service.SetIDGenerator(api.opts.idGenerator),
+			service.SetSecret(string(api.opts.secret)),
+			service.SetTokenTTL(api.opts.tokenTTL),
+			service.SetRateLimit(api.opts.rateLimit, api.opts.rateBurst),
+		)
+		if err != nil {
+			return nil, err
+		}
+		api.opts.service = svc
+	}
+	if api.opts.health == nil {
+		api.opts.health = health.New()
+	}
+	if api.opts.messages == nil {
+		api.opts.messages = NewMessages()
 	}
 
 	api.Engine = gin.New()
-	api.Engine.Use(gin.Logger())
-	api.Engine.Use(gin.Recovery())
-	api.Engine.Use(cors.New(cors.Config{
-		AllowOrigins:     api.opts.allowOrigins,
-		AllowMethods:     api.opts.allowMethods,
-		AllowHeaders:     api.opts.allowHeaders,
-		ExposeHeaders:    api.opts.exposeHeaders,
-		AllowCredentials: api.opts.allowCredentials,
-		MaxAge:           api.opts.maxAge,
+	err = api.Engine.SetTrustedProxies(api.opts.trustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("set trusted proxies fail : %w", err)
+	}
+	// recovery comes first so a panic in any other middleware is answered
+	// with the envelope, the request ID is set before a handler can panic
+	api.Engine.Use(gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+		writeError(c, fmt.Errorf("panic : %v", recovered))
 	}))
+	api.Engine.Use(api.requestIDMiddleware)
+	api.Engine.Use(gin.Logger())
+	api.Engine.Use(api.localeMiddleware)
+	api.Engine.NoRoute(func(c *gin.Context) {
+		writeError(c, ErrNotFound)
+	})
+	api.Engine.Use(clientCertMiddleware)
+	api.Engine.Use(storageSessionMiddleware)
+	api.runtime.Store(&RuntimeOptions{
+		AllowOrigins: api.opts.allowOrigins,
+		RateLimit:    api.opts.rateLimit,
+		RateBurst:    api.opts.rateBurst,
+		TokenTTL:     api.opts.tokenTTL,
+	})
+	api.Engine.Use(api.corsMiddleware())
 	api.Engine.GET("/health", api.Health)
+	api.Engine.GET("/livez", api.Livez)
+	api.Engine.GET("/readyz", api.Readyz)
+	api.Engine.GET(auth.JWKS_PATH, api.JWKS)
 	privateGroup := api.Engine.Group("/_")
 	{
 		prometheus.Register(_routerMetrics)
 		privateGroup.GET("/metrics", gin.WrapH(promhttp.Handler()))
+		privateGroup.GET("/livez", api.PrivateLivez)
+		privateGroup.GET("/readyz", api.PrivateReadyz)
+		if api.opts.configVersion != nil {
+			privateGroup.GET("/config/version", api.ConfigVersion)
+		}
+	}
+	api.openapi, err = OpenAPI()
+	if err != nil {
+		return nil, err
+	}
+	api.Engine.GET("/openapi.json", api.OpenAPIDoc)
+	if api.opts.openAPIValidation {
+		validation, err := openAPIValidationMiddleware(api.openapi)
+		if err != nil {
+			return nil, err
+		}
+		api.Engine.Use(validation)
 	}
 	docs.SwaggerInfo.BasePath = "/v1"
 	api.Engine.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
 	v1Group := api.Engine.Group("/v1")
-	{
-		v1Group.Use(middleware)
-		v1Group.POST("/signup", api.Signup)
-		v1Group.POST("/signin", api.Signin)
-
-		userGroup := v1Group.Group("/user")
-		userGroup.Use(authMiddleware)
-		userGroup.GET("/personal-info", api.GetPersonalInfo)
-	}
+	v1Group.Use(deprecationMiddleware(api.opts.v1Deprecation))
+	api.routes(v1Group, API_V1)
+	v2Group := api.Engine.Group("/v2")
+	api.routes(v2Group, API_V2)
 
 	return api, nil
 }
 
 type BlockActionApiOptions struct {
-	allowOrigins     []string
-	allowMethods     []string
-	allowHeaders     []string
-	exposeHeaders    []string
-	allowCredentials bool
-	maxAge           time.Duration
-	storage          storage.IStorage
+	allowOrigins      []string
+	allowMethods      []string
+	allowHeaders      []string
+	exposeHeaders     []string
+	allowCredentials  bool
+	maxAge            time.Duration
+	service           *service.Service
+	storage           storage.IStorage
+	health            *health.Health
+	idGenerator       IDGenerator
+	messages          *Messages
+	trustedClients    []string
+	trustedProxies    []string
+	adminClients      []string
+	secret            []byte
+	tokenTTL          time.Duration
+	rateLimit         float64
+	rateBurst         int
+	configVersion     func() interface{}
+	v1Deprecation     Deprecation
+	metricsClients    []string
+	openAPIValidation bool
 }
 
 type BlockActionApiOption func(*BlockActionApiOptions)
@@ -136,10 +211,190 @@ func DefaultOptions() BlockActionApiOptions {
 	return BlockActionApiOptions{
 		allowOrigins:     []string{"*"},
 		allowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
-		allowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "authorization", "X-Request-ID", "X-API-Key"},
+		allowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "authorization", "X-Request-ID", "X-API-Key", "Accept-Language"},
 		exposeHeaders:    []string{"*"},
-		allowCredentials: true,
+		allowCredentials: false,
 		maxAge:           24 * time.Hour,
+		tokenTTL:         TOKEN_EXPIRE_TIME * time.Second,
+	}
+}
+
+func SetAllowOrigins(origins []string) BlockActionApiOption {
+	return func(o *BlockActionApiOptions) {
+		o.allowOrigins = origins
+	}
+}
+
+func SetAllowMethods(methods []string) BlockActionApiOption {
+	return func(o *BlockActionApiOptions) {
+		o.allowMethods = methods
+	}
+}
+
+func SetAllowHeaders(headers []string) BlockActionApiOption {
+	return func(o *BlockActionApiOptions) {
+		o.allowHeaders = headers
+	}
+}
+
+func SetExposeHeaders(headers []string) BlockActionApiOption {
+	return func(o *BlockActionApiOptions) {
+		o.exposeHeaders = headers
+	}
+}
+
+func SetAllowCredentials(allow bool) BlockActionApiOption {
+	return func(o *BlockActionApiOptions) {
+		o.allowCredentials = allow
+	}
+}
+
+func SetMaxAge(maxAge time.Duration) BlockActionApiOption {
+	return func(o *BlockActionApiOptions) {
+		o.maxAge = maxAge
+	}
+}
+
+// SetSecret sets the key signing tokens and passwords.
+func SetSecret(secret string) BlockActionApiOption {
+	return func(o *BlockActionApiOptions) {
+		o.secret = []byte(secret)
+	}
+}
+
+func SetTokenTTL(ttl time.Duration) BlockActionApiOption {
+	return func(o *BlockActionApiOptions) {
+		o.tokenTTL = ttl
+	}
+}
+
+// SetRateLimit limits requests per client IP to rps with bursts of burst.
+// A zero rps disables the limit. With SetService, the limit of the service
+// applies instead.
+func SetRateLimit(rps float64, burst int) BlockActionApiOption {
+	return func(o *BlockActionApiOptions) {
+		o.rateLimit = rps
+		o.rateBurst = burst
+	}
+}
+
+// SetTrustedProxies lists the IPs or CIDRs of the proxies whose
+// X-Forwarded-For header gives the client IP, for the rate limit and the
+// logs. None by default, the client IP is the peer address.
+func SetTrustedProxies(proxies []string) BlockActionApiOption {
+	return func(o *BlockActionApiOptions) {
+		o.trustedProxies = proxies
+	}
+}
+
+// SetConfigVersion exposes the active config version on /_/config/version.
+func SetConfigVersion(fn func() interface{}) BlockActionApiOption {
+	return func(o *BlockActionApiOptions) {
+		o.configVersion = fn
+	}
+}
+
+// RuntimeOptions are the options that can be replaced while serving.
+type RuntimeOptions struct {
+	AllowOrigins []string
+	RateLimit    float64
+	RateBurst    int
+	TokenTTL     time.Duration
+}
+
+// Reload atomically replaces the runtime options.
+func (b *BlockActionApi) Reload(r RuntimeOptions) error {
+	err := b.checkOrigins(r.AllowOrigins)
+	if err != nil {
+		return err
+	}
+	if r.TokenTTL <= 0 {
+		return fmt.Errorf("token ttl must be positive")
+	}
+	b.runtime.Store(&r)
+	b.opts.service.ReloadTokenTTL(r.TokenTTL)
+	b.opts.service.ReloadRateLimit(r.RateLimit, r.RateBurst)
+
+	return nil
+}
+
+func (b *BlockActionApi) runtimeOptions() *RuntimeOptions {
+	return b.runtime.Load()
+}
+
+// checkOrigins rejects a * origin with credentials, it would let any site
+// send requests with the cookies of the user.
+func (b *BlockActionApi) checkOrigins(origins []string) error {
+	if len(origins) == 0 {
+		return fmt.Errorf("allow origins is empty")
+	}
+	if b.opts.allowCredentials && slices.Contains(origins, "*") {
+		return fmt.Errorf("allow origins * is not allowed with credentials")
+	}
+
+	return nil
+}
+
+// corsMiddleware answers a literal * while the allowed origins contain *,
+// otherwise the origin of the request when it is allowed.
+func (b *BlockActionApi) corsMiddleware() gin.HandlerFunc {
+	config := cors.Config{
+		AllowMethods:     b.opts.allowMethods,
+		AllowHeaders:     b.opts.allowHeaders,
+		ExposeHeaders:    b.opts.exposeHeaders,
+		AllowCredentials: b.opts.allowCredentials,
+		MaxAge:           b.opts.maxAge,
+	}
+	anyOrigin := config
+	anyOrigin.AllowAllOrigins = true
+	// checkOrigins keeps * away from credentials, never send both
+	anyOrigin.AllowCredentials = false
+	allowAll := cors.New(anyOrigin)
+	config.AllowOriginFunc = b.allowOrigin
+	allowListed := cors.New(config)
+
+	return func(c *gin.Context) {
+		if slices.Contains(b.runtimeOptions().AllowOrigins, "*") {
+			allowAll(c)
+			return
+		}
+		allowListed(c)
+	}
+}
+
+func (b *BlockActionApi) allowOrigin(origin string) bool {
+	for _, o := range b.runtimeOptions().AllowOrigins {
+		if matchOrigin(o, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchOrigin matches an origin against an allowed one, which may hold a *
+// for the subdomains of a site, e.g. https://*.example.com.
+func matchOrigin(pattern, origin string) bool {
+	pattern, origin = strings.ToLower(pattern), strings.ToLower(origin)
+	prefix, suffix, ok := strings.Cut(pattern, "*")
+	if !ok {
+		return pattern == origin
+	}
+	if len(origin) <= len(prefix)+len(suffix) || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+	// the * spans host labels only, never the scheme, port or a path
+	sub := origin[len(prefix) : len(origin)-len(suffix)]
+
+	return !strings.ContainsAny(sub, "/:@*")
+}
+
+// SetService sets the service behind the handlers, shared with the other
+// transports. Otherwise the api builds one from the storage, secret, id
+// generator, token ttl and rate limit options.
+func SetService(svc *service.Service) BlockActionApiOption {
+	return func(o *BlockActionApiOptions) {
+		o.service = svc
 	}
 }
 
@@ -149,40 +404,58 @@ func SetStorage(storage storage.IStorage) BlockActionApiOption {
 	}
 }
 
-func signaturePwd(pwd string) (mac string, err error) {
-	mac, err = hmacSignature([]byte(pwd), []byte(SECRET))
-	return
+func SetIDGenerator(g IDGenerator) BlockActionApiOption {
+	return func(o *BlockActionApiOptions) {
+		o.idGenerator = g
+	}
 }
 
-func validatePwd(pwd, secret string) (bool, error) {
-	mac, err := hmacSignature([]byte(pwd), []byte(SECRET))
-	if err != nil {
-		return false, err
+// SetMessages sets the localized catalogue messages, NewMessages by default.
+func SetMessages(messages *Messages) BlockActionApiOption {
+	return func(o *BlockActionApiOptions) {
+		o.messages = messages
 	}
+}
 
-	return (mac == secret), nil
+// Messages returns the catalogue messages, languages added to them are
+// negotiated from then on.
+func (b *BlockActionApi) Messages() *Messages {
+	return b.opts.messages
 }
 
-func hmacSignature(msg []byte, key []byte) (string, error) {
-	mac := hmac.New(sha256.New, key)
-	if _, err := mac.Write(msg); err != nil {
-		return "", err
+func SetHealth(health *health.Health) BlockActionApiOption {
+	return func(o *BlockActionApiOptions) {
+		o.health = health
 	}
-	return hex.EncodeToString(mac.Sum(nil)), nil
 }
 
-func genToken(claims jwt.Claims) (token string, err error) {
-	tokenClaims := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	token, err = tokenClaims.SignedString([]byte(SECRET))
+// SetTrustedClients lists the mTLS client identities allowed to call user
+// endpoints on behalf of the user given in the X-User-ID header.
+func SetTrustedClients(identities []string) BlockActionApiOption {
+	return func(o *BlockActionApiOptions) {
+		o.trustedClients = identities
+	}
+}
 
-	return
+// SetAdminClients lists the mTLS client identities allowed to call admin
+// endpoints.
+func SetAdminClients(identities []string) BlockActionApiOption {
+	return func(o *BlockActionApiOptions) {
+		o.adminClients = identities
+	}
 }
 
-func middleware(c *gin.Context) {
-	requestID := _snowNode.Generate().String()
+// requestIDMiddleware gives every request an ID, returned in X-Request-ID
+// and in every error.
+func (b *BlockActionApi) requestIDMiddleware(c *gin.Context) {
+	requestID := b.opts.service.NewRequestID()
 	c.Set(CTX_REQUEST_ID, requestID)
 	c.Header("X-Request-ID", requestID)
 
+	c.Next()
+}
+
+func middleware(c *gin.Context) {
 	startTime := time.Now()
 	defer func() {
 		statusCode := strconv.Itoa(c.Writer.Status())
@@ -196,32 +469,36 @@ func middleware(c *gin.Context) {
 }
 
 type RouterMetrics struct {
-	RequestTotal    *prometheus.CounterVec
-	RequestDuration *prometheus.HistogramVec
+	RequestTotal        *prometheus.CounterVec
+	RequestDuration     *prometheus.HistogramVec
+	VersionRequestTotal *prometheus.CounterVec
 }
 
 func (m *RouterMetrics) Collect(ch chan<- prometheus.Metric) {
 	m.RequestTotal.Collect(ch)
 	m.RequestDuration.Collect(ch)
+	m.VersionRequestTotal.Collect(ch)
 }
 
 func (m *RouterMetrics) Describe(ch chan<- *prometheus.Desc) {
 	m.RequestTotal.Describe(ch)
 	m.RequestDuration.Describe(ch)
+	m.VersionRequestTotal.Describe(ch)
 }
 
-func authMiddleware(c *gin.Context) {
-	token := getBearerToken(c.GetHeader("Authorization"))
+func (b *BlockActionApi) authMiddleware(c *gin.Context) {
+	token := auth.BearerToken(c.GetHeader("Authorization"))
 	if token == "" {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid Authorization"})
+		if b.authByClientCert(c) {
+			c.Next()
+			return
+		}
+		writeError(c, ErrUnauthorized)
 		return
 	}
-	claims := &UserClaims{}
-	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
-		return []byte(SECRET), nil
-	})
+	claims, err := b.opts.service.ValidateToken(token)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid Authorization"})
+		writeError(c, ErrUnauthorized)
 		return
 	}
 
@@ -231,11 +508,50 @@ func authMiddleware(c *gin.Context) {
 	c.Next()
 }
 
-func getBearerToken(auth string) (token string) {
-	bearer := strings.Split(auth, "Bearer ")
-	if len(bearer) == 2 {
-		token = bearer[1]
+// adminMiddleware only lets admin clients through, they are identified by
+// their mTLS client certificate.
+func (b *BlockActionApi) adminMiddleware(c *gin.Context) {
+	identity := ClientIdentity(c)
+	if identity == "" || !slices.Contains(b.opts.adminClients, identity) {
+		writeError(c, ErrForbidden)
+		return
 	}
 
-	return
+	c.Next()
+}
+
+func (b *BlockActionApi) authByClientCert(c *gin.Context) bool {
+	identity := ClientIdentity(c)
+	if identity == "" || !slices.Contains(b.opts.trustedClients, identity) {
+		return false
+	}
+	userID, err := strconv.ParseInt(c.GetHeader("X-User-ID"), 10, 64)
+	if err != nil {
+		return false
+	}
+	c.Set(CTX_USER_ID, userID)
+
+	return true
+}
+
+func clientCertMiddleware(c *gin.Context) {
+	if identity := auth.TLSIdentity(c.Request.TLS); identity != "" {
+		c.Set(CTX_CLIENT_ID, identity)
+	}
+
+	c.Next()
+}
+
+// storageSessionMiddleware scopes a storage session to the request, so reads
+// after a write in the same request are served by the primary.
+func storageSessionMiddleware(c *gin.Context) {
+	c.Request = c.Request.WithContext(storage.WithSession(c.Request.Context()))
+
+	c.Next()
+}
+
+// ClientIdentity returns the identity of a client certificate verified by
+// mutual TLS, or empty when the client did not present one.
+func ClientIdentity(c *gin.Context) string {
+	return c.GetString(CTX_CLIENT_ID)
 }
@@ -1,22 +1,34 @@
 package api
 
 import (
-	"time"
-
-	"github.com/golang-jwt/jwt/v5"
+	"encoding/json"
+	"strconv"
 
+	"github.com/reddtsai/goAPI/pkg/blockaction/service"
 	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
 )
 
-type UserClaims struct {
-	ID      int64  `json:"id"`
-	Account string `json:"account"`
-	jwt.RegisteredClaims
-}
+type UserClaims = service.UserClaims
 
+// BaseResponse is the envelope of every response, Result is set on success
+// and Error otherwise.
 type BaseResponse struct {
 	Result interface{} `json:"result,omitempty"`
-	Error  string      `json:"error,omitempty"`
+	Error  *ErrorBody  `json:"error,omitempty"`
+}
+
+type ErrorBody struct {
+	Code      string       `json:"code" example:"USER_NOT_FOUND"`            // 錯誤碼, 見 Errors
+	Message   string       `json:"message" example:"user not found"`         // 說明
+	RequestID string       `json:"request_id" example:"1780000000000000000"` // 請求 ID
+	Details   []FieldError `json:"details,omitempty"`                        // 欄位驗證錯誤
+}
+
+type FieldError struct {
+	Field   string `json:"field" example:"account"`                                 // 欄位
+	Rule    string `json:"rule" example:"min"`                                      // 驗證規則
+	Param   string `json:"param,omitempty" example:"6"`                             // 規則參數
+	Message string `json:"message" example:"account must be at least 6 characters"` // 說明
 }
 
 type SignupReq struct {
@@ -25,22 +37,6 @@ type SignupReq struct {
 	UserName string `json:"user_name" binding:"required,min=2,max=20"` // 名稱
 }
 
-func (c *SignupReq) ToEntity() (entity storage.UserTable, err error) {
-	id := _snowNode.Generate().Int64()
-	entity = storage.UserTable{
-		ID:        id,
-		Account:   c.Account,
-		Name:      c.UserName,
-		CreatedAt: time.Now().UnixMilli(),
-		Creator:   id,
-		UpdatedAt: time.Now().UnixMilli(),
-		Updater:   id,
-	}
-	entity.Secret, err = signaturePwd(c.Password)
-
-	return
-}
-
 type SignupResp struct {
 	Account string `json:"account"`
 }
@@ -55,8 +51,50 @@ type SigninResp struct {
 	RefreshToken string `json:"refresh_token"` // refresh token
 }
 
+type RefreshTokenReq struct {
+	RefreshToken string `json:"refresh_token" binding:"required"` // refresh token
+}
+
 type GetPersonalInfoResp struct {
 	ID       string `json:"id"`
 	Account  string `json:"account"`
 	UserName string `json:"user_name"`
 }
+
+type UserHistoryResp struct {
+	ID        string          `json:"id"`
+	Action    string          `json:"action"`                                // create, update, delete
+	Version   int64           `json:"version"`                               // 異動後版本
+	Before    json.RawMessage `json:"before,omitempty" swaggertype:"object"` // 異動前, create 沒有
+	After     json.RawMessage `json:"after" swaggertype:"object"`            // 異動後
+	Updater   string          `json:"updater"`                               // 修改者
+	CreatedAt int64           `json:"created_at"`                            // 異動時間 (毫秒)
+}
+
+type GetUserHistoryResp struct {
+	UserID  string            `json:"user_id"`
+	History []UserHistoryResp `json:"history"`
+}
+
+func NewGetUserHistoryResp(userID int64, entities []storage.UserHistoryTable) *GetUserHistoryResp {
+	resp := &GetUserHistoryResp{
+		UserID:  strconv.FormatInt(userID, 10),
+		History: make([]UserHistoryResp, 0, len(entities)),
+	}
+	for _, h := range entities {
+		item := UserHistoryResp{
+			ID:        strconv.FormatInt(h.ID, 10),
+			Action:    h.Action,
+			Version:   h.Version,
+			After:     json.RawMessage(h.After),
+			Updater:   strconv.FormatInt(h.Updater, 10),
+			CreatedAt: h.CreatedAt,
+		}
+		if h.Before != "" {
+			item.Before = json.RawMessage(h.Before)
+		}
+		resp.History = append(resp.History, item)
+	}
+
+	return resp
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/service"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+)
+
+// ApiError is an error of the catalogue. Code is stable and meant for
+// clients to branch on, Message may change.
+type ApiError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *ApiError) Error() string {
+	return e.Code + " : " + e.Message
+}
+
+var (
+	ErrBadRequest         = &ApiError{http.StatusBadRequest, "BAD_REQUEST", "malformed request"}
+	ErrValidation         = &ApiError{http.StatusBadRequest, "VALIDATION_FAILED", "request validation failed"}
+	ErrInvalidUserID      = &ApiError{http.StatusBadRequest, "INVALID_USER_ID", "invalid user id"}
+	ErrUnauthorized       = &ApiError{http.StatusUnauthorized, "UNAUTHORIZED", "invalid authorization"}
+	ErrInvalidCredentials = &ApiError{http.StatusUnauthorized, "INVALID_CREDENTIALS", "account or password incorrect"}
+	ErrForbidden          = &ApiError{http.StatusForbidden, "FORBIDDEN", "forbidden"}
+	ErrNotFound           = &ApiError{http.StatusNotFound, "NOT_FOUND", "resource not found"}
+	ErrUserNotFound       = &ApiError{http.StatusNotFound, "USER_NOT_FOUND", "user not found"}
+	ErrConflict           = &ApiError{http.StatusConflict, "CONFLICT", "resource was changed concurrently"}
+	ErrAccountExists      = &ApiError{http.StatusConflict, "ACCOUNT_EXISTS", "account already exist"}
+	ErrTooManyRequests    = &ApiError{http.StatusTooManyRequests, "RATE_LIMITED", "too many requests"}
+	ErrInternal           = &ApiError{http.StatusInternalServerError, "INTERNAL", "internal server error"}
+	ErrUnavailable        = &ApiError{http.StatusServiceUnavailable, "UNAVAILABLE", "service unavailable, retry later"}
+
+	// Errors lists the catalogue, codes must not be reused.
+	Errors = []*ApiError{
+		ErrBadRequest, ErrValidation, ErrInvalidUserID,
+		ErrUnauthorized, ErrInvalidCredentials, ErrForbidden,
+		ErrNotFound, ErrUserNotFound, ErrConflict, ErrAccountExists,
+		ErrTooManyRequests, ErrInternal, ErrUnavailable,
+	}
+)
+
+// writeResult writes a successful response.
+func writeResult(c *gin.Context, status int, result interface{}) {
+	c.JSON(status, BaseResponse{Result: result})
+}
+
+// writeError aborts the request with the envelope of err. Errors outside the
+// catalogue are logged and answered with ErrInternal, or the catalogue error
+// of a storage error, so their text never reaches the client.
+func writeError(c *gin.Context, err error) {
+	body := &ErrorBody{RequestID: c.GetString(CTX_REQUEST_ID)}
+	lang := c.GetString(CTX_LOCALE)
+	var apiErr *ApiError
+	var validationErrs validator.ValidationErrors
+	switch {
+	case errors.As(err, &apiErr):
+	case errors.As(err, &validationErrs):
+		apiErr = ErrValidation
+		trans := validationTranslator(lang)
+		for _, fe := range validationErrs {
+			body.Details = append(body.Details, FieldError{
+				Field:   fe.Field(),
+				Rule:    fe.Tag(),
+				Param:   fe.Param(),
+				Message: fe.Translate(trans),
+			})
+		}
+	default:
+		if apiErr = serviceError(err); apiErr != nil {
+			break
+		}
+		apiErr = storageError(err)
+		slog.Error("api request fail", "request_id", body.RequestID, "path", c.FullPath(), "code", apiErr.Code, "error", err)
+	}
+	body.Code = apiErr.Code
+	body.Message = apiErr.Message
+	if v, ok := c.Get(ctxMessages); ok {
+		messages := v.(*Messages)
+		if message := messages.Message(lang, apiErr.Code); message != "" {
+			body.Message = message
+		}
+	}
+
+	c.AbortWithStatusJSON(apiErr.Status, BaseResponse{Error: body})
+}
+
+// serviceError returns the catalogue error of a service error, nil for
+// other errors.
+func serviceError(err error) *ApiError {
+	switch {
+	case errors.Is(err, service.ErrAccountExists):
+		return ErrAccountExists
+	case errors.Is(err, service.ErrInvalidCredentials):
+		return ErrInvalidCredentials
+	case errors.Is(err, service.ErrInvalidToken):
+		return ErrUnauthorized
+	case errors.Is(err, service.ErrUserNotFound):
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// storageError returns the catalogue error of a storage error.
+func storageError(err error) *ApiError {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return ErrNotFound
+	case errors.Is(err, storage.ErrConflict):
+		return ErrConflict
+	case errors.Is(err, storage.ErrUnavailable), errors.Is(err, storage.ErrDeadlock):
+		return ErrUnavailable
+	}
+
+	return ErrInternal
+}
+
+// bindJSON binds the body to req, writing the error when it fails.
+func bindJSON(c *gin.Context, req interface{}) bool {
+	err := c.ShouldBindJSON(req)
+	if err == nil {
+		return true
+	}
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		writeError(c, err)
+		return false
+	}
+	writeError(c, ErrBadRequest)
+
+	return false
+}
@@ -3,19 +3,70 @@ package api
 import (
 	"net/http"
 	"strconv"
-	"time"
+	"sync/atomic"
 
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/health"
+	"github.com/reddtsai/goAPI/pkg/blockaction/service"
 )
 
 type BlockActionApi struct {
 	*gin.Engine
-	opts BlockActionApiOptions
+	opts    BlockActionApiOptions
+	runtime atomic.Pointer[RuntimeOptions]
+	openapi *openapi3.T
 }
 
 func (b *BlockActionApi) Health(c *gin.Context) {
-	c.Status(http.StatusOK)
+	b.Livez(c)
+}
+
+func (b *BlockActionApi) Livez(c *gin.Context) {
+	writeHealthReport(c, b.opts.health.Live(c.Request.Context()).Redacted())
+}
+
+func (b *BlockActionApi) Readyz(c *gin.Context) {
+	writeHealthReport(c, b.opts.health.Ready(c.Request.Context()).Redacted())
+}
+
+// PrivateLivez is Livez with the check errors, served on the private group.
+func (b *BlockActionApi) PrivateLivez(c *gin.Context) {
+	writeHealthReport(c, b.opts.health.Live(c.Request.Context()))
+}
+
+// PrivateReadyz is Readyz with the check errors, served on the private group.
+func (b *BlockActionApi) PrivateReadyz(c *gin.Context) {
+	writeHealthReport(c, b.opts.health.Ready(c.Request.Context()))
+}
+
+// @Summary 驗證 token 的公鑰
+// @Description 其他服務以此 JSON Web Key Set 驗證 token, 未設定簽章金鑰時為空
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} auth.JWKS "ok"
+// @Router /.well-known/jwks.json [get]
+func (b *BlockActionApi) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", JWKS_CACHE_CONTROL)
+	c.JSON(http.StatusOK, b.opts.service.JWKS())
+}
+
+func (b *BlockActionApi) ConfigVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, b.opts.configVersion())
+}
+
+func writeHealthReport(c *gin.Context, report health.Report) {
+	code := http.StatusOK
+	if !report.OK() {
+		code = http.StatusServiceUnavailable
+	}
+	if verbose, _ := strconv.ParseBool(c.Query("verbose")); verbose {
+		c.JSON(code, report)
+		return
+	}
+
+	c.String(code, report.Status)
 }
 
 // @Summary 會員註冊
@@ -25,43 +76,30 @@ func (b *BlockActionApi) Health(c *gin.Context) {
 // @Produce json
 // @Param Request body SignupReq true "raw"
 // @Success 200 {object} BaseResponse{result=SignupResp} "ok"
-// @Failure 400 {object} BaseResponse "bad request"
-// @Failure 403 {object} BaseResponse "forbidden"
-// @Failure 409 {object} BaseResponse "conflict"
-// @Failure 500 {object} BaseResponse "server error"
+// @Failure 400 {object} BaseResponse "BAD_REQUEST, VALIDATION_FAILED"
+// @Failure 403 {object} BaseResponse "FORBIDDEN"
+// @Failure 409 {object} BaseResponse "ACCOUNT_EXISTS"
+// @Failure 429 {object} BaseResponse "RATE_LIMITED"
+// @Failure 500 {object} BaseResponse "INTERNAL"
+// @Failure 503 {object} BaseResponse "UNAVAILABLE"
 // @Router /v1/signup [post]
 func (b *BlockActionApi) Signup(c *gin.Context) {
 	req := SignupReq{}
-	err := c.ShouldBindJSON(&req)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
-	entity, err := req.ToEntity()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	exist, err := b.opts.storage.IsExistUserAccount(req.Account)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	if exist {
-		c.JSON(http.StatusConflict, gin.H{"error": "account already exist"})
-		return
-	}
-	err = b.opts.storage.CreateUser(entity)
+	u, err := b.opts.service.Signup(c.Request.Context(), service.SignupInput{
+		Account:  req.Account,
+		Password: req.Password,
+		UserName: req.UserName,
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"code": "0",
-		"result": SignupResp{
-			Account: entity.Account,
-		},
+	writeResult(c, http.StatusOK, SignupResp{
+		Account: u.Account,
 	})
 }
 
@@ -72,67 +110,58 @@ func (b *BlockActionApi) Signup(c *gin.Context) {
 // @Produce json
 // @Param Request body SigninReq true "raw"
 // @Success 200 {object} BaseResponse{result=SigninResp} "ok"
-// @Failure 400 {object} BaseResponse{error=string} "bad request"
-// @Failure 403 {object} BaseResponse{error=string} "forbidden"
-// @Failure 500 {object} BaseResponse{error=string} "server error"
+// @Failure 400 {object} BaseResponse "BAD_REQUEST, VALIDATION_FAILED"
+// @Failure 401 {object} BaseResponse "INVALID_CREDENTIALS"
+// @Failure 403 {object} BaseResponse "FORBIDDEN"
+// @Failure 429 {object} BaseResponse "RATE_LIMITED"
+// @Failure 500 {object} BaseResponse "INTERNAL"
+// @Failure 503 {object} BaseResponse "UNAVAILABLE"
 // @Router /v1/signin [post]
 func (b *BlockActionApi) Signin(c *gin.Context) {
 	req := &SigninReq{}
-	err := c.ShouldBindJSON(req)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	u, err := b.opts.storage.GetUserByAccount(req.Account)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	if u.ID == 0 {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "account or password incorrect"})
+	if !bindJSON(c, req) {
 		return
 	}
-	ok, err := validatePwd(req.Password, u.Secret)
+	tokens, err := b.opts.service.Signin(c.Request.Context(), req.Account, req.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "account or password incorrect"})
+		writeError(c, err)
 		return
 	}
 
-	expiresTime := time.Duration(TOKEN_EXPIRE_TIME)
-	token, err := genToken(&UserClaims{
-		ID:      u.ID,
-		Account: u.Account,
-		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    "blockaction",
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresTime * time.Second)),
-		},
+	writeResult(c, http.StatusOK, &SigninResp{
+		Token:        tokens.Token,
+		RefreshToken: tokens.RefreshToken,
 	})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// @Summary 更新 token
+// @Description 以 refresh token 換發新的 token 與 refresh token
+// @Tags BlockAction
+// @Accept json
+// @Produce json
+// @Param Request body RefreshTokenReq true "raw"
+// @Success 200 {object} BaseResponse{result=SigninResp} "ok"
+// @Failure 400 {object} BaseResponse "BAD_REQUEST, VALIDATION_FAILED"
+// @Failure 401 {object} BaseResponse "UNAUTHORIZED"
+// @Failure 403 {object} BaseResponse "FORBIDDEN"
+// @Failure 429 {object} BaseResponse "RATE_LIMITED"
+// @Failure 500 {object} BaseResponse "INTERNAL"
+// @Failure 503 {object} BaseResponse "UNAVAILABLE"
+// @Router /v1/token/refresh [post]
+func (b *BlockActionApi) RefreshToken(c *gin.Context) {
+	req := &RefreshTokenReq{}
+	if !bindJSON(c, req) {
 		return
 	}
-	reToken, err := genToken(&UserClaims{
-		ID: u.ID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:   "blockaction",
-			IssuedAt: jwt.NewNumericDate(time.Now()),
-		},
-	})
+	tokens, err := b.opts.service.Refresh(c.Request.Context(), req.RefreshToken)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"result": &SigninResp{
-			Token:        token,
-			RefreshToken: reToken,
-		},
+	writeResult(c, http.StatusOK, &SigninResp{
+		Token:        tokens.Token,
+		RefreshToken: tokens.RefreshToken,
 	})
 }
 
@@ -141,28 +170,54 @@ func (b *BlockActionApi) Signin(c *gin.Context) {
 // @Tags BlockAction
 // @Accept json
 // @Produce json
+// @Security BearerAuth
 // @Success 200 {object} BaseResponse{result=GetPersonalInfoResp} "ok"
-// @Failure 401 {object} BaseResponse "unauthorized"
-// @Failure 403 {object} BaseResponse "forbidden"
-// @Failure 500 {object} BaseResponse "server error"
+// @Failure 401 {object} BaseResponse "UNAUTHORIZED"
+// @Failure 403 {object} BaseResponse "FORBIDDEN"
+// @Failure 404 {object} BaseResponse "USER_NOT_FOUND"
+// @Failure 429 {object} BaseResponse "RATE_LIMITED"
+// @Failure 500 {object} BaseResponse "INTERNAL"
+// @Failure 503 {object} BaseResponse "UNAVAILABLE"
 // @Router /v1/user/personal-info [get]
 func (b *BlockActionApi) GetPersonalInfo(c *gin.Context) {
 	userID := c.GetInt64(CTX_USER_ID)
-	u, err := b.opts.storage.GetUser(userID)
+	u, err := b.opts.service.GetUser(c.Request.Context(), userID)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	writeResult(c, http.StatusOK, &GetPersonalInfoResp{
+		ID:       strconv.FormatInt(u.ID, 10),
+		Account:  u.Account,
+		UserName: u.Name,
+	})
+}
+
+// @Summary 會員異動紀錄
+// @Description 會員異動紀錄, 含已刪除的會員, 需 admin mTLS 憑證
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path string true "user id"
+// @Success 200 {object} BaseResponse{result=GetUserHistoryResp} "ok"
+// @Failure 400 {object} BaseResponse "INVALID_USER_ID"
+// @Failure 403 {object} BaseResponse "FORBIDDEN"
+// @Failure 429 {object} BaseResponse "RATE_LIMITED"
+// @Failure 500 {object} BaseResponse "INTERNAL"
+// @Failure 503 {object} BaseResponse "UNAVAILABLE"
+// @Router /v1/admin/users/{id}/history [get]
+func (b *BlockActionApi) GetUserHistory(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, ErrInvalidUserID)
 		return
 	}
-	if u.ID == 0 {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "account or password incorrect"})
+	history, err := b.opts.service.GetUserHistory(c.Request.Context(), userID)
+	if err != nil {
+		writeError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"result": &GetPersonalInfoResp{
-			ID:       strconv.FormatInt(u.ID, 10),
-			Account:  u.Account,
-			UserName: u.Name,
-		},
-	})
+	writeResult(c, http.StatusOK, NewGetUserHistoryResp(userID, history))
 }
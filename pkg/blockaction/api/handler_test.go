@@ -2,22 +2,46 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 
+	"github.com/reddtsai/goAPI/pkg/blockaction/auth"
+	"github.com/reddtsai/goAPI/pkg/blockaction/health"
+	"github.com/reddtsai/goAPI/pkg/blockaction/service"
 	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
 	"github.com/reddtsai/goAPI/pkg/blockaction/storage/mock"
 )
 
+const (
+	testSecret = "test-secret"
+	testID     = 1234
+)
+
+// fixedID generates testID for every user and request.
+type fixedID struct{}
+
+func (fixedID) Generate() int64 {
+	return testID
+}
+
 type TestBlockActionApi struct {
 	suite.Suite
 	ctrl        *gomock.Controller
@@ -33,7 +57,7 @@ func TestBlockActionApiSuite(t *testing.T) {
 func (t *TestBlockActionApi) SetupSuite() {
 	t.ctrl = gomock.NewController(t.T())
 	t.mockStorage = mock.NewMockIStorage(t.ctrl)
-	api, err := NewBlockActionApi(SetStorage(t.mockStorage))
+	api, err := NewBlockActionApi(SetStorage(t.mockStorage), SetSecret(testSecret), SetIDGenerator(fixedID{}))
 	if err != nil {
 		t.FailNow(err.Error())
 	}
@@ -50,11 +74,19 @@ func (t *TestBlockActionApi) Test_Signup_200() {
 	w := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodPost, "/v1/signup", bytes.NewReader(body))
 
-	t.mockStorage.EXPECT().IsExistUserAccount(payload.Account).Return(false, nil)
-	t.mockStorage.EXPECT().CreateUser(gomock.Any()).Return(nil)
+	t.mockStorage.EXPECT().CreateUser(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, entity storage.UserTable) error {
+		assert.Equal(t.T(), int64(testID), entity.ID)
+		return nil
+	})
 
 	t.TestApi.ServeHTTP(w, req)
 	assert.Equal(t.T(), http.StatusOK, w.Code)
+	assert.Equal(t.T(), "1234", w.Header().Get("X-Request-ID"))
+}
+
+func (t *TestBlockActionApi) Test_NewBlockActionApi_NoIDGenerator() {
+	_, err := NewBlockActionApi(SetStorage(t.mockStorage), SetSecret(testSecret))
+	assert.EqualError(t.T(), err, "id generator is nil")
 }
 
 func (t *TestBlockActionApi) Test_Signup_400() {
@@ -69,6 +101,293 @@ func (t *TestBlockActionApi) Test_Signup_400() {
 
 	t.TestApi.ServeHTTP(w, req)
 	assert.Equal(t.T(), http.StatusBadRequest, w.Code)
+	resp := decodeError(t.T(), w)
+	assert.Equal(t.T(), ErrValidation.Code, resp.Code)
+	assert.Equal(t.T(), "1234", resp.RequestID)
+	assert.Equal(t.T(), []FieldError{{
+		Field:   "account",
+		Rule:    "min",
+		Param:   "6",
+		Message: "account must be at least 6 characters in length",
+	}}, resp.Details)
+}
+
+func (t *TestBlockActionApi) Test_Signup_400_ZhTW() {
+	payload := SignupReq{
+		Account:  "test",
+		Password: "abcd1234",
+		UserName: "testuser",
+	}
+	body, _ := json.Marshal(payload)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/signup", bytes.NewReader(body))
+	req.Header.Set("Accept-Language", "zh-TW,zh;q=0.9,en;q=0.8")
+
+	t.TestApi.ServeHTTP(w, req)
+	assert.Equal(t.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(t.T(), LANG_ZH_TW, w.Header().Get("Content-Language"))
+	resp := decodeError(t.T(), w)
+	assert.Equal(t.T(), ErrValidation.Code, resp.Code)
+	assert.Equal(t.T(), "請求參數驗證失敗", resp.Message)
+	assert.Len(t.T(), resp.Details, 1)
+	assert.Equal(t.T(), "account長度必須至少為6個字元", resp.Details[0].Message)
+}
+
+func (t *TestBlockActionApi) Test_Signup_500() {
+	payload := SignupReq{
+		Account:  "testuser",
+		Password: "abcd1234",
+		UserName: "testuser",
+	}
+	body, _ := json.Marshal(payload)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/signup", bytes.NewReader(body))
+
+	t.mockStorage.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Return(fmt.Errorf("dial tcp 10.0.0.7:3306: connect: connection refused"))
+
+	t.TestApi.ServeHTTP(w, req)
+	assert.Equal(t.T(), http.StatusInternalServerError, w.Code)
+	assert.NotContains(t.T(), w.Body.String(), "10.0.0.7")
+	assert.Equal(t.T(), ErrInternal.Code, decodeError(t.T(), w).Code)
+}
+
+func (t *TestBlockActionApi) Test_NoRoute_404() {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/nothing", nil)
+
+	t.TestApi.ServeHTTP(w, req)
+	assert.Equal(t.T(), http.StatusNotFound, w.Code)
+	assert.Equal(t.T(), ErrNotFound.Code, decodeError(t.T(), w).Code)
+}
+
+func TestErrorCodesUnique(t *testing.T) {
+	codes := make(map[string]bool)
+	for _, e := range Errors {
+		assert.False(t, codes[e.Code], e.Code)
+		codes[e.Code] = true
+	}
+}
+
+func TestMessages(t *testing.T) {
+	api, err := NewBlockActionApi(SetStorage(mock.NewMockIStorage(gomock.NewController(t))), SetSecret(testSecret), SetIDGenerator(fixedID{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := api.Messages()
+	assert.Equal(t, LANG_EN, messages.Negotiate(""))
+	assert.Equal(t, LANG_EN, messages.Negotiate("fr-FR,fr;q=0.9"))
+	assert.Equal(t, LANG_ZH_TW, messages.Negotiate("zh-Hant-TW"))
+	assert.Error(t, messages.Add("not a language!", nil))
+
+	// languages added while serving are negotiated
+	assert.NoError(t, messages.Add("ja", map[string]string{ErrNotFound.Code: "リソースが見つかりません"}))
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/nothing", nil)
+	req.Header.Set("Accept-Language", "ja-JP,en;q=0.5")
+	api.ServeHTTP(w, req)
+	assert.Equal(t, "ja", w.Header().Get("Content-Language"))
+	assert.Equal(t, "リソースが見つかりません", decodeError(t, w).Message)
+	// messages missing in a language fall back to English
+	assert.Equal(t, ErrConflict.Message, messages.Message("ja", ErrConflict.Code))
+}
+
+func TestVersions(t *testing.T) {
+	mockStorage := mock.NewMockIStorage(gomock.NewController(t))
+	deprecatedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	api, err := NewBlockActionApi(SetStorage(mockStorage), SetSecret(testSecret), SetIDGenerator(fixedID{}),
+		SetV1Deprecation(Deprecation{
+			DeprecatedAt: deprecatedAt,
+			SunsetAt:     deprecatedAt.AddDate(1, 0, 0),
+			Link:         "https://docs.example/v2",
+		}),
+		SetMetricsClients([]string{"TestVersions"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockStorage.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Return(nil).Times(3)
+	body, _ := json.Marshal(SignupReq{Account: "testuser", Password: "abcd1234", UserName: "testuser"})
+
+	// v2 shares the handler of v1 without the deprecation headers
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v2/signup", bytes.NewReader(body))
+	req.Header.Set("User-Agent", "TestVersions/2.0 (iOS 17)")
+	api.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Deprecation"))
+	assert.Empty(t, w.Header().Get("Sunset"))
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/v1/signup", bytes.NewReader(body))
+	req.Header.Set("User-Agent", "TestVersions/1.0 (iOS 17)")
+	api.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "@1767225600", w.Header().Get("Deprecation"))
+	assert.Equal(t, "Fri, 01 Jan 2027 00:00:00 GMT", w.Header().Get("Sunset"))
+	assert.Equal(t, `<https://docs.example/v2>; rel="deprecation"; type="text/html"`, w.Header().Get("Link"))
+
+	// unlisted products are not named
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/v2/signup", bytes.NewReader(body))
+	req.Header.Set("User-Agent", "Random-7f3a/1.0")
+	api.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_/metrics", nil))
+	assert.Contains(t, w.Body.String(), `api_router_version_requests_total{api_version="v1",client="TestVersions"} 1`)
+	assert.Contains(t, w.Body.String(), `api_router_version_requests_total{api_version="v2",client="TestVersions"} 1`)
+	assert.Contains(t, w.Body.String(), `api_router_version_requests_total{api_version="v2",client="other"}`)
+	assert.NotContains(t, w.Body.String(), "Random-7f3a")
+}
+
+// undocumentedRoutes are served outside the API versions.
+var undocumentedRoutes = map[string]bool{
+	"/health":           true,
+	"/livez":            true,
+	"/readyz":           true,
+	"/_/metrics":        true,
+	"/_/livez":          true,
+	"/_/readyz":         true,
+	"/_/config/version": true,
+	"/openapi.json":     true,
+	"/swagger/*any":     true,
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	api, err := NewBlockActionApi(SetStorage(mock.NewMockIStorage(gomock.NewController(t))), SetSecret(testSecret), SetIDGenerator(fixedID{}),
+		SetConfigVersion(func() interface{} { return nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range api.Routes() {
+		if undocumentedRoutes[route.Path] {
+			continue
+		}
+		// gin :id is {id} in the spec
+		segments := strings.Split(route.Path, "/")
+		for i, segment := range segments {
+			if name, ok := strings.CutPrefix(segment, ":"); ok {
+				segments[i] = "{" + name + "}"
+			}
+		}
+		path := strings.Join(segments, "/")
+		item := doc.Paths.Find(path)
+		if assert.NotNil(t, item, "%s is missing from the spec, annotate its handler and run make gen-docs", path) {
+			assert.NotNil(t, item.GetOperation(route.Method), "%s %s is missing from the spec", route.Method, path)
+		}
+	}
+}
+
+func TestOpenAPIDoc(t *testing.T) {
+	api, err := NewBlockActionApi(SetStorage(mock.NewMockIStorage(gomock.NewController(t))), SetSecret(testSecret), SetIDGenerator(fixedID{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	doc, err := openapi3.NewLoader().LoadFromData(w.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, OPENAPI_VERSION, doc.OpenAPI)
+	scheme := doc.Components.SecuritySchemes[SECURITY_BEARER].Value
+	assert.Equal(t, "http", scheme.Type)
+	assert.Equal(t, "bearer", scheme.Scheme)
+	for _, version := range []string{API_V1, API_V2} {
+		op := doc.Paths.Find("/" + version + "/user/personal-info").Get
+		assert.Equal(t, openapi3.SecurityRequirements{{SECURITY_BEARER: []string{}}}, *op.Security)
+		assert.Equal(t, version == API_V1, op.Deprecated)
+	}
+}
+
+func TestOpenAPIValidation(t *testing.T) {
+	mockStorage := mock.NewMockIStorage(gomock.NewController(t))
+	api, err := NewBlockActionApi(SetStorage(mockStorage), SetSecret(testSecret), SetIDGenerator(fixedID{}), SetOpenAPIValidation(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the body is still bound by the handler after validation
+	mockStorage.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Return(nil)
+	body, _ := json.Marshal(SignupReq{Account: "testuser", Password: "abcd1234", UserName: "testuser"})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v2/signup", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	api.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"result":{"account":"testuser"}}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/v1/signup", strings.NewReader(`{"account":1234}`))
+	req.Header.Set("Content-Type", "application/json")
+	api.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ErrValidation.Code, decodeError(t, w).Code)
+
+	// documented errors pass, routes outside the spec are not validated
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/user/personal-info", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, ErrUnauthorized.Code, decodeError(t, w).Code)
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestJWKS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, err := service.New(service.SetStorage(mock.NewMockIStorage(gomock.NewController(t))), service.SetSecret(testSecret),
+		service.SetIDGenerator(fixedID{}), service.SetSigningKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := NewBlockActionApi(SetService(svc), SetOpenAPIValidation(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, auth.JWKS_PATH, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, JWKS_CACHE_CONTROL, w.Header().Get("Cache-Control"))
+	var jwks auth.JWKS
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &jwks))
+	assert.Equal(t, svc.JWKS(), jwks)
+	assert.Contains(t, jwks.KeySet(), jwks.Keys[0].Kid)
+}
+
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) ErrorBody {
+	var resp BaseResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Nil(t, resp.Result)
+	if resp.Error == nil {
+		t.Fatalf("no error in %s", w.Body.String())
+	}
+	return *resp.Error
+}
+
+func (t *TestBlockActionApi) Test_Panic_500() {
+	api, err := NewBlockActionApi(SetStorage(t.mockStorage), SetSecret(testSecret), SetIDGenerator(fixedID{}))
+	assert.Nil(t.T(), err)
+	api.Engine.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	assert.Equal(t.T(), http.StatusInternalServerError, w.Code)
+	body := decodeError(t.T(), w)
+	assert.Equal(t.T(), ErrInternal.Code, body.Code)
+	assert.NotEmpty(t.T(), body.RequestID)
+	assert.Equal(t.T(), w.Header().Get("X-Request-ID"), body.RequestID)
+	assert.NotContains(t.T(), w.Body.String(), "boom")
 }
 
 func (t *TestBlockActionApi) Test_Signup_409() {
@@ -81,7 +400,7 @@ func (t *TestBlockActionApi) Test_Signup_409() {
 	w := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodPost, "/v1/signup", bytes.NewReader(body))
 
-	t.mockStorage.EXPECT().IsExistUserAccount(payload.Account).Return(true, nil)
+	t.mockStorage.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Return(storage.ErrConflict)
 
 	t.TestApi.ServeHTTP(w, req)
 	assert.Equal(t.T(), http.StatusConflict, w.Code)
@@ -96,13 +415,14 @@ func (t *TestBlockActionApi) Test_Signin_200() {
 	w := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodPost, "/v1/signin", bytes.NewReader(body))
 
-	s, err := signaturePwd(payload.Password)
+	s, err := service.SignPassword(payload.Password, []byte(testSecret))
 	assert.Nil(t.T(), err)
-	t.mockStorage.EXPECT().GetUserByAccount(payload.Account).Return(storage.UserTable{
+	t.mockStorage.EXPECT().GetUserByAccount(gomock.Any(), payload.Account).Return(storage.UserTable{
 		ID:      1,
 		Account: "testuser",
 		Secret:  s,
 	}, nil)
+	t.mockStorage.EXPECT().CreateRefreshToken(gomock.Any(), gomock.Any()).Return(nil)
 
 	t.TestApi.ServeHTTP(w, req)
 	assert.Equal(t.T(), http.StatusOK, w.Code)
@@ -129,16 +449,76 @@ func (t *TestBlockActionApi) Test_Signin_401() {
 	w := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodPost, "/v1/signin", bytes.NewReader(body))
 
-	t.mockStorage.EXPECT().GetUserByAccount(payload.Account).Return(storage.UserTable{}, nil)
+	t.mockStorage.EXPECT().GetUserByAccount(gomock.Any(), payload.Account).Return(storage.UserTable{}, storage.ErrNotFound)
 
 	t.TestApi.ServeHTTP(w, req)
 	assert.Equal(t.T(), http.StatusUnauthorized, w.Code)
+	assert.Equal(t.T(), ErrInvalidCredentials.Code, decodeError(t.T(), w).Code)
+}
+
+func (t *TestBlockActionApi) Test_RefreshToken_401() {
+	token, err := service.SignToken(&UserClaims{
+		ID:      1,
+		Account: "testuser",
+	}, []byte(testSecret))
+	assert.Nil(t.T(), err)
+	body, _ := json.Marshal(RefreshTokenReq{RefreshToken: token})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/token/refresh", bytes.NewReader(body))
+
+	// an access token is not a refresh token
+	t.TestApi.ServeHTTP(w, req)
+	assert.Equal(t.T(), http.StatusUnauthorized, w.Code)
+	assert.Equal(t.T(), ErrUnauthorized.Code, decodeError(t.T(), w).Code)
+
+	// nor is an expired one, or one superseded by a later refresh
+	now := time.Now()
+	refreshToken := func(issuedAt, expiresAt time.Time) string {
+		claims := &UserClaims{
+			ID:      1,
+			Account: "testuser",
+			Use:     service.TOKEN_USE_REFRESH,
+			Family:  "1",
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        "2",
+				Issuer:    service.TOKEN_ISSUER,
+				IssuedAt:  jwt.NewNumericDate(issuedAt),
+				ExpiresAt: jwt.NewNumericDate(expiresAt),
+			},
+		}
+		token, err := service.SignToken(claims, []byte(testSecret))
+		assert.Nil(t.T(), err)
+		return token
+	}
+	t.mockStorage.EXPECT().RotateRefreshToken(gomock.Any(), "2", gomock.Any()).Return(storage.ErrNotFound)
+	for _, token := range []string{refreshToken(now.Add(-time.Hour), now.Add(-time.Minute)), refreshToken(now, now.Add(time.Hour))} {
+		body, _ := json.Marshal(RefreshTokenReq{RefreshToken: token})
+		w := httptest.NewRecorder()
+		t.TestApi.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/token/refresh", bytes.NewReader(body)))
+		assert.Equal(t.T(), http.StatusUnauthorized, w.Code)
+		assert.Equal(t.T(), ErrUnauthorized.Code, decodeError(t.T(), w).Code)
+	}
+}
+
+func (t *TestBlockActionApi) Test_Signin_503() {
+	payload := SigninReq{
+		Account:  "testuser",
+		Password: "abcd1234",
+	}
+	body, _ := json.Marshal(payload)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/signin", bytes.NewReader(body))
+
+	t.mockStorage.EXPECT().GetUserByAccount(gomock.Any(), payload.Account).Return(storage.UserTable{}, storage.ErrUnavailable)
+
+	t.TestApi.ServeHTTP(w, req)
+	assert.Equal(t.T(), http.StatusServiceUnavailable, w.Code)
 }
 
 func (t *TestBlockActionApi) Test_GetPersonalInfo_200() {
 	w := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/v1/user/personal-info", nil)
-	token, err := genToken(&UserClaims{
+	token, err := service.SignToken(&UserClaims{
 		ID:      1,
 		Account: "testuser",
 		RegisteredClaims: jwt.RegisteredClaims{
@@ -146,12 +526,12 @@ func (t *TestBlockActionApi) Test_GetPersonalInfo_200() {
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(600 * time.Second)),
 		},
-	})
+	}, []byte(testSecret))
 	assert.Nil(t.T(), err)
 	bearer := fmt.Sprintf("Bearer %s", token)
 	req.Header.Set("Authorization", bearer)
 
-	t.mockStorage.EXPECT().GetUser(gomock.Any()).Return(storage.UserTable{
+	t.mockStorage.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(storage.UserTable{
 		ID:      1,
 		Account: "testuser",
 		Name:    "testuser",
@@ -161,6 +541,26 @@ func (t *TestBlockActionApi) Test_GetPersonalInfo_200() {
 	assert.Equal(t.T(), http.StatusOK, w.Code)
 }
 
+func (t *TestBlockActionApi) Test_GetPersonalInfo_404() {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/user/personal-info", nil)
+	token, err := service.SignToken(&UserClaims{
+		ID:      2,
+		Account: "gone",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    service.TOKEN_ISSUER,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(600 * time.Second)),
+		},
+	}, []byte(testSecret))
+	assert.Nil(t.T(), err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	t.mockStorage.EXPECT().GetUser(gomock.Any(), int64(2)).Return(storage.UserTable{}, storage.ErrNotFound)
+
+	t.TestApi.ServeHTTP(w, req)
+	assert.Equal(t.T(), http.StatusNotFound, w.Code)
+}
+
 func (t *TestBlockActionApi) Test_GetPersonalInfo_401() {
 	w := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/v1/user/personal-info", nil)
@@ -168,3 +568,202 @@ func (t *TestBlockActionApi) Test_GetPersonalInfo_401() {
 	t.TestApi.ServeHTTP(w, req)
 	assert.Equal(t.T(), http.StatusUnauthorized, w.Code)
 }
+
+func (t *TestBlockActionApi) Test_Readyz_200() {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/readyz?verbose=true", nil)
+
+	t.TestApi.ServeHTTP(w, req)
+	assert.Equal(t.T(), http.StatusOK, w.Code)
+	assert.Contains(t.T(), w.Body.String(), `"status":"ok"`)
+}
+
+func TestReadyzRedacted(t *testing.T) {
+	hc := health.New()
+	hc.AddReadinessCheck("mysql", health.CheckerFunc(func(ctx context.Context) error {
+		return fmt.Errorf("dial tcp 10.0.0.7:3306: connect: connection refused")
+	}))
+	api, err := NewBlockActionApi(SetStorage(mock.NewMockIStorage(gomock.NewController(t))), SetSecret(testSecret), SetIDGenerator(fixedID{}), SetHealth(hc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz?verbose=true", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"fail"`)
+	assert.NotContains(t, w.Body.String(), "10.0.0.7")
+
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_/readyz?verbose=true", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "10.0.0.7")
+}
+
+func (t *TestBlockActionApi) Test_GetPersonalInfo_ClientCert_200() {
+	api, err := NewBlockActionApi(SetStorage(t.mockStorage), SetSecret(testSecret), SetIDGenerator(fixedID{}), SetTrustedClients([]string{"billing.internal"}))
+	assert.Nil(t.T(), err)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/user/personal-info", nil)
+	req.Header.Set("X-User-ID", "1")
+	req.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{DNSNames: []string{"billing.internal"}}}},
+	}
+
+	t.mockStorage.EXPECT().GetUser(gomock.Any(), int64(1)).Return(storage.UserTable{
+		ID:      1,
+		Account: "testuser",
+		Name:    "testuser",
+	}, nil)
+
+	api.ServeHTTP(w, req)
+	assert.Equal(t.T(), http.StatusOK, w.Code)
+}
+
+func (t *TestBlockActionApi) Test_GetPersonalInfo_ClientCert_401() {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/user/personal-info", nil)
+	req.Header.Set("X-User-ID", "1")
+	req.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{DNSNames: []string{"billing.internal"}}}},
+	}
+
+	t.TestApi.ServeHTTP(w, req)
+	assert.Equal(t.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (t *TestBlockActionApi) Test_RateLimit_429() {
+	api, err := NewBlockActionApi(SetStorage(t.mockStorage), SetSecret(testSecret), SetIDGenerator(fixedID{}), SetRateLimit(1, 1))
+	assert.Nil(t.T(), err)
+	do := func() int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/signin", bytes.NewReader([]byte("{}")))
+		api.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t.T(), http.StatusBadRequest, do())
+	assert.Equal(t.T(), http.StatusTooManyRequests, do())
+
+	err = api.Reload(RuntimeOptions{AllowOrigins: []string{"*"}, TokenTTL: time.Minute})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), http.StatusBadRequest, do())
+}
+
+func (t *TestBlockActionApi) Test_RateLimit_XForwardedFor() {
+	do := func(api *BlockActionApi, clientIP string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/signin", bytes.NewReader([]byte("{}")))
+		req.Header.Set("X-Forwarded-For", clientIP)
+		api.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// a spoofed X-Forwarded-For does not get a new bucket
+	api, err := NewBlockActionApi(SetStorage(t.mockStorage), SetSecret(testSecret), SetIDGenerator(fixedID{}), SetRateLimit(1, 1))
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), http.StatusBadRequest, do(api, "203.0.113.1"))
+	assert.Equal(t.T(), http.StatusTooManyRequests, do(api, "203.0.113.2"))
+
+	// behind a trusted proxy it is the client IP
+	api, err = NewBlockActionApi(SetStorage(t.mockStorage), SetSecret(testSecret), SetIDGenerator(fixedID{}), SetRateLimit(1, 1),
+		SetTrustedProxies([]string{"192.0.2.0/24"}))
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), http.StatusBadRequest, do(api, "203.0.113.1"))
+	assert.Equal(t.T(), http.StatusBadRequest, do(api, "203.0.113.2"))
+	assert.Equal(t.T(), http.StatusTooManyRequests, do(api, "203.0.113.1"))
+
+	_, err = NewBlockActionApi(SetStorage(t.mockStorage), SetSecret(testSecret), SetIDGenerator(fixedID{}), SetTrustedProxies([]string{"proxy"}))
+	assert.NotNil(t.T(), err)
+}
+
+func (t *TestBlockActionApi) Test_Reload_AllowOrigins() {
+	api, err := NewBlockActionApi(SetStorage(t.mockStorage), SetSecret(testSecret), SetIDGenerator(fixedID{}))
+	assert.Nil(t.T(), err)
+	preflight := func(origin string) http.Header {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodOptions, "/v1/signin", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		api.ServeHTTP(w, req)
+		return w.Header()
+	}
+
+	// * is answered as is, never echoing the origin
+	assert.Equal(t.T(), "*", preflight("https://app.example").Get("Access-Control-Allow-Origin"))
+	err = api.Reload(RuntimeOptions{AllowOrigins: []string{"https://other.example", "https://*.app.example"}, TokenTTL: time.Minute})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "", preflight("https://app.example").Get("Access-Control-Allow-Origin"))
+	assert.Equal(t.T(), "https://other.example", preflight("https://other.example").Get("Access-Control-Allow-Origin"))
+	assert.Equal(t.T(), "https://eu.app.example", preflight("https://eu.app.example").Get("Access-Control-Allow-Origin"))
+	assert.Equal(t.T(), "", preflight("https://eu.app.example.evil").Get("Access-Control-Allow-Origin"))
+	assert.Equal(t.T(), "", preflight("http://eu.app.example").Get("Access-Control-Allow-Origin"))
+	assert.NotNil(t.T(), api.Reload(RuntimeOptions{TokenTTL: time.Minute}))
+
+	// credentials are never sent for any origin
+	_, err = NewBlockActionApi(SetStorage(t.mockStorage), SetSecret(testSecret), SetIDGenerator(fixedID{}), SetAllowCredentials(true))
+	assert.NotNil(t.T(), err)
+	api, err = NewBlockActionApi(SetStorage(t.mockStorage), SetSecret(testSecret), SetIDGenerator(fixedID{}),
+		SetAllowOrigins([]string{"https://app.example"}), SetAllowCredentials(true))
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "true", preflight("https://app.example").Get("Access-Control-Allow-Credentials"))
+	assert.NotNil(t.T(), api.Reload(RuntimeOptions{AllowOrigins: []string{"*"}, TokenTTL: time.Minute}))
+}
+
+func (t *TestBlockActionApi) Test_Signin_RequestContext() {
+	payload := SigninReq{
+		Account:  "testuser",
+		Password: "abcd1234",
+	}
+	body, _ := json.Marshal(payload)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/signin", bytes.NewReader(body)).WithContext(ctx)
+
+	t.mockStorage.EXPECT().GetUserByAccount(gomock.Any(), payload.Account).DoAndReturn(
+		func(ctx context.Context, account string) (storage.UserTable, error) {
+			return storage.UserTable{}, ctx.Err()
+		})
+
+	t.TestApi.ServeHTTP(w, req)
+	assert.Equal(t.T(), http.StatusInternalServerError, w.Code)
+}
+
+func (t *TestBlockActionApi) Test_GetUserHistory_200() {
+	api, err := NewBlockActionApi(SetStorage(t.mockStorage), SetSecret(testSecret), SetIDGenerator(fixedID{}), SetAdminClients([]string{"ops.internal"}))
+	assert.Nil(t.T(), err)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/admin/users/1/history", nil)
+	req.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{DNSNames: []string{"ops.internal"}}}},
+	}
+
+	t.mockStorage.EXPECT().GetUserHistory(gomock.Any(), int64(1)).Return([]storage.UserHistoryTable{
+		{ID: 1, UserID: 1, Action: storage.HISTORY_ACTION_CREATE, Version: 1, After: `{"name":"a"}`, Updater: 1},
+		{ID: 2, UserID: 1, Action: storage.HISTORY_ACTION_UPDATE, Version: 2, Before: `{"name":"a"}`, After: `{"name":"b"}`, Updater: 2},
+	}, nil)
+
+	api.ServeHTTP(w, req)
+	assert.Equal(t.T(), http.StatusOK, w.Code)
+	var resp struct {
+		Result GetUserHistoryResp `json:"result"`
+	}
+	assert.Nil(t.T(), json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t.T(), "1", resp.Result.UserID)
+	assert.Len(t.T(), resp.Result.History, 2)
+	assert.Empty(t.T(), resp.Result.History[0].Before)
+	assert.JSONEq(t.T(), `{"name":"b"}`, string(resp.Result.History[1].After))
+	assert.Equal(t.T(), "2", resp.Result.History[1].Updater)
+}
+
+func (t *TestBlockActionApi) Test_GetUserHistory_403() {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/admin/users/1/history", nil)
+	req.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{DNSNames: []string{"billing.internal"}}}},
+	}
+
+	t.TestApi.ServeHTTP(w, req)
+	assert.Equal(t.T(), http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/zh_Hant_TW"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	zh_tw_translations "github.com/go-playground/validator/v10/translations/zh_tw"
+	"golang.org/x/text/language"
+)
+
+const (
+	LANG_EN    = "en"
+	LANG_ZH_TW = "zh-TW"
+	CTX_LOCALE = "c_locale"
+
+	ctxMessages = "c_messages"
+)
+
+var (
+	_translators *ut.UniversalTranslator
+	// validator 翻譯對應的 locale
+	_validationLocales = map[string]string{
+		LANG_EN:    "en",
+		LANG_ZH_TW: "zh_Hant_TW",
+	}
+	_zhTWMessages = map[string]string{
+		ErrBadRequest.Code:         "請求格式錯誤",
+		ErrValidation.Code:         "請求參數驗證失敗",
+		ErrInvalidUserID.Code:      "會員 ID 格式錯誤",
+		ErrUnauthorized.Code:       "授權無效",
+		ErrInvalidCredentials.Code: "帳號或密碼錯誤",
+		ErrForbidden.Code:          "沒有權限",
+		ErrNotFound.Code:           "找不到資源",
+		ErrUserNotFound.Code:       "找不到會員",
+		ErrConflict.Code:           "資料已被同時修改",
+		ErrAccountExists.Code:      "帳號已存在",
+		ErrTooManyRequests.Code:    "請求過於頻繁",
+		ErrInternal.Code:           "伺服器內部錯誤",
+		ErrUnavailable.Code:        "服務暫時無法使用, 請稍後再試",
+	}
+)
+
+func init() {
+	_translators = ut.New(en.New(), en.New(), zh_Hant_TW.New())
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	// validation details name fields as they are in the request
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			return f.Name
+		}
+		return name
+	})
+	enTrans, _ := _translators.GetTranslator("en")
+	zhTrans, _ := _translators.GetTranslator("zh_Hant_TW")
+	err := en_translations.RegisterDefaultTranslations(v, enTrans)
+	if err == nil {
+		err = zh_tw_translations.RegisterDefaultTranslations(v, zhTrans)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Messages holds the catalogue messages of every language by error code,
+// safe for concurrent use. Languages and messages can be added while
+// serving, a message missing in a language falls back to English.
+type Messages struct {
+	mu      sync.RWMutex
+	bundles map[string]map[string]string
+	tags    []language.Tag
+	matcher language.Matcher
+}
+
+// NewMessages returns the messages of English and Traditional Chinese,
+// English is the default language.
+func NewMessages() *Messages {
+	m := &Messages{bundles: make(map[string]map[string]string)}
+	enMessages := make(map[string]string, len(Errors))
+	for _, e := range Errors {
+		enMessages[e.Code] = e.Message
+	}
+	m.Add(LANG_EN, enMessages)
+	m.Add(LANG_ZH_TW, _zhTWMessages)
+
+	return m
+}
+
+// Add adds or replaces messages of lang, a BCP 47 tag such as ja or zh-TW.
+func (m *Messages) Add(lang string, messages map[string]string) error {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return fmt.Errorf("invalid language %q : %w", lang, err)
+	}
+	lang = tag.String()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bundle, ok := m.bundles[lang]
+	if !ok {
+		bundle = make(map[string]string, len(messages))
+		m.bundles[lang] = bundle
+		m.tags = append(m.tags, tag)
+		m.matcher = language.NewMatcher(m.tags)
+	}
+	for code, message := range messages {
+		bundle[code] = message
+	}
+
+	return nil
+}
+
+// Negotiate returns the language best matching an Accept-Language header.
+func (m *Messages) Negotiate(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if err != nil || len(tags) == 0 {
+		return m.tags[0].String()
+	}
+	_, i, confidence := m.matcher.Match(tags...)
+	if confidence == language.No {
+		return m.tags[0].String()
+	}
+
+	return m.tags[i].String()
+}
+
+// Message returns the message of code in lang.
+func (m *Messages) Message(lang, code string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if message, ok := m.bundles[lang][code]; ok {
+		return message
+	}
+
+	return m.bundles[LANG_EN][code]
+}
+
+// validationTranslator returns the translator of validation errors in lang,
+// English when there is none.
+func validationTranslator(lang string) ut.Translator {
+	trans, _ := _translators.GetTranslator(_validationLocales[lang])
+	if trans == nil {
+		trans = _translators.GetFallback()
+	}
+
+	return trans
+}
+
+// localeMiddleware negotiates the language of the response.
+func (b *BlockActionApi) localeMiddleware(c *gin.Context) {
+	lang := b.opts.messages.Negotiate(c.GetHeader("Accept-Language"))
+	c.Set(CTX_LOCALE, lang)
+	c.Set(ctxMessages, b.opts.messages)
+	c.Header("Content-Language", lang)
+
+	c.Next()
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+
+	docs "github.com/reddtsai/goAPI/pkg/blockaction/api/swagger"
+)
+
+const (
+	OPENAPI_VERSION = "3.1.0"
+	// 與 handler 註解 @Security 同名
+	SECURITY_BEARER = "BearerAuth"
+)
+
+// OpenAPI returns the OpenAPI 3.1 document of the API, converted from the
+// swag annotations of the handlers. The annotated /v1 paths are served by
+// /v2 as well, unless /v2 annotates its own.
+func OpenAPI() (*openapi3.T, error) {
+	var doc2 openapi2.T
+	err := json.Unmarshal([]byte(docs.SwaggerInfo.ReadDoc()), &doc2)
+	if err != nil {
+		return nil, fmt.Errorf("decode swagger fail : %w", err)
+	}
+	doc, err := openapi2conv.ToV3(&doc2)
+	if err != nil {
+		return nil, fmt.Errorf("convert swagger fail : %w", err)
+	}
+	doc.OpenAPI = OPENAPI_VERSION
+	doc.Servers = openapi3.Servers{{URL: "/"}}
+	// swagger 2.0 has no bearer scheme, the annotation declares an api key
+	bearer := openapi3.NewJWTSecurityScheme()
+	bearer.Description = "token of signin or refresh"
+	doc.Components.SecuritySchemes[SECURITY_BEARER] = &openapi3.SecuritySchemeRef{Value: bearer}
+	for path, item := range doc.Paths.Map() {
+		v1Path, ok := strings.CutPrefix(path, "/"+API_V1+"/")
+		if !ok {
+			continue
+		}
+		v2Path := "/" + API_V2 + "/" + v1Path
+		v2Item := doc.Paths.Value(v2Path)
+		if v2Item == nil {
+			v2Item = &openapi3.PathItem{}
+			doc.Paths.Set(v2Path, v2Item)
+		}
+		for method, op := range item.Operations() {
+			if v2Item.GetOperation(method) == nil {
+				v2Op := *op
+				v2Item.SetOperation(method, &v2Op)
+			}
+			op.Deprecated = true
+		}
+	}
+	err = doc.Validate(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("invalid openapi : %w", err)
+	}
+
+	return doc, nil
+}
+
+// SetOpenAPIValidation validates requests and responses of the documented
+// routes against the OpenAPI document, meant for development only as it
+// buffers every response.
+func SetOpenAPIValidation(enabled bool) BlockActionApiOption {
+	return func(o *BlockActionApiOptions) {
+		o.openAPIValidation = enabled
+	}
+}
+
+func (b *BlockActionApi) OpenAPIDoc(c *gin.Context) {
+	c.JSON(http.StatusOK, b.openapi)
+}
+
+// openAPIValidationMiddleware answers requests not matching the document
+// with ErrValidation, and responses not matching it with ErrInternal, so a
+// drift between the handlers and their annotations shows up in development.
+func openAPIValidationMiddleware(doc *openapi3.T) (gin.HandlerFunc, error) {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("openapi router fail : %w", err)
+	}
+	options := &openapi3filter.Options{
+		IncludeResponseStatus: true,
+		// authMiddleware authenticates, by token or client certificate
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+	return func(c *gin.Context) {
+		route, pathParams, err := router.FindRoute(c.Request)
+		if err != nil {
+			c.Next()
+			return
+		}
+		requestInput := &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    options,
+		}
+		err = openapi3filter.ValidateRequest(c.Request.Context(), requestInput)
+		if err != nil {
+			slog.Warn("openapi request mismatch", "request_id", c.GetString(CTX_REQUEST_ID), "path", route.Path, "error", err)
+			writeError(c, ErrValidation)
+			return
+		}
+
+		w := &bufferedWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = w
+		// a panic is answered by the recovery on the original writer
+		defer func() {
+			c.Writer = w.ResponseWriter
+		}()
+		c.Next()
+
+		responseInput := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: requestInput,
+			Status:                 w.status,
+			Header:                 w.Header(),
+			Options:                options,
+		}
+		responseInput.SetBodyBytes(w.body.Bytes())
+		err = openapi3filter.ValidateResponse(c.Request.Context(), responseInput)
+		if err != nil {
+			w.body.Reset()
+			writeError(c, fmt.Errorf("openapi response mismatch, status %d : %w", w.status, err))
+		}
+		w.ResponseWriter.WriteHeader(w.status)
+		w.ResponseWriter.Write(w.body.Bytes())
+	}, nil
+}
+
+// bufferedWriter holds the response until it is validated.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return false
+}
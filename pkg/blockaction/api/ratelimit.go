@@ -0,0 +1,21 @@
+package api
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitMiddleware limits the requests per client IP with the limit of
+// the service, shared with gRPC.
+func (b *BlockActionApi) rateLimitMiddleware(c *gin.Context) {
+	ok, wait := b.opts.service.Allow(c.ClientIP())
+	if !ok {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeError(c, ErrTooManyRequests)
+		return
+	}
+
+	c.Next()
+}
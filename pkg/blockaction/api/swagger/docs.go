@@ -15,6 +15,100 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/.well-known/jwks.json": {
+            "get": {
+                "description": "其他服務以此 JSON Web Key Set 驗證 token, 未設定簽章金鑰時為空",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "驗證 token 的公鑰",
+                "responses": {
+                    "200": {
+                        "description": "ok",
+                        "schema": {
+                            "$ref": "#/definitions/auth.JWKS"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/admin/users/{id}/history": {
+            "get": {
+                "description": "會員異動紀錄, 含已刪除的會員, 需 admin mTLS 憑證",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "會員異動紀錄",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "user id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "ok",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/api.BaseResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "$ref": "#/definitions/api.GetUserHistoryResp"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_USER_ID",
+                        "schema": {
+                            "$ref": "#/definitions/api.BaseResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/api.BaseResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "RATE_LIMITED",
+                        "schema": {
+                            "$ref": "#/definitions/api.BaseResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/api.BaseResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "UNAVAILABLE",
+                        "schema": {
+                            "$ref": "#/definitions/api.BaseResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/v1/signin": {
             "post": {
                 "description": "會員登入",
@@ -59,43 +153,71 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "bad request",
+                        "description": "BAD_REQUEST, VALIDATION_FAILED",
                         "schema": {
-                            "allOf": [
-                                {
-                                    "$ref": "#/definitions/api.BaseResponse"
-                                },
-                                {
-                                    "type": "object",
-                                    "properties": {
-                                        "error": {
-                                            "type": "string"
-                                        }
-                                    }
-                                }
-                            ]
+                            "$ref": "#/definitions/api.BaseResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "INVALID_CREDENTIALS",
+                        "schema": {
+                            "$ref": "#/definitions/api.BaseResponse"
                         }
                     },
                     "403": {
-                        "description": "forbidden",
+                        "description": "FORBIDDEN",
                         "schema": {
-                            "allOf": [
-                                {
-                                    "$ref": "#/definitions/api.BaseResponse"
-                                },
-                                {
-                                    "type": "object",
-                                    "properties": {
-                                        "error": {
-                                            "type": "string"
-                                        }
-                                    }
-                                }
-                            ]
+                            "$ref": "#/definitions/api.BaseResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "RATE_LIMITED",
+                        "schema": {
+                            "$ref": "#/definitions/api.BaseResponse"
                         }
                     },
                     "500": {
-                        "description": "server error",
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/api.BaseResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "UNAVAILABLE",
+                        "schema": {
+                            "$ref": "#/definitions/api.BaseResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/signup": {
+            "post": {
+                "description": "會員註冊",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "BlockAction"
+                ],
+                "summary": "會員註冊",
+                "parameters": [
+                    {
+                        "description": "raw",
+                        "name": "Request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.SignupReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "ok",
                         "schema": {
                             "allOf": [
                                 {
@@ -104,20 +226,56 @@ const docTemplate = `{
                                 {
                                     "type": "object",
                                     "properties": {
-                                        "error": {
-                                            "type": "string"
+                                        "result": {
+                                            "$ref": "#/definitions/api.SignupResp"
                                         }
                                     }
                                 }
                             ]
                         }
+                    },
+                    "400": {
+                        "description": "BAD_REQUEST, VALIDATION_FAILED",
+                        "schema": {
+                            "$ref": "#/definitions/api.BaseResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/api.BaseResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "ACCOUNT_EXISTS",
+                        "schema": {
+                            "$ref": "#/definitions/api.BaseResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "RATE_LIMITED",
+                        "schema": {
+                            "$ref": "#/definitions/api.BaseResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/api.BaseResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "UNAVAILABLE",
+                        "schema": {
+                            "$ref": "#/definitions/api.BaseResponse"
+                        }
                     }
                 }
             }
         },
-        "/v1/signup": {
+        "/v1/token/refresh": {
             "post": {
-                "description": "會員註冊",
+                "description": "以 refresh token 換發新的 token 與 refresh token",
                 "consumes": [
                     "application/json"
                 ],
@@ -127,7 +285,7 @@ const docTemplate = `{
                 "tags": [
                     "BlockAction"
                 ],
-                "summary": "會員註冊",
+                "summary": "更新 token",
                 "parameters": [
                     {
                         "description": "raw",
@@ -135,7 +293,7 @@ const docTemplate = `{
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/api.SignupReq"
+                            "$ref": "#/definitions/api.RefreshTokenReq"
                         }
                     }
                 ],
@@ -151,7 +309,7 @@ const docTemplate = `{
                                     "type": "object",
                                     "properties": {
                                         "result": {
-                                            "$ref": "#/definitions/api.SignupResp"
+                                            "$ref": "#/definitions/api.SigninResp"
                                         }
                                     }
                                 }
@@ -159,25 +317,37 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "bad request",
+                        "description": "BAD_REQUEST, VALIDATION_FAILED",
+                        "schema": {
+                            "$ref": "#/definitions/api.BaseResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
                         "schema": {
                             "$ref": "#/definitions/api.BaseResponse"
                         }
                     },
                     "403": {
-                        "description": "forbidden",
+                        "description": "FORBIDDEN",
                         "schema": {
                             "$ref": "#/definitions/api.BaseResponse"
                         }
                     },
-                    "409": {
-                        "description": "conflict",
+                    "429": {
+                        "description": "RATE_LIMITED",
                         "schema": {
                             "$ref": "#/definitions/api.BaseResponse"
                         }
                     },
                     "500": {
-                        "description": "server error",
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/api.BaseResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "UNAVAILABLE",
                         "schema": {
                             "$ref": "#/definitions/api.BaseResponse"
                         }
@@ -187,6 +357,11 @@ const docTemplate = `{
         },
         "/v1/user/personal-info": {
             "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
                 "description": "會員資訊",
                 "consumes": [
                     "application/json"
@@ -218,19 +393,37 @@ const docTemplate = `{
                         }
                     },
                     "401": {
-                        "description": "unauthorized",
+                        "description": "UNAUTHORIZED",
                         "schema": {
                             "$ref": "#/definitions/api.BaseResponse"
                         }
                     },
                     "403": {
-                        "description": "forbidden",
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/api.BaseResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "USER_NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/api.BaseResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "RATE_LIMITED",
                         "schema": {
                             "$ref": "#/definitions/api.BaseResponse"
                         }
                     },
                     "500": {
-                        "description": "server error",
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/api.BaseResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "UNAVAILABLE",
                         "schema": {
                             "$ref": "#/definitions/api.BaseResponse"
                         }
@@ -244,11 +437,63 @@ const docTemplate = `{
             "type": "object",
             "properties": {
                 "error": {
-                    "type": "string"
+                    "$ref": "#/definitions/api.ErrorBody"
                 },
                 "result": {}
             }
         },
+        "api.ErrorBody": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "錯誤碼, 見 Errors",
+                    "type": "string",
+                    "example": "USER_NOT_FOUND"
+                },
+                "details": {
+                    "description": "欄位驗證錯誤",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.FieldError"
+                    }
+                },
+                "message": {
+                    "description": "說明",
+                    "type": "string",
+                    "example": "user not found"
+                },
+                "request_id": {
+                    "description": "請求 ID",
+                    "type": "string",
+                    "example": "1780000000000000000"
+                }
+            }
+        },
+        "api.FieldError": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "description": "欄位",
+                    "type": "string",
+                    "example": "account"
+                },
+                "message": {
+                    "description": "說明",
+                    "type": "string",
+                    "example": "account must be at least 6 characters"
+                },
+                "param": {
+                    "description": "規則參數",
+                    "type": "string",
+                    "example": "6"
+                },
+                "rule": {
+                    "description": "驗證規則",
+                    "type": "string",
+                    "example": "min"
+                }
+            }
+        },
         "api.GetPersonalInfoResp": {
             "type": "object",
             "properties": {
@@ -263,6 +508,32 @@ const docTemplate = `{
                 }
             }
         },
+        "api.GetUserHistoryResp": {
+            "type": "object",
+            "properties": {
+                "history": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.UserHistoryResp"
+                    }
+                },
+                "user_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.RefreshTokenReq": {
+            "type": "object",
+            "required": [
+                "refresh_token"
+            ],
+            "properties": {
+                "refresh_token": {
+                    "description": "refresh token",
+                    "type": "string"
+                }
+            }
+        },
         "api.SigninReq": {
             "type": "object",
             "required": [
@@ -326,13 +597,98 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "api.UserHistoryResp": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "description": "create, update, delete",
+                    "type": "string"
+                },
+                "after": {
+                    "description": "異動後",
+                    "type": "object"
+                },
+                "before": {
+                    "description": "異動前, create 沒有",
+                    "type": "object"
+                },
+                "created_at": {
+                    "description": "異動時間 (毫秒)",
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "updater": {
+                    "description": "修改者",
+                    "type": "string"
+                },
+                "version": {
+                    "description": "異動後版本",
+                    "type": "integer"
+                }
+            }
+        },
+        "auth.JWK": {
+            "type": "object",
+            "properties": {
+                "alg": {
+                    "type": "string"
+                },
+                "crv": {
+                    "description": "EC, OKP",
+                    "type": "string"
+                },
+                "e": {
+                    "description": "RSA",
+                    "type": "string"
+                },
+                "kid": {
+                    "description": "對應 token header 的 kid",
+                    "type": "string"
+                },
+                "kty": {
+                    "description": "EC, RSA 或 OKP",
+                    "type": "string"
+                },
+                "n": {
+                    "description": "RSA",
+                    "type": "string"
+                },
+                "use": {
+                    "type": "string"
+                },
+                "x": {
+                    "description": "EC, OKP",
+                    "type": "string"
+                },
+                "y": {
+                    "description": "EC",
+                    "type": "string"
+                }
+            }
+        },
+        "auth.JWKS": {
+            "type": "object",
+            "properties": {
+                "keys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/auth.JWK"
+                    }
+                }
+            }
         }
     },
-    "tags": [
-        {
-            "name": "BlockAction"
+    "securityDefinitions": {
+        "BearerAuth": {
+            "description": "Bearer token of signin, e.g. \"Bearer eyJhbGciOiJIUzI1NiJ9...\"",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
-    ]
+    }
 }`
 
 // SwaggerInfo holds exported Swagger Info so clients can modify it
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	API_V1          = "v1"
+	API_V2          = "v2"
+	CTX_API_VERSION = "c_api_version"
+
+	// 計量用的 client 名稱長度上限
+	CLIENT_NAME_MAX_LEN = 64
+	// 不在清單內的 client 計量名稱
+	CLIENT_OTHER = "other"
+)
+
+// Deprecation is announced on every response of a deprecated API version.
+type Deprecation struct {
+	DeprecatedAt time.Time // 零值不送 Deprecation
+	SunsetAt     time.Time // 零值不送 Sunset
+	Link         string    // 遷移說明文件
+}
+
+// SetV1Deprecation announces the deprecation of /v1 with the Deprecation
+// (RFC 9745) and Sunset (RFC 8594) headers.
+func SetV1Deprecation(d Deprecation) BlockActionApiOption {
+	return func(o *BlockActionApiOptions) {
+		o.v1Deprecation = d
+	}
+}
+
+// SetMetricsClients lists the User-Agent products, such as BlockAction of
+// BlockAction/3.2.1, counted by name per API version. Other products are
+// counted as other, so a client cannot grow the metric without bound.
+func SetMetricsClients(products []string) BlockActionApiOption {
+	return func(o *BlockActionApiOptions) {
+		o.metricsClients = products
+	}
+}
+
+// APIVersion returns the API version of the request, empty outside the
+// versioned groups.
+func APIVersion(c *gin.Context) string {
+	return c.GetString(CTX_API_VERSION)
+}
+
+// routes registers the handlers shared by every API version. A version
+// changing the shape of an endpoint registers its own handler in its group
+// instead of the shared one.
+func (b *BlockActionApi) routes(g *gin.RouterGroup, version string) {
+	g.Use(middleware)
+	g.Use(b.versionMiddleware(version))
+	g.Use(b.rateLimitMiddleware)
+	g.POST("/signup", b.Signup)
+	g.POST("/signin", b.Signin)
+	g.POST("/token/refresh", b.RefreshToken)
+
+	userGroup := g.Group("/user")
+	userGroup.Use(b.authMiddleware)
+	userGroup.GET("/personal-info", b.GetPersonalInfo)
+
+	adminGroup := g.Group("/admin")
+	adminGroup.Use(b.adminMiddleware)
+	adminGroup.GET("/users/:id/history", b.GetUserHistory)
+}
+
+// versionMiddleware counts the requests of every client per version, so a
+// version is turned off once its clients moved on.
+func (b *BlockActionApi) versionMiddleware(version string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(CTX_API_VERSION, version)
+		_routerMetrics.VersionRequestTotal.WithLabelValues(version, b.clientName(c)).Inc()
+
+		c.Next()
+	}
+}
+
+// deprecationMiddleware sends the deprecation headers of d.
+func deprecationMiddleware(d Deprecation) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !d.DeprecatedAt.IsZero() {
+			c.Header("Deprecation", "@"+strconv.FormatInt(d.DeprecatedAt.Unix(), 10))
+		}
+		if !d.SunsetAt.IsZero() {
+			c.Header("Sunset", d.SunsetAt.UTC().Format(http.TimeFormat))
+		}
+		if d.Link != "" {
+			c.Header("Link", "<"+d.Link+`>; rel="deprecation"; type="text/html"`)
+		}
+
+		c.Next()
+	}
+}
+
+// clientName names the client of a request for metrics, its mTLS identity,
+// issued by the client CA, or the product of its User-Agent when listed in
+// the metrics clients. Any other client is CLIENT_OTHER.
+func (b *BlockActionApi) clientName(c *gin.Context) string {
+	if name := ClientIdentity(c); name != "" {
+		if len(name) > CLIENT_NAME_MAX_LEN {
+			name = name[:CLIENT_NAME_MAX_LEN]
+		}
+		return name
+	}
+	product, _, _ := strings.Cut(c.GetHeader("User-Agent"), " ")
+	product, _, _ = strings.Cut(product, "/")
+	if product == "" || !slices.Contains(b.opts.metricsClients, product) {
+		return CLIENT_OTHER
+	}
+
+	return product
+}
@@ -0,0 +1,174 @@
+// Package auth verifies the tokens issued by the BlockAction API, for the
+// API itself and for the services accepting its tokens.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	TOKEN_ISSUER      = "blockaction"
+	TOKEN_USE_REFRESH = "refresh"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrKeyNotFound  = errors.New("key not found")
+)
+
+// Claims are the claims of a BlockAction token.
+type Claims struct {
+	ID      int64  `json:"id"`
+	Account string `json:"account"`
+	Use     string `json:"use,omitempty"` // refresh token 為 refresh
+	Family  string `json:"fam,omitempty"` // refresh token 所屬的家族
+	jwt.RegisteredClaims
+}
+
+// KeySource returns the key verifying a token signed with alg by the key
+// kid, ErrKeyNotFound when it has none.
+type KeySource interface {
+	Key(ctx context.Context, kid, alg string) (interface{}, error)
+}
+
+// Verifier verifies the signature and claims of tokens, safe for concurrent
+// use.
+type Verifier struct {
+	opts VerifierOptions
+}
+
+type VerifierOptions struct {
+	keys       KeySource
+	algorithms []string
+	issuer     string
+	audience   string
+	leeway     time.Duration
+}
+
+type VerifierOption func(*VerifierOptions)
+
+func DefaultVerifierOptions() VerifierOptions {
+	return VerifierOptions{
+		algorithms: []string{jwt.SigningMethodES256.Alg()},
+		issuer:     TOKEN_ISSUER,
+	}
+}
+
+func NewVerifier(opts ...VerifierOption) (*Verifier, error) {
+	v := new(Verifier)
+	v.opts = DefaultVerifierOptions()
+	for _, opt := range opts {
+		opt(&v.opts)
+	}
+	if v.opts.keys == nil {
+		return nil, fmt.Errorf("key source is nil")
+	}
+	if len(v.opts.algorithms) == 0 {
+		return nil, fmt.Errorf("algorithms is empty")
+	}
+	for _, alg := range v.opts.algorithms {
+		if jwt.GetSigningMethod(alg) == nil || alg == jwt.SigningMethodNone.Alg() {
+			return nil, fmt.Errorf("algorithm %q is not allowed", alg)
+		}
+	}
+	if v.opts.leeway < 0 {
+		return nil, fmt.Errorf("leeway must not be negative")
+	}
+
+	return v, nil
+}
+
+// SetKeySource sets where the verification keys come from, a KeySet or the
+// JWKS endpoint of the API with NewRemoteKeys.
+func SetKeySource(keys KeySource) VerifierOption {
+	return func(o *VerifierOptions) {
+		o.keys = keys
+	}
+}
+
+// SetAlgorithms pins the algorithms tokens may be signed with, ES256 by
+// default. A token signed with any other is rejected before its key is
+// looked up.
+func SetAlgorithms(algorithms ...string) VerifierOption {
+	return func(o *VerifierOptions) {
+		o.algorithms = algorithms
+	}
+}
+
+// SetIssuer sets the required issuer, TOKEN_ISSUER by default. Empty
+// accepts any issuer.
+func SetIssuer(issuer string) VerifierOption {
+	return func(o *VerifierOptions) {
+		o.issuer = issuer
+	}
+}
+
+// SetAudience requires tokens issued for audience, usually the name of the
+// verifying service.
+func SetAudience(audience string) VerifierOption {
+	return func(o *VerifierOptions) {
+		o.audience = audience
+	}
+}
+
+// SetLeeway tolerates clock skew with the issuer on expiry and issue time.
+func SetLeeway(leeway time.Duration) VerifierOption {
+	return func(o *VerifierOptions) {
+		o.leeway = leeway
+	}
+}
+
+// Verify returns the claims of an access token, errors wrap
+// ErrInvalidToken. Access tokens must expire, refresh tokens are refused.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	claims, err := v.Parse(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Use == TOKEN_USE_REFRESH {
+		return nil, fmt.Errorf("%w : refresh token", ErrInvalidToken)
+	}
+	if claims.ExpiresAt == nil {
+		return nil, fmt.Errorf("%w : no expiry", ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// Parse returns the claims of a token of any use, errors wrap
+// ErrInvalidToken.
+func (v *Verifier) Parse(ctx context.Context, token string) (*Claims, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(v.opts.algorithms),
+		jwt.WithLeeway(v.opts.leeway),
+		jwt.WithIssuedAt(),
+	}
+	if v.opts.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.opts.issuer))
+	}
+	if v.opts.audience != "" {
+		opts = append(opts, jwt.WithAudience(v.opts.audience))
+	}
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		// the parser checks the algorithm again, the key is never looked up
+		// for another one
+		alg := t.Method.Alg()
+		if !slices.Contains(v.opts.algorithms, alg) {
+			return nil, fmt.Errorf("algorithm %q is not allowed", alg)
+		}
+		kid, _ := t.Header["kid"].(string)
+		return v.opts.keys.Key(ctx, kid, alg)
+	}, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w : %w", ErrInvalidToken, err)
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,346 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type testKey struct {
+	key *ecdsa.PrivateKey
+	jwk JWK
+}
+
+func newTestKey(t *testing.T) testKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	jwk, err := NewJWK("", key.Public())
+	require.NoError(t, err)
+
+	return testKey{key: key, jwk: jwk}
+}
+
+func (k testKey) sign(t *testing.T, claims *Claims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = k.jwk.Kid
+	signed, err := token.SignedString(k.key)
+	require.NoError(t, err)
+
+	return signed
+}
+
+func testClaims(expiresIn time.Duration, audience ...string) *Claims {
+	now := time.Now()
+	return &Claims{ID: 1, Account: "testuser", RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    TOKEN_ISSUER,
+		Audience:  audience,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+	}}
+}
+
+func TestNewVerifier(t *testing.T) {
+	_, err := NewVerifier()
+	assert.EqualError(t, err, "key source is nil")
+	_, err = NewVerifier(SetKeySource(KeySet{}), SetAlgorithms("none"))
+	assert.Error(t, err)
+	_, err = NewVerifier(SetKeySource(KeySet{}), SetAlgorithms())
+	assert.Error(t, err)
+}
+
+func TestVerifier(t *testing.T) {
+	k := newTestKey(t)
+	ctx := context.Background()
+	v, err := NewVerifier(SetKeySource(JWKS{Keys: []JWK{k.jwk}}.KeySet()), SetAudience("billing"), SetLeeway(time.Minute))
+	require.NoError(t, err)
+
+	claims, err := v.Verify(ctx, k.sign(t, testClaims(time.Minute, "billing")))
+	require.NoError(t, err)
+	assert.Equal(t, "testuser", claims.Account)
+
+	// expired within the leeway
+	_, err = v.Verify(ctx, k.sign(t, testClaims(-30*time.Second, "billing")))
+	assert.NoError(t, err)
+
+	invalid := map[string]*Claims{
+		"expired":        testClaims(-2*time.Minute, "billing"),
+		"other audience": testClaims(time.Minute, "chat"),
+		"no audience":    testClaims(time.Minute),
+		"other issuer":   {RegisteredClaims: jwt.RegisteredClaims{Issuer: "other", Audience: jwt.ClaimStrings{"billing"}, ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}},
+		"no expiry":      {RegisteredClaims: jwt.RegisteredClaims{Issuer: TOKEN_ISSUER, Audience: jwt.ClaimStrings{"billing"}}},
+		"refresh":        {Use: TOKEN_USE_REFRESH, RegisteredClaims: testClaims(time.Minute, "billing").RegisteredClaims},
+	}
+	for name, c := range invalid {
+		_, err = v.Verify(ctx, k.sign(t, c))
+		assert.ErrorIs(t, err, ErrInvalidToken, name)
+	}
+	// refresh tokens are only parsed
+	_, err = v.Parse(ctx, k.sign(t, invalid["refresh"]))
+	assert.NoError(t, err)
+
+	// an unknown key, an algorithm out of the pinned ones
+	_, err = v.Verify(ctx, newTestKey(t).sign(t, testClaims(time.Minute, "billing")))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	public, err := x509.MarshalPKIXPublicKey(k.key.Public())
+	require.NoError(t, err)
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims(time.Minute, "billing"))
+	hs.Header["kid"] = k.jwk.Kid
+	forged, err := hs.SignedString(public)
+	require.NoError(t, err)
+	_, err = v.Verify(ctx, forged)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	// a key only verifies its own algorithm
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaJWK, err := NewJWK("", &rsaKey.PublicKey)
+	require.NoError(t, err)
+	rv, err := NewVerifier(SetKeySource(JWKS{Keys: []JWK{rsaJWK}}.KeySet()), SetAlgorithms("RS256", "RS384"))
+	require.NoError(t, err)
+	rs := jwt.NewWithClaims(jwt.SigningMethodRS384, testClaims(time.Minute))
+	rs.Header["kid"] = rsaJWK.Kid
+	signed, err := rs.SignedString(rsaKey)
+	require.NoError(t, err)
+	_, err = rv.Verify(ctx, signed)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, testClaims(time.Minute, "billing")).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	_, err = v.Verify(ctx, none)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestJWK(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	for alg, key := range map[string]crypto.PublicKey{"RS256": &rsaKey.PublicKey, "ES384": &ecKey.PublicKey, "EdDSA": edKey} {
+		jwk, err := NewJWK("", key)
+		require.NoError(t, err)
+		assert.Equal(t, alg, jwk.Alg)
+		data, err := json.Marshal(JWKS{Keys: []JWK{jwk}})
+		require.NoError(t, err)
+		var jwks JWKS
+		require.NoError(t, json.Unmarshal(data, &jwks))
+		decoded, err := jwks.Keys[0].PublicKey()
+		require.NoError(t, err)
+		assert.True(t, key.(interface{ Equal(crypto.PublicKey) bool }).Equal(decoded), alg)
+	}
+
+	// the example of RFC 7638
+	rfc := JWK{
+		Kty: "RSA",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+	}
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", rfc.Thumbprint())
+
+	_, err = JWK{Kty: "EC", Crv: "P-256", X: "AQ", Y: "AQ"}.PublicKey()
+	assert.Error(t, err)
+}
+
+func TestRemoteKeys(t *testing.T) {
+	k := newTestKey(t)
+	var fetches atomic.Int32
+	var unavailable atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if unavailable.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(JWKS{Keys: []JWK{k.jwk}})
+	}))
+	defer server.Close()
+	_, err := NewRemoteKeys("example.com/jwks.json")
+	assert.Error(t, err)
+	keys, err := NewRemoteKeys(server.URL+JWKS_PATH, SetHTTPClient(server.Client()), SetMinRefreshInterval(time.Hour))
+	require.NoError(t, err)
+	v, err := NewVerifier(SetKeySource(keys))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_, err = v.Verify(ctx, k.sign(t, testClaims(time.Minute)))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), fetches.Load())
+	// unknown keys are fetched at most once per min refresh interval
+	_, err = v.Verify(ctx, newTestKey(t).sign(t, testClaims(time.Minute)))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	assert.Equal(t, int32(1), fetches.Load())
+
+	// expired keys are fetched again, or kept while the endpoint is down
+	keys, err = NewRemoteKeys(server.URL+JWKS_PATH, SetHTTPClient(server.Client()), SetCacheTTL(time.Nanosecond), SetMinRefreshInterval(0), SetMaxStaleness(time.Minute))
+	require.NoError(t, err)
+	v, err = NewVerifier(SetKeySource(keys))
+	require.NoError(t, err)
+	_, err = v.Verify(ctx, k.sign(t, testClaims(time.Minute)))
+	require.NoError(t, err)
+	unavailable.Store(true)
+	_, err = v.Verify(ctx, k.sign(t, testClaims(time.Minute)))
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return fetches.Load() == 3 }, time.Second, 10*time.Millisecond)
+
+	// keys beyond the max staleness are refused
+	_, err = NewRemoteKeys(server.URL+JWKS_PATH, SetCacheTTL(time.Minute), SetMaxStaleness(time.Second))
+	assert.Error(t, err)
+	unavailable.Store(false)
+	keys, err = NewRemoteKeys(server.URL+JWKS_PATH, SetHTTPClient(server.Client()), SetCacheTTL(time.Nanosecond), SetMinRefreshInterval(0), SetMaxStaleness(50*time.Millisecond))
+	require.NoError(t, err)
+	v, err = NewVerifier(SetKeySource(keys))
+	require.NoError(t, err)
+	_, err = v.Verify(ctx, k.sign(t, testClaims(time.Minute)))
+	require.NoError(t, err)
+	unavailable.Store(true)
+	_, err = v.Verify(ctx, k.sign(t, testClaims(time.Minute)))
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	_, err = v.Verify(ctx, k.sign(t, testClaims(time.Minute)))
+	assert.Error(t, err)
+}
+
+func TestRemoteKeysSlowFetch(t *testing.T) {
+	k := newTestKey(t)
+	gate := make(chan struct{})
+	requested := make(chan struct{}, 1)
+	var slow atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow.Load() {
+			requested <- struct{}{}
+			<-gate
+		}
+		json.NewEncoder(w).Encode(JWKS{Keys: []JWK{k.jwk}})
+	}))
+	defer server.Close()
+	keys, err := NewRemoteKeys(server.URL+JWKS_PATH, SetHTTPClient(server.Client()), SetMinRefreshInterval(0))
+	require.NoError(t, err)
+	v, err := NewVerifier(SetKeySource(keys))
+	require.NoError(t, err)
+	ctx := context.Background()
+	_, err = v.Verify(ctx, k.sign(t, testClaims(time.Minute)))
+	require.NoError(t, err)
+
+	// lookups of an unknown kid wait for the fetch, or give up on it
+	slow.Store(true)
+	defer close(gate)
+	go v.Verify(ctx, newTestKey(t).sign(t, testClaims(time.Minute)))
+	<-requested
+	gaveUp, verified := make(chan error, 1), make(chan error, 1)
+	go func() {
+		timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err := v.Verify(timeout, newTestKey(t).sign(t, testClaims(time.Minute)))
+		gaveUp <- err
+	}()
+	// cached keys are served meanwhile
+	go func() {
+		_, err := v.Verify(ctx, k.sign(t, testClaims(time.Minute)))
+		verified <- err
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case err = <-gaveUp:
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+		case err = <-verified:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("lookup blocked by the fetch")
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	k := newTestKey(t)
+	v, err := NewVerifier(SetKeySource(JWKS{Keys: []JWK{k.jwk}}.KeySet()))
+	require.NoError(t, err)
+	token := k.sign(t, testClaims(time.Minute))
+	account := func(ctx context.Context) string {
+		claims, ok := ClaimsFromContext(ctx)
+		if !ok {
+			return ""
+		}
+		return claims.Account
+	}
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/", GinMiddleware(v), func(c *gin.Context) {
+		c.String(http.StatusOK, account(c.Request.Context()))
+	})
+	handlers := map[string]http.Handler{
+		"net/http": Middleware(v)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(account(r.Context())))
+		})),
+		"gin": engine,
+	}
+	for name, handler := range handlers {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code, name)
+		assert.Equal(t, `Bearer error="invalid_token"`, w.Header().Get("WWW-Authenticate"), name)
+
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "bearer "+token)
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, name)
+		assert.Equal(t, "testuser", w.Body.String(), name)
+	}
+
+	interceptor := UnaryServerInterceptor(v)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return account(ctx), nil
+	}
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(MD_AUTHORIZATION, "Bearer "+token))
+	resp, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "testuser", resp)
+}
+
+func TestBearerToken(t *testing.T) {
+	assert.Equal(t, "abc", BearerToken("Bearer abc"))
+	assert.Equal(t, "abc", BearerToken("bearer abc"))
+	assert.Empty(t, BearerToken("Basic abc"))
+	assert.Empty(t, BearerToken("Bearer"))
+}
+
+func TestTLSIdentity(t *testing.T) {
+	spiffe, err := url.Parse("spiffe://example.com/billing")
+	require.NoError(t, err)
+	state := func(cert *x509.Certificate) *tls.ConnectionState {
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	assert.Empty(t, TLSIdentity(nil))
+	assert.Empty(t, TLSIdentity(&tls.ConnectionState{}))
+	assert.Equal(t, "spiffe://example.com/billing", TLSIdentity(state(&x509.Certificate{URIs: []*url.URL{spiffe}, DNSNames: []string{"billing.example.com"}})))
+	assert.Equal(t, "billing.example.com", TLSIdentity(state(&x509.Certificate{DNSNames: []string{"billing.example.com"}, Subject: pkix.Name{CommonName: "billing"}})))
+	assert.Equal(t, "billing", TLSIdentity(state(&x509.Certificate{Subject: pkix.Name{CommonName: "billing"}})))
+}
@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"crypto/tls"
+)
+
+// TLSIdentity returns the identity of the client certificate verified by
+// mutual TLS on a connection: its first URI such as a SPIFFE ID, otherwise
+// its first DNS name, otherwise its common name. It is empty when the
+// client presented no verified certificate. The HTTP and gRPC APIs name
+// their trusted clients with it.
+func TLSIdentity(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	cert := state.VerifiedChains[0][0]
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+
+	return cert.Subject.CommonName
+}
@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWK is a public key of a JSON Web Key Set (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`           // EC, RSA 或 OKP
+	Kid string `json:"kid,omitempty"` // 對應 token header 的 kid
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"` // EC, OKP
+	X   string `json:"x,omitempty"`   // EC, OKP
+	Y   string `json:"y,omitempty"`   // EC
+	N   string `json:"n,omitempty"`   // RSA
+	E   string `json:"e,omitempty"`   // RSA
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK returns the JWK of an RSA, ECDSA or Ed25519 public key, its kid is
+// the thumbprint of the key (RFC 7638) when empty.
+func NewJWK(kid string, key crypto.PublicKey) (JWK, error) {
+	alg, err := Algorithm(key)
+	if err != nil {
+		return JWK{}, err
+	}
+	jwk := JWK{Use: "sig", Alg: alg}
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encodeBase64(k.N.Bytes())
+		jwk.E = encodeBase64(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = k.Curve.Params().Name
+		jwk.X = encodeBase64(k.X.FillBytes(make([]byte, size)))
+		jwk.Y = encodeBase64(k.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encodeBase64(k)
+	}
+	jwk.Kid = kid
+	if jwk.Kid == "" {
+		jwk.Kid = jwk.Thumbprint()
+	}
+
+	return jwk, nil
+}
+
+// Algorithm returns the JWS algorithm signing with key: RS256, ES256,
+// ES384, ES512 or EdDSA.
+func Algorithm(key crypto.PublicKey) (string, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256.Alg(), nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256.Alg(), nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384.Alg(), nil
+		case elliptic.P521():
+			return jwt.SigningMethodES512.Alg(), nil
+		}
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA.Alg(), nil
+	}
+
+	return "", fmt.Errorf("unsupported key type %T", key)
+}
+
+// Thumbprint returns the SHA-256 thumbprint of the key (RFC 7638).
+func (k JWK) Thumbprint() string {
+	var members interface{}
+	// the required members in lexicographic order
+	switch k.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.Kty, k.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{k.Crv, k.Kty, k.X, k.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{k.Crv, k.Kty, k.X}
+	}
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+
+	return encodeBase64(sum[:])
+}
+
+// PublicKey decodes the public key of the JWK.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBase64(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("jwk %s : invalid exponent", k.Kid)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("jwk %s : unsupported curve %q", k.Kid, k.Crv)
+		}
+		x, err := decodeBase64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBase64(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("jwk %s : point is not on the curve", k.Kid)
+		}
+		return key, nil
+	case "OKP":
+		x, err := decodeBase64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("jwk %s : unsupported curve %q", k.Kid, k.Crv)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("jwk %s : unsupported key type %q", k.Kid, k.Kty)
+}
+
+// Key is a verification key and the only algorithm it verifies. HMAC
+// secrets are []byte, public keys those of NewJWK.
+type Key struct {
+	Key interface{}
+	Alg string
+}
+
+// KeySet maps key IDs to verification keys.
+type KeySet map[string]Key
+
+// KeySet decodes the keys of the set, keys it cannot decode are skipped as
+// they may be of a newer kind. A JWK without alg verifies the algorithm of
+// its key type, RS256 for RSA.
+func (s JWKS) KeySet() KeySet {
+	keys := make(KeySet, len(s.Keys))
+	for _, jwk := range s.Keys {
+		key, err := jwk.PublicKey()
+		if err != nil || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		alg := jwk.Alg
+		if alg == "" {
+			alg, err = Algorithm(key)
+			if err != nil {
+				continue
+			}
+		}
+		keys[jwk.Kid] = Key{Key: key, Alg: alg}
+	}
+
+	return keys
+}
+
+// Key returns the key kid, ErrKeyNotFound when there is none or it does not
+// verify alg.
+func (s KeySet) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	key, ok := s[kid]
+	if !ok {
+		return nil, fmt.Errorf("kid %q : %w", kid, ErrKeyNotFound)
+	}
+	if key.Alg != alg {
+		return nil, fmt.Errorf("kid %q : algorithm %q : %w", kid, alg, ErrKeyNotFound)
+	}
+
+	return key.Key, nil
+}
+
+func encodeBase64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("decode jwk fail : %w", err)
+	}
+
+	return b, nil
+}
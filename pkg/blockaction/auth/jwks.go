@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	JWKS_PATH = "/.well-known/jwks.json"
+
+	DEFAULT_CACHE_TTL            = 5 * time.Minute
+	DEFAULT_MIN_REFRESH_INTERVAL = 30 * time.Second
+	// 預設的過期上限, cache ttl 的倍數
+	DEFAULT_MAX_STALENESS_TTLS = 4
+	// 單次讀取 JWKS 的期限, 不受呼叫端 context 影響
+	FETCH_TIMEOUT = 10 * time.Second
+	// JWKS 讀取上限
+	MAX_JWKS_SIZE = 1 << 20
+)
+
+// RemoteKeys are the keys of a JWKS endpoint. They are cached for the cache
+// ttl, and fetched again early for an unknown kid, as the issuer may have
+// rotated its key, at most once per min refresh interval. Concurrent
+// lookups share one fetch, and expired keys are served while it runs, up to
+// the max staleness after their fetch.
+type RemoteKeys struct {
+	url   string
+	opts  RemoteKeysOptions
+	group singleflight.Group
+
+	mu          sync.Mutex
+	keys        KeySet
+	fetchedAt   time.Time
+	attemptedAt time.Time // 含失敗的上次讀取
+}
+
+type RemoteKeysOptions struct {
+	httpClient         *http.Client
+	cacheTTL           time.Duration
+	minRefreshInterval time.Duration
+	maxStaleness       time.Duration // 0 為 DEFAULT_MAX_STALENESS_TTLS 倍 cache ttl
+}
+
+type RemoteKeysOption func(*RemoteKeysOptions)
+
+func DefaultRemoteKeysOptions() RemoteKeysOptions {
+	return RemoteKeysOptions{
+		httpClient:         &http.Client{Timeout: 10 * time.Second},
+		cacheTTL:           DEFAULT_CACHE_TTL,
+		minRefreshInterval: DEFAULT_MIN_REFRESH_INTERVAL,
+	}
+}
+
+// NewRemoteKeys returns the keys served at jwksURL, such as
+// https://api.example.com/.well-known/jwks.json.
+func NewRemoteKeys(jwksURL string, opts ...RemoteKeysOption) (*RemoteKeys, error) {
+	u, err := url.Parse(jwksURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid jwks url %q", jwksURL)
+	}
+	r := &RemoteKeys{url: jwksURL, opts: DefaultRemoteKeysOptions()}
+	for _, opt := range opts {
+		opt(&r.opts)
+	}
+	if r.opts.httpClient == nil {
+		return nil, fmt.Errorf("http client is nil")
+	}
+	if r.opts.maxStaleness == 0 {
+		r.opts.maxStaleness = DEFAULT_MAX_STALENESS_TTLS * r.opts.cacheTTL
+	}
+	if r.opts.cacheTTL <= 0 || r.opts.minRefreshInterval < 0 || r.opts.maxStaleness < r.opts.cacheTTL {
+		return nil, fmt.Errorf("invalid cache, ttl %s, min refresh interval %s, max staleness %s", r.opts.cacheTTL, r.opts.minRefreshInterval, r.opts.maxStaleness)
+	}
+
+	return r, nil
+}
+
+// SetHTTPClient sets the client fetching the keys.
+func SetHTTPClient(httpClient *http.Client) RemoteKeysOption {
+	return func(o *RemoteKeysOptions) {
+		o.httpClient = httpClient
+	}
+}
+
+func SetCacheTTL(ttl time.Duration) RemoteKeysOption {
+	return func(o *RemoteKeysOptions) {
+		o.cacheTTL = ttl
+	}
+}
+
+// SetMinRefreshInterval limits the fetches caused by unknown key IDs, so
+// forged tokens cannot flood the endpoint.
+func SetMinRefreshInterval(interval time.Duration) RemoteKeysOption {
+	return func(o *RemoteKeysOptions) {
+		o.minRefreshInterval = interval
+	}
+}
+
+// SetMaxStaleness sets how long after their fetch expired keys are served
+// while the endpoint fails, keys older than that are refused. It is at least
+// the cache ttl.
+func SetMaxStaleness(staleness time.Duration) RemoteKeysOption {
+	return func(o *RemoteKeysOptions) {
+		o.maxStaleness = staleness
+	}
+}
+
+func (r *RemoteKeys) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	r.mu.Lock()
+	age := time.Since(r.fetchedAt)
+	fresh := age < r.opts.cacheTTL
+	canFetch := time.Since(r.attemptedAt) >= r.opts.minRefreshInterval
+	var key interface{}
+	err := fmt.Errorf("fetch jwks fail : %w", ErrKeyNotFound)
+	if r.keys != nil && age < r.opts.maxStaleness {
+		key, err = r.keys.Key(ctx, kid, alg)
+	}
+	if (err == nil && fresh) || !canFetch {
+		r.mu.Unlock()
+		return key, err
+	}
+	r.attemptedAt = time.Now()
+	r.mu.Unlock()
+
+	fetched := r.group.DoChan("", r.refresh)
+	// an expired key is served, an unavailable endpoint does not fail the
+	// tokens of cached keys until they are too stale
+	if err == nil {
+		return key, nil
+	}
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("fetch jwks fail : %w", ctx.Err())
+	case res := <-fetched:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(KeySet).Key(ctx, kid, alg)
+	}
+}
+
+// refresh fetches the keys and caches them. It is detached from the
+// lookups waiting for it, so one giving up does not fail the others.
+func (r *RemoteKeys) refresh() (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), FETCH_TIMEOUT)
+	defer cancel()
+	keys, err := r.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.keys = keys
+	r.fetchedAt = time.Now()
+	r.mu.Unlock()
+
+	return keys, nil
+}
+
+func (r *RemoteKeys) fetch(ctx context.Context) (KeySet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetch jwks fail : %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := r.opts.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch jwks fail : %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch jwks fail : status %d", resp.StatusCode)
+	}
+	var jwks JWKS
+	err = json.NewDecoder(io.LimitReader(resp.Body, MAX_JWKS_SIZE)).Decode(&jwks)
+	if err != nil {
+		return nil, fmt.Errorf("decode jwks fail : %w", err)
+	}
+	if len(jwks.Keys) == 0 {
+		return nil, errors.New("fetch jwks fail : no keys")
+	}
+
+	return jwks.KeySet(), nil
+}
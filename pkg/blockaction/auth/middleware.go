@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const MD_AUTHORIZATION = "authorization"
+
+type ctxKey int
+
+const ctxClaims ctxKey = iota
+
+// WithClaims returns a copy of ctx carrying the claims of the caller.
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, ctxClaims, claims)
+}
+
+// ClaimsFromContext returns the claims set by the middleware of the request.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(ctxClaims).(*Claims)
+	return claims, ok
+}
+
+// BearerToken returns the token of an Authorization header, empty when it
+// holds no bearer token.
+func BearerToken(authorization string) string {
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
+
+// Middleware verifies the bearer token of every request, answering 401
+// without one. The claims are in the request context.
+func Middleware(v *Verifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := v.Verify(r.Context(), BearerToken(r.Header.Get("Authorization")))
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// GinMiddleware is Middleware for gin, aborting with 401 without a valid
+// token.
+func GinMiddleware(v *Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := v.Verify(c.Request.Context(), BearerToken(c.GetHeader("Authorization")))
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Request = c.Request.WithContext(WithClaims(c.Request.Context(), claims))
+
+		c.Next()
+	}
+}
+
+// UnaryServerInterceptor verifies the bearer token of the authorization
+// metadata, answering Unauthenticated without one. The claims are in the
+// context of the handler.
+func UnaryServerInterceptor(v *Verifier) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := verifyMetadata(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streams.
+func StreamServerInterceptor(v *Verifier) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := verifyMetadata(ss.Context(), v)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &claimsStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func verifyMetadata(ctx context.Context, v *Verifier) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	if values := md.Get(MD_AUTHORIZATION); len(values) > 0 {
+		token = BearerToken(values[0])
+	}
+	claims, err := v.Verify(ctx, token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid authorization")
+	}
+
+	return WithClaims(ctx, claims), nil
+}
+
+type claimsStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *claimsStream) Context() context.Context {
+	return s.ctx
+}
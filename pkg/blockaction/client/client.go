@@ -0,0 +1,314 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/api"
+)
+
+const (
+	DEFAULT_MAX_RETRIES = 3
+	DEFAULT_MIN_BACKOFF = 100 * time.Millisecond
+	DEFAULT_MAX_BACKOFF = 2 * time.Second
+	// token 到期前多久先更新
+	REFRESH_BEFORE_EXPIRY = 30 * time.Second
+)
+
+// Client calls the BlockAction API. It keeps the tokens of the last signin
+// and refreshes them before they expire or when the API rejects them, safe
+// for concurrent use.
+type Client struct {
+	baseURL *url.URL
+	opts    ClientOptions
+
+	mu           sync.Mutex
+	token        string
+	refreshToken string
+	expiresAt    time.Time
+}
+
+type ClientOptions struct {
+	httpClient *http.Client
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	userAgent  string
+	language   string
+}
+
+type ClientOption func(*ClientOptions)
+
+func DefaultOptions() ClientOptions {
+	return ClientOptions{
+		httpClient: http.DefaultClient,
+		maxRetries: DEFAULT_MAX_RETRIES,
+		minBackoff: DEFAULT_MIN_BACKOFF,
+		maxBackoff: DEFAULT_MAX_BACKOFF,
+		userAgent:  "blockaction-go",
+	}
+}
+
+// New returns a client of the API served at baseURL, such as
+// https://api.example.com.
+func New(baseURL string, opts ...ClientOption) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid base url %q", baseURL)
+	}
+	c := &Client{baseURL: u, opts: DefaultOptions()}
+	for _, opt := range opts {
+		opt(&c.opts)
+	}
+	if c.opts.httpClient == nil {
+		return nil, fmt.Errorf("http client is nil")
+	}
+	if c.opts.maxRetries < 0 || c.opts.minBackoff < 0 || c.opts.maxBackoff < c.opts.minBackoff {
+		return nil, fmt.Errorf("invalid retry, max retries %d, backoff %s to %s", c.opts.maxRetries, c.opts.minBackoff, c.opts.maxBackoff)
+	}
+
+	return c, nil
+}
+
+// SetHTTPClient sets the client sending the requests, for its transport,
+// timeout or mTLS certificates.
+func SetHTTPClient(httpClient *http.Client) ClientOption {
+	return func(o *ClientOptions) {
+		o.httpClient = httpClient
+	}
+}
+
+// SetRetry retries idempotent calls up to maxRetries times, backing off
+// between minBackoff and maxBackoff. Zero maxRetries disables retries.
+func SetRetry(maxRetries int, minBackoff, maxBackoff time.Duration) ClientOption {
+	return func(o *ClientOptions) {
+		o.maxRetries = maxRetries
+		o.minBackoff = minBackoff
+		o.maxBackoff = maxBackoff
+	}
+}
+
+// SetUserAgent names the client in the User-Agent header, such as
+// billing/1.4.0.
+func SetUserAgent(userAgent string) ClientOption {
+	return func(o *ClientOptions) {
+		o.userAgent = userAgent
+	}
+}
+
+// SetLanguage sets the Accept-Language of error messages.
+func SetLanguage(language string) ClientOption {
+	return func(o *ClientOptions) {
+		o.language = language
+	}
+}
+
+// SetTokens resumes a session with tokens of an earlier signin.
+func (c *Client) SetTokens(token, refreshToken string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setTokens(token, refreshToken)
+}
+
+// Tokens returns the current token and refresh token.
+func (c *Client) Tokens() (token, refreshToken string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.token, c.refreshToken
+}
+
+func (c *Client) Signup(ctx context.Context, req api.SignupReq) (*api.SignupResp, error) {
+	resp := &api.SignupResp{}
+	err := c.do(ctx, http.MethodPost, "/v1/signup", req, resp, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// Signin signs in and keeps the tokens for the calls needing them.
+func (c *Client) Signin(ctx context.Context, req api.SigninReq) (*api.SigninResp, error) {
+	resp := &api.SigninResp{}
+	err := c.do(ctx, http.MethodPost, "/v1/signin", req, resp, "")
+	if err != nil {
+		return nil, err
+	}
+	c.SetTokens(resp.Token, resp.RefreshToken)
+
+	return resp, nil
+}
+
+// Refresh replaces the tokens with new ones issued for the refresh token.
+func (c *Client) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.refresh(ctx)
+}
+
+func (c *Client) GetPersonalInfo(ctx context.Context) (*api.GetPersonalInfoResp, error) {
+	resp := &api.GetPersonalInfoResp{}
+	err := c.doAuthorized(ctx, http.MethodGet, "/v1/user/personal-info", nil, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// refresh must be called with mu held.
+func (c *Client) refresh(ctx context.Context) error {
+	if c.refreshToken == "" {
+		return fmt.Errorf("refresh token : %w", ErrNoToken)
+	}
+	resp := &api.SigninResp{}
+	err := c.do(ctx, http.MethodPost, "/v1/token/refresh", api.RefreshTokenReq{RefreshToken: c.refreshToken}, resp, "")
+	if err != nil {
+		return fmt.Errorf("refresh token : %w", err)
+	}
+	c.setTokens(resp.Token, resp.RefreshToken)
+
+	return nil
+}
+
+// setTokens must be called with mu held.
+func (c *Client) setTokens(token, refreshToken string) {
+	c.token = token
+	c.refreshToken = refreshToken
+	c.expiresAt = time.Time{}
+	// the expiry is only read to refresh in time, the API verifies the token
+	claims := &jwt.RegisteredClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(token, claims)
+	if err == nil && claims.ExpiresAt != nil {
+		c.expiresAt = claims.ExpiresAt.Time
+	}
+}
+
+// currentToken returns a token refreshed when it is about to expire.
+func (c *Client) currentToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == "" {
+		return "", ErrNoToken
+	}
+	if !c.expiresAt.IsZero() && time.Until(c.expiresAt) < REFRESH_BEFORE_EXPIRY && c.refreshToken != "" {
+		err := c.refresh(ctx)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return c.token, nil
+}
+
+// doAuthorized sends the request with the token, refreshing it once when
+// the API rejects it.
+func (c *Client) doAuthorized(ctx context.Context, method, path string, body, result interface{}) error {
+	token, err := c.currentToken(ctx)
+	if err != nil {
+		return err
+	}
+	err = c.do(ctx, method, path, body, result, token)
+	if !isUnauthorized(err) {
+		return err
+	}
+	c.mu.Lock()
+	// a concurrent call may have refreshed it already
+	if c.token == token {
+		if c.refreshToken == "" {
+			c.mu.Unlock()
+			return err
+		}
+		if refreshErr := c.refresh(ctx); refreshErr != nil {
+			c.mu.Unlock()
+			return refreshErr
+		}
+	}
+	token = c.token
+	c.mu.Unlock()
+
+	return c.do(ctx, method, path, body, result, token)
+}
+
+// do sends the request and decodes the result of the envelope, retrying
+// idempotent methods on network errors and retryable statuses.
+func (c *Client) do(ctx context.Context, method, path string, body, result interface{}, token string) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encode request fail : %w", err)
+		}
+	}
+	attempts := 1
+	if isIdempotent(method) {
+		attempts += c.opts.maxRetries
+	}
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			wait := backoff(attempt, c.opts.minBackoff, c.opts.maxBackoff, retryAfter(err))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		err = c.send(ctx, method, path, payload, result, token)
+		if err == nil || !isRetryable(ctx, err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+func (c *Client) send(ctx context.Context, method, path string, payload []byte, result interface{}, token string) error {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL.JoinPath(path).String(), body)
+	if err != nil {
+		return fmt.Errorf("new request fail : %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.opts.userAgent)
+	if c.opts.language != "" {
+		req.Header.Set("Accept-Language", c.opts.language)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.opts.httpClient.Do(req)
+	if err != nil {
+		return &networkError{err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return parseError(resp)
+	}
+	envelope := api.BaseResponse{Result: result}
+	err = json.NewDecoder(resp.Body).Decode(&envelope)
+	if err != nil {
+		return fmt.Errorf("decode response fail : %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/api"
+	"github.com/reddtsai/goAPI/pkg/blockaction/idgen"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+)
+
+// testServer serves the API on the memory storage, failing the next
+// requests of a path with a status first.
+type testServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests map[string]int
+	failures map[string][]int
+}
+
+func newTestServer(t *testing.T, opts ...api.BlockActionApiOption) *testServer {
+	ids, err := idgen.NewSnowflake(1)
+	require.NoError(t, err)
+	handler, err := api.NewBlockActionApi(append([]api.BlockActionApiOption{
+		api.SetStorage(storage.NewMemoryStorage()),
+		api.SetSecret("test-secret"),
+		api.SetIDGenerator(ids),
+	}, opts...)...)
+	require.NoError(t, err)
+	s := &testServer{requests: make(map[string]int), failures: make(map[string][]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		failures := s.failures[r.URL.Path]
+		if len(failures) > 0 {
+			s.failures[r.URL.Path] = failures[1:]
+		}
+		s.mu.Unlock()
+		if len(failures) > 0 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "unavailable", failures[0])
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *testServer) fail(path string, statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[path] = statuses
+}
+
+func (s *testServer) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+func newTestClient(t *testing.T, s *testServer) *Client {
+	c, err := New(s.URL, SetHTTPClient(s.Client()), SetRetry(2, time.Millisecond, 5*time.Millisecond))
+	require.NoError(t, err)
+	return c
+}
+
+func signup(t *testing.T, c *Client) {
+	_, err := c.Signup(context.Background(), api.SignupReq{Account: "testuser", Password: "abcd1234", UserName: "tester"})
+	require.NoError(t, err)
+	_, err = c.Signin(context.Background(), api.SigninReq{Account: "testuser", Password: "abcd1234"})
+	require.NoError(t, err)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("localhost:8080")
+	assert.Error(t, err)
+	_, err = New("http://localhost:8080", SetHTTPClient(nil))
+	assert.Error(t, err)
+	_, err = New("http://localhost:8080", SetRetry(1, time.Second, time.Millisecond))
+	assert.Error(t, err)
+}
+
+func TestClient(t *testing.T) {
+	s := newTestServer(t)
+	c := newTestClient(t, s)
+	ctx := context.Background()
+
+	_, err := c.GetPersonalInfo(ctx)
+	assert.ErrorIs(t, err, ErrNoToken)
+
+	signup(t, c)
+	info, err := c.GetPersonalInfo(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "testuser", info.Account)
+	assert.Equal(t, "tester", info.UserName)
+
+	_, err = c.Signup(ctx, api.SignupReq{Account: "testuser", Password: "abcd1234", UserName: "tester"})
+	assert.ErrorIs(t, err, api.ErrAccountExists)
+	var apiErr *Error
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusConflict, apiErr.StatusCode)
+	assert.NotEmpty(t, apiErr.RequestID)
+
+	_, err = c.Signup(ctx, api.SignupReq{Account: "test", Password: "abcd1234", UserName: "tester"})
+	assert.ErrorIs(t, err, api.ErrValidation)
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "account", apiErr.Details[0].Field)
+
+	_, err = c.Signin(ctx, api.SigninReq{Account: "testuser", Password: "wrong-password"})
+	assert.ErrorIs(t, err, api.ErrInvalidCredentials)
+}
+
+func TestClientRefresh(t *testing.T) {
+	// tokens expiring within REFRESH_BEFORE_EXPIRY are refreshed first
+	s := newTestServer(t, api.SetTokenTTL(10*time.Second))
+	c := newTestClient(t, s)
+	ctx := context.Background()
+	signup(t, c)
+	_, err := c.GetPersonalInfo(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, s.count("/v1/token/refresh"))
+
+	// rejected tokens are refreshed once
+	s = newTestServer(t)
+	c = newTestClient(t, s)
+	signup(t, c)
+	_, refreshToken := c.Tokens()
+	c.SetTokens("expired", refreshToken)
+	info, err := c.GetPersonalInfo(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "testuser", info.Account)
+	assert.Equal(t, 1, s.count("/v1/token/refresh"))
+	assert.Equal(t, 2, s.count("/v1/user/personal-info"))
+
+	c.SetTokens("expired", "expired")
+	_, err = c.GetPersonalInfo(ctx)
+	assert.ErrorIs(t, err, api.ErrUnauthorized)
+}
+
+func TestClientRetry(t *testing.T) {
+	s := newTestServer(t)
+	c := newTestClient(t, s)
+	ctx := context.Background()
+	signup(t, c)
+
+	// idempotent calls are retried, the body of a proxy is not an envelope
+	s.fail("/v1/user/personal-info", http.StatusBadGateway, http.StatusServiceUnavailable)
+	_, err := c.GetPersonalInfo(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, s.count("/v1/user/personal-info"))
+
+	s.fail("/v1/user/personal-info", http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	_, err = c.GetPersonalInfo(ctx)
+	var apiErr *Error
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+	assert.Empty(t, apiErr.Code)
+	assert.Equal(t, 6, s.count("/v1/user/personal-info"))
+
+	// others are not
+	s.fail("/v1/signin", http.StatusServiceUnavailable)
+	_, err = c.Signin(ctx, api.SigninReq{Account: "testuser", Password: "abcd1234"})
+	assert.Error(t, err)
+	assert.Equal(t, 2, s.count("/v1/signin"))
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 1; attempt < 10; attempt++ {
+		d := backoff(attempt, 10*time.Millisecond, 100*time.Millisecond, 0)
+		assert.GreaterOrEqual(t, d, 10*time.Millisecond)
+		assert.LessOrEqual(t, d, 100*time.Millisecond)
+	}
+	assert.Equal(t, time.Second, backoff(1, 10*time.Millisecond, 100*time.Millisecond, time.Second))
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/api"
+)
+
+// 錯誤內容讀取上限
+const MAX_ERROR_BODY = 64 << 10
+
+var ErrNoToken = errors.New("not signed in")
+
+// Error is an error answered by the API. It matches the catalogue error of
+// its code, so errors.Is(err, api.ErrAccountExists) tells why a call failed.
+type Error struct {
+	StatusCode int
+	Code       string // 錯誤碼, 非 API 回應的錯誤為空
+	Message    string
+	RequestID  string
+	Details    []api.FieldError
+	RetryAfter time.Duration // 429, 503 的 Retry-After
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("blockaction api : %d %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("blockaction api : %d %s : %s (request id %s)", e.StatusCode, e.Code, e.Message, e.RequestID)
+}
+
+func (e *Error) Is(target error) bool {
+	apiErr, ok := target.(*api.ApiError)
+	return ok && e.Code != "" && apiErr.Code == e.Code
+}
+
+// networkError is a request that got no response.
+type networkError struct {
+	err error
+}
+
+func (e *networkError) Error() string {
+	return "blockaction api : " + e.err.Error()
+}
+
+func (e *networkError) Unwrap() error {
+	return e.err
+}
+
+// parseError reads the envelope of an error response, responses without
+// one, such as those of a proxy, keep their status text.
+func parseError(resp *http.Response) error {
+	e := &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	var envelope api.BaseResponse
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, MAX_ERROR_BODY))
+	if json.Unmarshal(body, &envelope) == nil && envelope.Error != nil {
+		e.Code = envelope.Error.Code
+		e.Message = envelope.Error.Message
+		e.RequestID = envelope.Error.RequestID
+		e.Details = envelope.Error.Details
+	}
+
+	return e
+}
+
+func isUnauthorized(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusUnauthorized
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func isIdempotent(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+// isRetryable reports whether another attempt may succeed, network errors
+// and overloaded or restarting servers.
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var netErr *networkError
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var e *Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+func retryAfter(err error) time.Duration {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.RetryAfter
+	}
+
+	return 0
+}
+
+// backoff returns the wait before an attempt, exponential with full jitter
+// and at least the Retry-After of the server.
+func backoff(attempt int, min, max, retryAfter time.Duration) time.Duration {
+	d := min << (attempt - 1)
+	if d > max || d <= 0 {
+		d = max
+	}
+	d = min + time.Duration(rand.Int63n(int64(d-min)+1))
+	if retryAfter > d {
+		return retryAfter
+	}
+
+	return d
+}
@@ -0,0 +1,611 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	ENV_PREFIX      = "BLOCKACTION"
+	ENV_DEVELOPMENT = "development"
+	ENV_PRODUCTION  = "production"
+
+	BACKEND_MYSQL    = "mysql"
+	BACKEND_POSTGRES = "postgres"
+	BACKEND_SQLITE   = "sqlite"
+	BACKEND_MEMORY   = "memory"
+	BACKEND_SHARDED  = "sharded"
+
+	NODE_ID_CONFIG = "config"
+	NODE_ID_ENV    = "env"
+	NODE_ID_LEASE  = "lease"
+
+	CACHE_LRU   = "lru"
+	CACHE_REDIS = "redis"
+)
+
+type Config struct {
+	Env       string       `mapstructure:"env" yaml:"env"`
+	Secret    SecretCfg    `mapstructure:"secret-options" yaml:"secret-options"`
+	Server    ServerCfg    `mapstructure:"server-options" yaml:"server-options"`
+	GRPC      GRPCCfg      `mapstructure:"grpc-options" yaml:"grpc-options"`
+	Storage   StorageCfg   `mapstructure:"storage-options" yaml:"storage-options"`
+	MySQL     MySQLCfg     `mapstructure:"mysql-options" yaml:"mysql-options"`
+	Postgres  PostgresCfg  `mapstructure:"postgres-options" yaml:"postgres-options"`
+	SQLite    SQLiteCfg    `mapstructure:"sqlite-options" yaml:"sqlite-options"`
+	Shard     ShardCfg     `mapstructure:"shard-options" yaml:"shard-options"`
+	IDGen     IDGenCfg     `mapstructure:"idgen-options" yaml:"idgen-options"`
+	Cache     CacheCfg     `mapstructure:"cache-options" yaml:"cache-options"`
+	Auth      AuthCfg      `mapstructure:"auth-options" yaml:"auth-options"`
+	CORS      CORSCfg      `mapstructure:"cors-options" yaml:"cors-options"`
+	RateLimit RateLimitCfg `mapstructure:"rate-limit-options" yaml:"rate-limit-options"`
+	Version   VersionCfg   `mapstructure:"version-options" yaml:"version-options"`
+	Log       LogCfg       `mapstructure:"log-options" yaml:"log-options"`
+}
+
+type SecretCfg struct {
+	VaultFile string `mapstructure:"vault-file" yaml:"vault-file"`
+}
+
+type ServerCfg struct {
+	Port              int           `mapstructure:"port" yaml:"port"`
+	ReadTimeout       time.Duration `mapstructure:"read-timeout" yaml:"read-timeout"`
+	ReadHeaderTimeout time.Duration `mapstructure:"read-header-timeout" yaml:"read-header-timeout"`
+	WriteTimeout      time.Duration `mapstructure:"write-timeout" yaml:"write-timeout"`
+	IdleTimeout       time.Duration `mapstructure:"idle-timeout" yaml:"idle-timeout"`
+	ShutdownDelay     time.Duration `mapstructure:"shutdown-delay" yaml:"shutdown-delay"`
+	ShutdownTimeout   time.Duration `mapstructure:"shutdown-timeout" yaml:"shutdown-timeout"`
+	HookTimeout       time.Duration `mapstructure:"hook-timeout" yaml:"hook-timeout"`       // shutdown hooks 的時限, 不佔用 shutdown-timeout
+	TrustedProxies    []string      `mapstructure:"trusted-proxies" yaml:"trusted-proxies"` // 可信任 X-Forwarded-For 的 IP 或 CIDR
+	TLS               TLSCfg        `mapstructure:"tls" yaml:"tls"`
+}
+
+type TLSCfg struct {
+	CertFile       string        `mapstructure:"cert-file" yaml:"cert-file"`
+	KeyFile        string        `mapstructure:"key-file" yaml:"key-file"`
+	MinVersion     string        `mapstructure:"min-version" yaml:"min-version"`
+	ClientCAFile   string        `mapstructure:"client-ca-file" yaml:"client-ca-file"`
+	ClientAuth     string        `mapstructure:"client-auth" yaml:"client-auth"`
+	ReloadInterval time.Duration `mapstructure:"reload-interval" yaml:"reload-interval"`
+}
+
+// GRPCCfg serves the gRPC API next to HTTP, with the tls settings of
+// server-options. A zero port disables it.
+type GRPCCfg struct {
+	Port int `mapstructure:"port" yaml:"port"`
+}
+
+type StorageCfg struct {
+	Backend        string `mapstructure:"backend" yaml:"backend"` // mysql, postgres, sqlite, memory, sharded
+	MigrateOnStart bool   `mapstructure:"migrate-on-start" yaml:"migrate-on-start"`
+}
+
+type MySQLCfg struct {
+	DSN             string        `mapstructure:"dsn" yaml:"dsn" secret:"true"`
+	Addr            string        `mapstructure:"addr" yaml:"addr"`
+	Username        string        `mapstructure:"username" yaml:"username"`
+	Password        string        `mapstructure:"password" yaml:"password" secret:"true"`
+	DB              string        `mapstructure:"db" yaml:"db"`
+	MaxOpenConn     int           `mapstructure:"max-open-conn" yaml:"max-open-conn"`
+	MaxIdleConn     int           `mapstructure:"max-idle-conn" yaml:"max-idle-conn"`
+	ConnMaxLifetime int           `mapstructure:"conn-max-lifetime" yaml:"conn-max-lifetime"` // 秒
+	ConnectTimeout  time.Duration `mapstructure:"connect-timeout" yaml:"connect-timeout"`
+	QueryTimeout    time.Duration `mapstructure:"query-timeout" yaml:"query-timeout"`
+	Replicas        []string      `mapstructure:"replicas" yaml:"replicas"` // 唯讀副本位址
+}
+
+type PostgresCfg struct {
+	DSN             string        `mapstructure:"dsn" yaml:"dsn" secret:"true"`
+	Addr            string        `mapstructure:"addr" yaml:"addr"`
+	Username        string        `mapstructure:"username" yaml:"username"`
+	Password        string        `mapstructure:"password" yaml:"password" secret:"true"`
+	DB              string        `mapstructure:"db" yaml:"db"`
+	SSLMode         string        `mapstructure:"sslmode" yaml:"sslmode"`
+	MaxOpenConn     int           `mapstructure:"max-open-conn" yaml:"max-open-conn"`
+	MaxIdleConn     int           `mapstructure:"max-idle-conn" yaml:"max-idle-conn"`
+	ConnMaxLifetime int           `mapstructure:"conn-max-lifetime" yaml:"conn-max-lifetime"` // 秒
+	ConnectTimeout  time.Duration `mapstructure:"connect-timeout" yaml:"connect-timeout"`
+	QueryTimeout    time.Duration `mapstructure:"query-timeout" yaml:"query-timeout"`
+}
+
+type SQLiteCfg struct {
+	File string `mapstructure:"file" yaml:"file"`
+}
+
+// IDGenCfg selects where the snowflake node ID of the instance comes from,
+// instances sharing a node ID can generate the same IDs.
+type IDGenCfg struct {
+	Source            string        `mapstructure:"source" yaml:"source"`   // config, env, lease
+	NodeID            int64         `mapstructure:"node-id" yaml:"node-id"` // source 為 config 時使用
+	Env               string        `mapstructure:"env" yaml:"env"`         // 例: NODE_ID 或 StatefulSet 的 POD_NAME
+	LeaseTTL          time.Duration `mapstructure:"lease-ttl" yaml:"lease-ttl"`
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat-interval" yaml:"heartbeat-interval"`
+}
+
+type CacheCfg struct {
+	Backend     string        `mapstructure:"backend" yaml:"backend"` // empty disables, lru, redis
+	TTL         time.Duration `mapstructure:"ttl" yaml:"ttl"`
+	NegativeTTL time.Duration `mapstructure:"negative-ttl" yaml:"negative-ttl"`
+	Size        int           `mapstructure:"size" yaml:"size"` // lru 筆數上限
+	KeyPrefix   string        `mapstructure:"key-prefix" yaml:"key-prefix"`
+	Redis       RedisCfg      `mapstructure:"redis" yaml:"redis"`
+}
+
+type RedisCfg struct {
+	Addr     string `mapstructure:"addr" yaml:"addr"`
+	Password string `mapstructure:"password" yaml:"password" secret:"true"`
+	DB       int    `mapstructure:"db" yaml:"db"`
+}
+
+type AuthCfg struct {
+	Secret            string        `mapstructure:"secret" yaml:"secret" secret:"true"`
+	SigningKey        string        `mapstructure:"signing-key" yaml:"signing-key" secret:"true"` // PEM 私鑰, 空值以 secret 簽 HS256
+	Audience          []string      `mapstructure:"audience" yaml:"audience"`
+	TokenTTL          time.Duration `mapstructure:"token-ttl" yaml:"token-ttl"`
+	RefreshTTL        time.Duration `mapstructure:"refresh-ttl" yaml:"refresh-ttl"`                 // refresh token 有效期
+	LegacySecretUntil string        `mapstructure:"legacy-secret-until" yaml:"legacy-secret-until"` // RFC 3339, 設定 signing-key 後仍接受 secret 簽的 token 至此
+	TrustedClients    []string      `mapstructure:"trusted-clients" yaml:"trusted-clients"`
+	AdminClients      []string      `mapstructure:"admin-clients" yaml:"admin-clients"` // 可呼叫 admin 端點的 mTLS 身分
+}
+
+// LegacySecretDeadline returns the parsed legacy-secret-until, zero when
+// unset.
+func (a AuthCfg) LegacySecretDeadline() (time.Time, error) {
+	if a.LegacySecretUntil == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, a.LegacySecretUntil)
+}
+
+type CORSCfg struct {
+	AllowOrigins     []string      `mapstructure:"allow-origins" yaml:"allow-origins"`
+	AllowMethods     []string      `mapstructure:"allow-methods" yaml:"allow-methods"`
+	AllowHeaders     []string      `mapstructure:"allow-headers" yaml:"allow-headers"`
+	ExposeHeaders    []string      `mapstructure:"expose-headers" yaml:"expose-headers"`
+	AllowCredentials bool          `mapstructure:"allow-credentials" yaml:"allow-credentials"`
+	MaxAge           time.Duration `mapstructure:"max-age" yaml:"max-age"`
+}
+
+// RateLimitCfg limits requests per client IP with a token bucket. A zero
+// RPS disables the limit.
+type RateLimitCfg struct {
+	RPS   float64 `mapstructure:"rps" yaml:"rps"`
+	Burst int     `mapstructure:"burst" yaml:"burst"`
+}
+
+// VersionCfg announces the deprecation of API versions.
+type VersionCfg struct {
+	V1      DeprecationCfg `mapstructure:"v1" yaml:"v1"`
+	Clients []string       `mapstructure:"clients" yaml:"clients"` // 計量時列出名稱的 User-Agent product
+}
+
+// DeprecationCfg dates are RFC 3339, an empty date sends no header.
+type DeprecationCfg struct {
+	DeprecatedAt string `mapstructure:"deprecated-at" yaml:"deprecated-at"` // Deprecation header
+	SunsetAt     string `mapstructure:"sunset-at" yaml:"sunset-at"`         // Sunset header, 停止服務時間
+	Link         string `mapstructure:"link" yaml:"link"`                   // 遷移說明文件
+}
+
+// Dates returns the parsed dates, zero when unset.
+func (d DeprecationCfg) Dates() (deprecatedAt, sunsetAt time.Time, err error) {
+	if d.DeprecatedAt != "" {
+		deprecatedAt, err = time.Parse(time.RFC3339, d.DeprecatedAt)
+		if err != nil {
+			return
+		}
+	}
+	if d.SunsetAt != "" {
+		sunsetAt, err = time.Parse(time.RFC3339, d.SunsetAt)
+	}
+
+	return
+}
+
+type LogCfg struct {
+	Level  string `mapstructure:"level" yaml:"level"`
+	Format string `mapstructure:"format" yaml:"format"`
+}
+
+var _defaults = map[string]interface{}{
+	"env":                                ENV_DEVELOPMENT,
+	"secret-options.vault-file":          "",
+	"server-options.port":                80,
+	"server-options.read-timeout":        15 * time.Second,
+	"server-options.read-header-timeout": 5 * time.Second,
+	"server-options.write-timeout":       30 * time.Second,
+	"server-options.idle-timeout":        120 * time.Second,
+	"server-options.shutdown-delay":      5 * time.Second,
+	"server-options.shutdown-timeout":    25 * time.Second,
+	"server-options.hook-timeout":        5 * time.Second,
+	"server-options.trusted-proxies":     []string{},
+	"server-options.tls.cert-file":       "",
+	"server-options.tls.key-file":        "",
+	"server-options.tls.min-version":     "1.2",
+	"server-options.tls.client-ca-file":  "",
+	"server-options.tls.client-auth":     "none",
+	"server-options.tls.reload-interval": time.Minute,
+	"grpc-options.port":                  0,
+	"storage-options.backend":            BACKEND_MYSQL,
+	"storage-options.migrate-on-start":   false,
+	"mysql-options.dsn":                  "",
+	"mysql-options.addr":                 "127.0.0.1:3306",
+	"mysql-options.username":             "",
+	"mysql-options.password":             "",
+	"mysql-options.db":                   "",
+	"mysql-options.max-open-conn":        20,
+	"mysql-options.max-idle-conn":        10,
+	"mysql-options.conn-max-lifetime":    300,
+	"mysql-options.connect-timeout":      5 * time.Second,
+	"mysql-options.query-timeout":        3 * time.Second,
+	"mysql-options.replicas":             []string{},
+	"postgres-options.dsn":               "",
+	"postgres-options.addr":              "127.0.0.1:5432",
+	"postgres-options.username":          "",
+	"postgres-options.password":          "",
+	"postgres-options.db":                "",
+	"postgres-options.sslmode":           "disable",
+	"postgres-options.max-open-conn":     20,
+	"postgres-options.max-idle-conn":     10,
+	"postgres-options.conn-max-lifetime": 300,
+	"postgres-options.connect-timeout":   5 * time.Second,
+	"postgres-options.query-timeout":     3 * time.Second,
+	"sqlite-options.file":                "blockaction.db",
+	"shard-options.directory":            "",
+	"shard-options.shards":               []ShardNodeCfg{},
+	"idgen-options.source":               NODE_ID_CONFIG,
+	"idgen-options.node-id":              1,
+	"idgen-options.env":                  "NODE_ID",
+	"idgen-options.lease-ttl":            30 * time.Second,
+	"idgen-options.heartbeat-interval":   10 * time.Second,
+	"cache-options.backend":              "",
+	"cache-options.ttl":                  time.Minute,
+	"cache-options.negative-ttl":         10 * time.Second,
+	"cache-options.size":                 10000,
+	"cache-options.key-prefix":           "blockaction:",
+	"cache-options.redis.addr":           "127.0.0.1:6379",
+	"cache-options.redis.password":       "",
+	"cache-options.redis.db":             0,
+	"auth-options.secret":                "",
+	"auth-options.signing-key":           "",
+	"auth-options.audience":              []string{},
+	"auth-options.token-ttl":             900 * time.Second,
+	"auth-options.refresh-ttl":           7 * 24 * time.Hour,
+	"auth-options.legacy-secret-until":   "",
+	"auth-options.trusted-clients":       []string{},
+	"auth-options.admin-clients":         []string{},
+	"cors-options.allow-origins":         []string{"*"},
+	"cors-options.allow-methods":         []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
+	"cors-options.allow-headers":         []string{"Origin", "Content-Length", "Content-Type", "authorization", "X-Request-ID", "X-API-Key", "Accept-Language"},
+	"cors-options.expose-headers":        []string{"*"},
+	"cors-options.allow-credentials":     false,
+	"cors-options.max-age":               24 * time.Hour,
+	"rate-limit-options.rps":             0,
+	"rate-limit-options.burst":           20,
+	"version-options.v1.deprecated-at":   "",
+	"version-options.v1.sunset-at":       "",
+	"version-options.v1.link":            "",
+	"version-options.clients":            []string{"blockaction-go"},
+	"log-options.level":                  "info",
+	"log-options.format":                 "text",
+}
+
+var _logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// NewViper returns a viper reading the given config file, overridden by
+// BLOCKACTION_* environment variables, e.g. BLOCKACTION_MYSQL_OPTIONS_ADDR.
+func NewViper(path string) *viper.Viper {
+	v := viper.New()
+	for key, value := range _defaults {
+		v.SetDefault(key, value)
+	}
+	v.SetConfigFile(path)
+	if filepath.Ext(path) == "" {
+		v.SetConfigType("yaml")
+	}
+	v.SetEnvPrefix(ENV_PREFIX)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	v.AutomaticEnv()
+
+	return v
+}
+
+// Load reads the config file of v and returns the validated config. When
+// optional is set a missing file is allowed, so the service can be
+// configured by env only.
+func Load(v *viper.Viper, optional bool) (*Config, error) {
+	err := v.ReadInConfig()
+	if err != nil && !(optional && errors.Is(err, os.ErrNotExist)) {
+		return nil, fmt.Errorf("read config %s fail : %w", v.ConfigFileUsed(), err)
+	}
+
+	return Decode(v)
+}
+
+func Decode(v *viper.Viper) (*Config, error) {
+	cfg := new(Config)
+	err := v.Unmarshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("decode config fail : %w", err)
+	}
+	err = cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Validate reports every invalid setting at once, each prefixed with its key.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Env != ENV_DEVELOPMENT && c.Env != ENV_PRODUCTION {
+		invalid("env", "must be one of %s, %s, got %q", ENV_DEVELOPMENT, ENV_PRODUCTION, c.Env)
+	}
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		invalid("server-options.port", "must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	for _, t := range []struct {
+		key string
+		d   time.Duration
+	}{
+		{"server-options.read-timeout", c.Server.ReadTimeout},
+		{"server-options.read-header-timeout", c.Server.ReadHeaderTimeout},
+		{"server-options.write-timeout", c.Server.WriteTimeout},
+		{"server-options.idle-timeout", c.Server.IdleTimeout},
+		{"server-options.shutdown-timeout", c.Server.ShutdownTimeout},
+		{"server-options.hook-timeout", c.Server.HookTimeout},
+	} {
+		if t.d <= 0 {
+			invalid(t.key, "must be positive, got %s", t.d)
+		}
+	}
+	if c.Server.ShutdownDelay < 0 {
+		invalid("server-options.shutdown-delay", "must not be negative, got %s", c.Server.ShutdownDelay)
+	}
+	for i, proxy := range c.Server.TrustedProxies {
+		_, _, err := net.ParseCIDR(proxy)
+		if err != nil && net.ParseIP(proxy) == nil {
+			invalid(fmt.Sprintf("server-options.trusted-proxies[%d]", i), "must be an IP or CIDR, got %q", proxy)
+		}
+	}
+	if (c.Server.TLS.CertFile == "") != (c.Server.TLS.KeyFile == "") {
+		invalid("server-options.tls", "cert-file and key-file must be set together")
+	}
+	switch c.Server.TLS.MinVersion {
+	case "1.0", "1.1", "1.2", "1.3":
+	default:
+		invalid("server-options.tls.min-version", "must be one of 1.0, 1.1, 1.2, 1.3, got %q", c.Server.TLS.MinVersion)
+	}
+	switch c.Server.TLS.ClientAuth {
+	case "none", "request":
+	case "verify-if-given", "require":
+		if c.Server.TLS.ClientCAFile == "" {
+			invalid("server-options.tls.client-ca-file", "is required when client-auth is %q", c.Server.TLS.ClientAuth)
+		}
+	default:
+		invalid("server-options.tls.client-auth", "must be one of none, request, verify-if-given, require, got %q", c.Server.TLS.ClientAuth)
+	}
+
+	if c.GRPC.Port < 0 || c.GRPC.Port > 65535 {
+		invalid("grpc-options.port", "must be between 0 and 65535, got %d", c.GRPC.Port)
+	} else if c.GRPC.Port == c.Server.Port {
+		invalid("grpc-options.port", "must differ from server-options.port %d", c.Server.Port)
+	}
+
+	switch c.Storage.Backend {
+	case BACKEND_MYSQL, BACKEND_MEMORY:
+	case BACKEND_POSTGRES:
+		switch c.Postgres.SSLMode {
+		case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+		default:
+			invalid("postgres-options.sslmode", "must be one of disable, allow, prefer, require, verify-ca, verify-full, got %q", c.Postgres.SSLMode)
+		}
+	case BACKEND_SQLITE:
+		if c.SQLite.File == "" {
+			invalid("sqlite-options.file", "is required when backend is %q", c.Storage.Backend)
+		}
+	case BACKEND_SHARDED:
+		c.Shard.validate(invalid)
+		if c.MySQL.DSN != "" || len(c.MySQL.Replicas) > 0 {
+			invalid("mysql-options", "dsn and replicas are set per shard when backend is %q", c.Storage.Backend)
+		}
+		// addr and db are set per shard
+		validateSQL(invalid, "mysql-options", sqlCfg{
+			addr: "-", username: c.MySQL.Username, db: "-",
+			maxOpenConn: c.MySQL.MaxOpenConn, maxIdleConn: c.MySQL.MaxIdleConn, connMaxLifetime: c.MySQL.ConnMaxLifetime,
+			connectTimeout: c.MySQL.ConnectTimeout, queryTimeout: c.MySQL.QueryTimeout,
+		})
+	default:
+		invalid("storage-options.backend", "must be one of %s, %s, %s, %s, %s, got %q", BACKEND_MYSQL, BACKEND_POSTGRES, BACKEND_SQLITE, BACKEND_MEMORY, BACKEND_SHARDED, c.Storage.Backend)
+	}
+	if c.Storage.Backend == BACKEND_MYSQL {
+		validateSQL(invalid, "mysql-options", sqlCfg{
+			dsn: c.MySQL.DSN, addr: c.MySQL.Addr, username: c.MySQL.Username, db: c.MySQL.DB,
+			maxOpenConn: c.MySQL.MaxOpenConn, maxIdleConn: c.MySQL.MaxIdleConn, connMaxLifetime: c.MySQL.ConnMaxLifetime,
+			connectTimeout: c.MySQL.ConnectTimeout, queryTimeout: c.MySQL.QueryTimeout,
+		})
+		if c.MySQL.DSN != "" && len(c.MySQL.Replicas) > 0 {
+			invalid("mysql-options.replicas", "cannot be combined with dsn, replicas reuse addr credentials")
+		}
+		for i, addr := range c.MySQL.Replicas {
+			if addr == "" || addr == c.MySQL.Addr {
+				invalid(fmt.Sprintf("mysql-options.replicas[%d]", i), "must be a non-empty address other than addr")
+			}
+		}
+	}
+	if c.Storage.Backend == BACKEND_POSTGRES {
+		validateSQL(invalid, "postgres-options", sqlCfg{
+			dsn: c.Postgres.DSN, addr: c.Postgres.Addr, username: c.Postgres.Username, db: c.Postgres.DB,
+			maxOpenConn: c.Postgres.MaxOpenConn, maxIdleConn: c.Postgres.MaxIdleConn, connMaxLifetime: c.Postgres.ConnMaxLifetime,
+			connectTimeout: c.Postgres.ConnectTimeout, queryTimeout: c.Postgres.QueryTimeout,
+		})
+	}
+
+	switch c.IDGen.Source {
+	case NODE_ID_CONFIG:
+		if c.IDGen.NodeID < 0 {
+			invalid("idgen-options.node-id", "must not be negative, got %d", c.IDGen.NodeID)
+		}
+	case NODE_ID_ENV:
+		if c.IDGen.Env == "" {
+			invalid("idgen-options.env", "is required when source is %q", c.IDGen.Source)
+		}
+	case NODE_ID_LEASE:
+		if c.Storage.Backend == BACKEND_MEMORY {
+			invalid("idgen-options.source", "%q needs a database backend", c.IDGen.Source)
+		}
+		if c.IDGen.HeartbeatInterval <= 0 || c.IDGen.HeartbeatInterval*2 > c.IDGen.LeaseTTL {
+			invalid("idgen-options.heartbeat-interval", "must be positive and at most half of lease-ttl, got %s", c.IDGen.HeartbeatInterval)
+		}
+	default:
+		invalid("idgen-options.source", "must be one of %s, %s, %s, got %q", NODE_ID_CONFIG, NODE_ID_ENV, NODE_ID_LEASE, c.IDGen.Source)
+	}
+
+	switch c.Cache.Backend {
+	case "":
+	case CACHE_LRU, CACHE_REDIS:
+		if c.Cache.TTL <= 0 {
+			invalid("cache-options.ttl", "must be positive, got %s", c.Cache.TTL)
+		}
+		if c.Cache.NegativeTTL < 0 {
+			invalid("cache-options.negative-ttl", "must not be negative, got %s", c.Cache.NegativeTTL)
+		}
+		if c.Cache.Backend == CACHE_LRU && c.Cache.Size <= 0 {
+			invalid("cache-options.size", "must be positive, got %d", c.Cache.Size)
+		}
+		if c.Cache.Backend == CACHE_REDIS && c.Cache.Redis.Addr == "" {
+			invalid("cache-options.redis.addr", "is required when backend is %q", c.Cache.Backend)
+		}
+	default:
+		invalid("cache-options.backend", "must be empty or one of %s, %s, got %q", CACHE_LRU, CACHE_REDIS, c.Cache.Backend)
+	}
+
+	if c.Auth.Secret == "" {
+		invalid("auth-options.secret", "is required")
+	}
+	if c.Auth.TokenTTL <= 0 {
+		invalid("auth-options.token-ttl", "must be positive, got %s", c.Auth.TokenTTL)
+	}
+	if c.Auth.RefreshTTL <= 0 {
+		invalid("auth-options.refresh-ttl", "must be positive, got %s", c.Auth.RefreshTTL)
+	}
+	if _, err := c.Auth.LegacySecretDeadline(); err != nil {
+		invalid("auth-options.legacy-secret-until", "must be RFC 3339 : %s", err)
+	}
+
+	if len(c.CORS.AllowOrigins) == 0 {
+		invalid("cors-options.allow-origins", "must not be empty")
+	}
+	for _, origin := range c.CORS.AllowOrigins {
+		if origin == "*" && c.CORS.AllowCredentials {
+			invalid("cors-options.allow-origins", "must not contain * when allow-credentials is set")
+		}
+		if origin != "*" && strings.Count(origin, "*") > 1 {
+			invalid("cors-options.allow-origins", "must hold at most one * per origin, got %q", origin)
+		}
+	}
+	if c.CORS.MaxAge < 0 {
+		invalid("cors-options.max-age", "must not be negative, got %s", c.CORS.MaxAge)
+	}
+
+	if c.RateLimit.RPS < 0 {
+		invalid("rate-limit-options.rps", "must not be negative, got %v", c.RateLimit.RPS)
+	}
+	if c.RateLimit.RPS > 0 && c.RateLimit.Burst < 1 {
+		invalid("rate-limit-options.burst", "must be at least 1, got %d", c.RateLimit.Burst)
+	}
+
+	deprecatedAt, sunsetAt, err := c.Version.V1.Dates()
+	if err != nil {
+		invalid("version-options.v1", "dates must be RFC 3339 : %s", err)
+	} else if !deprecatedAt.IsZero() && !sunsetAt.IsZero() && sunsetAt.Before(deprecatedAt) {
+		invalid("version-options.v1.sunset-at", "must not be before deprecated-at")
+	}
+
+	if _, ok := _logLevels[c.Log.Level]; !ok {
+		invalid("log-options.level", "must be one of debug, info, warn, error, got %q", c.Log.Level)
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		invalid("log-options.format", "must be one of text, json, got %q", c.Log.Format)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config :\n%w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// sqlCfg holds the settings MySQLCfg and PostgresCfg share.
+type sqlCfg struct {
+	dsn, addr, username, db                   string
+	maxOpenConn, maxIdleConn, connMaxLifetime int
+	connectTimeout, queryTimeout              time.Duration
+}
+
+func validateSQL(invalid func(key, format string, args ...interface{}), prefix string, c sqlCfg) {
+	if c.dsn == "" {
+		if c.addr == "" {
+			invalid(prefix+".addr", "is required")
+		}
+		if c.username == "" {
+			invalid(prefix+".username", "is required")
+		}
+		if c.db == "" {
+			invalid(prefix+".db", "is required")
+		}
+	}
+	if c.maxOpenConn < 0 {
+		invalid(prefix+".max-open-conn", "must not be negative, got %d", c.maxOpenConn)
+	}
+	if c.maxIdleConn < 0 {
+		invalid(prefix+".max-idle-conn", "must not be negative, got %d", c.maxIdleConn)
+	}
+	if c.maxOpenConn > 0 && c.maxIdleConn > c.maxOpenConn {
+		invalid(prefix+".max-idle-conn", "must not exceed max-open-conn %d, got %d", c.maxOpenConn, c.maxIdleConn)
+	}
+	if c.connMaxLifetime < 0 {
+		invalid(prefix+".conn-max-lifetime", "must not be negative, got %d", c.connMaxLifetime)
+	}
+	if c.connectTimeout <= 0 {
+		invalid(prefix+".connect-timeout", "must be positive, got %s", c.connectTimeout)
+	}
+	if c.queryTimeout < 0 {
+		invalid(prefix+".query-timeout", "must not be negative, got %s", c.queryTimeout)
+	}
+}
+
+// ParseLogLevel returns the slog level of a validated log level name.
+func ParseLogLevel(level string) slog.Level {
+	return _logLevels[level]
+}
+
+// NewLogger builds the process logger from the log options. The level is
+// read from level so it can change at runtime.
+func (c LogCfg) NewLogger(level *slog.LevelVar) *slog.Logger {
+	level.Set(ParseLogLevel(c.Level))
+	opts := &slog.HandlerOptions{Level: level}
+	if c.Format == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts))
+	}
+
+	return slog.New(slog.NewTextHandler(os.Stderr, opts))
+}
@@ -0,0 +1,254 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(content), 0600)
+	assert.Nil(t, err)
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfig(t, `
+mysql-options:
+  username: "root"
+  password: "pwd"
+  db: "blockaction"
+  max-open-conn: 50
+auth-options:
+  secret: "env:TEST_AUTH_SECRET"
+  token-ttl: 30m
+`)
+	t.Setenv("BLOCKACTION_SERVER_OPTIONS_PORT", "8080")
+	t.Setenv("BLOCKACTION_CORS_OPTIONS_ALLOW_ORIGINS", "https://a.example,https://b.example")
+
+	cfg, err := Load(NewViper(path), false)
+	assert.Nil(t, err)
+	assert.Equal(t, 8080, cfg.Server.Port)
+	assert.Equal(t, 50, cfg.MySQL.MaxOpenConn)
+	assert.Equal(t, 10, cfg.MySQL.MaxIdleConn)
+	assert.Equal(t, 30*time.Minute, cfg.Auth.TokenTTL)
+	assert.Equal(t, []string{"https://a.example", "https://b.example"}, cfg.CORS.AllowOrigins)
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	_, err := Load(NewViper(path), false)
+	assert.NotNil(t, err)
+
+	t.Setenv("BLOCKACTION_MYSQL_OPTIONS_USERNAME", "root")
+	t.Setenv("BLOCKACTION_MYSQL_OPTIONS_DB", "blockaction")
+	t.Setenv("BLOCKACTION_AUTH_OPTIONS_SECRET", "secret")
+	_, err = Load(NewViper(path), true)
+	assert.Nil(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	path := writeConfig(t, `
+server-options:
+  port: 0
+  trusted-proxies: ["10.0.0.0/8", "lb"]
+mysql-options:
+  username: "root"
+  db: "blockaction"
+  max-open-conn: 5
+  max-idle-conn: 10
+  replicas:
+    - ""
+log-options:
+  level: "verbose"
+auth-options:
+  refresh-ttl: 0s
+  legacy-secret-until: "tomorrow"
+cors-options:
+  allow-origins: ["*", "https://*.*.example.com"]
+  allow-credentials: true
+`)
+	_, err := Load(NewViper(path), false)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "server-options.port")
+	assert.Contains(t, err.Error(), "server-options.trusted-proxies[1]")
+	assert.NotContains(t, err.Error(), "server-options.trusted-proxies[0]")
+	assert.Contains(t, err.Error(), "cors-options.allow-origins: must not contain * when allow-credentials is set")
+	assert.Contains(t, err.Error(), `cors-options.allow-origins: must hold at most one * per origin, got "https://*.*.example.com"`)
+	assert.Contains(t, err.Error(), "mysql-options.max-idle-conn")
+	assert.Contains(t, err.Error(), "mysql-options.replicas[0]")
+	assert.Contains(t, err.Error(), "log-options.level")
+	assert.Contains(t, err.Error(), "auth-options.refresh-ttl")
+	assert.Contains(t, err.Error(), "auth-options.legacy-secret-until")
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Config{}
+	cfg.MySQL.Password = "pwd"
+	cfg.MySQL.Username = "root"
+	redacted := cfg.Redacted()
+	assert.Equal(t, REDACTED, redacted.MySQL.Password)
+	assert.Equal(t, "root", redacted.MySQL.Username)
+	assert.Equal(t, "", redacted.Auth.Secret)
+	assert.Equal(t, "pwd", cfg.MySQL.Password)
+}
+
+func TestResolveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "db"), []byte("db-password\n"), 0600)
+	assert.Nil(t, err)
+	t.Setenv("TEST_AUTH_SECRET", "auth-secret")
+
+	cfg := Config{Env: ENV_DEVELOPMENT}
+	cfg.MySQL.Password = "file://" + filepath.Join(dir, "db")
+	cfg.Auth.Secret = "env:TEST_AUTH_SECRET"
+	err = cfg.ResolveSecrets(context.Background(), cfg.NewSecretResolver())
+	assert.Nil(t, err)
+	assert.Equal(t, "db-password", cfg.MySQL.Password)
+	assert.Equal(t, "auth-secret", cfg.Auth.Secret)
+
+	cfg.MySQL.Password = "env:TEST_UNSET_SECRET"
+	err = cfg.ResolveSecrets(context.Background(), cfg.NewSecretResolver())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "mysql-options.password")
+}
+
+func TestResolveSecretsProduction(t *testing.T) {
+	cfg := Config{Env: ENV_PRODUCTION}
+	cfg.MySQL.Password = "!QAZ2wsx"
+	cfg.Auth.Secret = "short"
+	err := cfg.ResolveSecrets(context.Background(), cfg.NewSecretResolver())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "mysql-options.password: a known default secret")
+	assert.Contains(t, err.Error(), "auth-options.secret: must be at least")
+
+	cfg.Env = ENV_DEVELOPMENT
+	err = cfg.ResolveSecrets(context.Background(), cfg.NewSecretResolver())
+	assert.Nil(t, err)
+}
+
+func TestValidateShards(t *testing.T) {
+	path := writeConfig(t, `
+storage-options:
+  backend: "sharded"
+mysql-options:
+  username: "root"
+shard-options:
+  directory: "shard9"
+  shards:
+    - name: "shard0"
+      addr: "db0:3306"
+      db: "blockaction"
+      slots: "0-600"
+    - name: "shard1"
+      addr: "db1:3306"
+      slots: "600-1000"
+`)
+	_, err := Load(NewViper(path), false)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "shard-options.shards[1].db")
+	assert.Contains(t, err.Error(), "shard-options.shards[1].slots: slot 600 is also owned by \"shard0\"")
+	assert.Contains(t, err.Error(), "shard-options.directory")
+	assert.NotContains(t, err.Error(), "mysql-options.addr")
+
+	cfg := ShardCfg{Shards: []ShardNodeCfg{
+		{Name: "shard0", Slots: "0-511"},
+		{Name: "shard1", Slots: "512-1022, 1023"},
+	}}
+	owners := cfg.SlotOwners()
+	assert.Len(t, owners, SHARD_SLOTS)
+	assert.Equal(t, "shard0", owners[511])
+	assert.Equal(t, "shard1", owners[512])
+	assert.Equal(t, "shard1", owners[1023])
+
+	_, err = ParseSlots("0-1024")
+	assert.NotNil(t, err)
+	_, err = ParseSlots("9-3")
+	assert.NotNil(t, err)
+}
+
+func TestValidateIDGen(t *testing.T) {
+	path := writeConfig(t, `
+storage-options:
+  backend: "memory"
+idgen-options:
+  source: "lease"
+  lease-ttl: 10s
+  heartbeat-interval: 6s
+`)
+	_, err := Load(NewViper(path), false)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "idgen-options.source: \"lease\" needs a database backend")
+	assert.Contains(t, err.Error(), "idgen-options.heartbeat-interval")
+
+	path = writeConfig(t, `
+idgen-options:
+  node-id: -1
+`)
+	_, err = Load(NewViper(path), false)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "idgen-options.node-id")
+}
+
+func TestValidateVersion(t *testing.T) {
+	path := writeConfig(t, `
+storage-options:
+  backend: "memory"
+version-options:
+  v1:
+    deprecated-at: "2026-01-01T00:00:00Z"
+    sunset-at: "2027-01-01T00:00:00Z"
+`)
+	t.Setenv("BLOCKACTION_AUTH_OPTIONS_SECRET", "secret")
+	cfg, err := Load(NewViper(path), false)
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, sunsetAt, err := cfg.Version.V1.Dates()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), sunsetAt)
+
+	path = writeConfig(t, `
+version-options:
+  v1:
+    deprecated-at: "2026-01-01"
+`)
+	_, err = Load(NewViper(path), false)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "version-options.v1: dates must be RFC 3339")
+
+	path = writeConfig(t, `
+version-options:
+  v1:
+    deprecated-at: "2026-01-01T00:00:00Z"
+    sunset-at: "2025-01-01T00:00:00Z"
+`)
+	_, err = Load(NewViper(path), false)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "version-options.v1.sunset-at")
+}
+
+func TestValidateGRPC(t *testing.T) {
+	path := writeConfig(t, `
+server-options:
+  port: 8080
+grpc-options:
+  port: 8080
+storage-options:
+  backend: "memory"
+`)
+	t.Setenv("BLOCKACTION_AUTH_OPTIONS_SECRET", "secret")
+	_, err := Load(NewViper(path), false)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "grpc-options.port: must differ from server-options.port 8080")
+
+	t.Setenv("BLOCKACTION_GRPC_OPTIONS_PORT", "9090")
+	cfg, err := Load(NewViper(path), false)
+	assert.Nil(t, err)
+	assert.Equal(t, 9090, cfg.GRPC.Port)
+}
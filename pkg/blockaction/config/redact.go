@@ -0,0 +1,20 @@
+package config
+
+import (
+	"reflect"
+)
+
+const REDACTED = "******"
+
+// Redacted returns a copy of the config with every field tagged
+// `secret:"true"` masked, safe to print or log. Unset secrets stay empty.
+func (c Config) Redacted() Config {
+	walkSecrets(reflect.ValueOf(&c).Elem(), "", func(key string, field reflect.Value) {
+		if field.String() == "" {
+			return
+		}
+		field.SetString(REDACTED)
+	})
+
+	return c
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	RELOAD_RESULT_APPLIED   = "applied"
+	RELOAD_RESULT_UNCHANGED = "unchanged"
+	RELOAD_RESULT_INVALID   = "invalid"
+	RELOAD_RESULT_ROLLBACK  = "rollback"
+)
+
+var (
+	_reloadMetrics = &ReloadMetrics{
+		ReloadTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "config_reload_total",
+				Help: "Config reload count by result",
+			},
+			[]string{"result"},
+		),
+		Version: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "config_version",
+				Help: "Version of the active runtime config, incremented on every applied reload",
+			},
+		),
+	}
+)
+
+// RuntimeCfg is the subset of the config that can change while the server
+// runs. Every other setting requires a restart.
+type RuntimeCfg struct {
+	AllowOrigins []string      `yaml:"allow-origins"`
+	RateLimit    RateLimitCfg  `yaml:"rate-limit"`
+	LogLevel     string        `yaml:"log-level"`
+	TokenTTL     time.Duration `yaml:"token-ttl"`
+}
+
+func (c *Config) Runtime() RuntimeCfg {
+	return RuntimeCfg{
+		AllowOrigins: c.CORS.AllowOrigins,
+		RateLimit:    c.RateLimit,
+		LogLevel:     c.Log.Level,
+		TokenTTL:     c.Auth.TokenTTL,
+	}
+}
+
+// withRuntime returns a copy of c with the runtime subset taken from r, used
+// to tell whether anything else changed.
+func (c Config) withRuntime(r RuntimeCfg) Config {
+	c.CORS.AllowOrigins = r.AllowOrigins
+	c.RateLimit = r.RateLimit
+	c.Log.Level = r.LogLevel
+	c.Auth.TokenTTL = r.TokenTTL
+
+	return c
+}
+
+// ReloadFunc applies a runtime config. It is called again with the previous
+// config when a later ReloadFunc fails.
+type ReloadFunc func(r RuntimeCfg) error
+
+type Version struct {
+	Version  int64     `json:"version"`
+	Checksum string    `json:"checksum"`
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+// Watcher reloads the runtime config when the config file changes. A new
+// config is validated first and applied to every ReloadFunc, or to none.
+type Watcher struct {
+	v       *viper.Viper
+	mu      sync.Mutex
+	cfg     *Config
+	version Version
+	reloads []ReloadFunc
+}
+
+func NewWatcher(v *viper.Viper, cfg *Config) *Watcher {
+	prometheus.Register(_reloadMetrics)
+	w := &Watcher{
+		v:   v,
+		cfg: cfg,
+		version: Version{
+			Version:  1,
+			Checksum: runtimeChecksum(cfg.Runtime()),
+			LoadedAt: time.Now(),
+		},
+	}
+	_reloadMetrics.Version.Set(1)
+
+	return w
+}
+
+func (w *Watcher) OnReload(fn ReloadFunc) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.reloads = append(w.reloads, fn)
+}
+
+func (w *Watcher) Version() Version {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.version
+}
+
+func (w *Watcher) Start() {
+	w.v.OnConfigChange(func(e fsnotify.Event) {
+		w.Reload()
+	})
+	w.v.WatchConfig()
+}
+
+// Reload re-reads the config file and applies its runtime subset, returning
+// the result recorded in the config_reload_total metric.
+func (w *Watcher) Reload() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	result, err := w.reload()
+	_reloadMetrics.ReloadTotal.WithLabelValues(result).Inc()
+	switch result {
+	case RELOAD_RESULT_APPLIED:
+		slog.Info("config reloaded", "event", "config_reload", "result", result, "version", w.version.Version, "checksum", w.version.Checksum)
+	case RELOAD_RESULT_INVALID, RELOAD_RESULT_ROLLBACK:
+		slog.Error("config reload rejected", "event", "config_reload", "result", result, "version", w.version.Version, "error", err)
+	}
+
+	return result
+}
+
+func (w *Watcher) reload() (string, error) {
+	err := w.v.ReadInConfig()
+	if err != nil {
+		return RELOAD_RESULT_INVALID, err
+	}
+	cfg, err := Decode(w.v)
+	if err != nil {
+		return RELOAD_RESULT_INVALID, err
+	}
+	// secrets are only resolved at startup, the file holds their references
+	copySecrets(cfg, w.cfg)
+	old, next := w.cfg.Runtime(), cfg.Runtime()
+	if !reflect.DeepEqual(cfg.withRuntime(old), *w.cfg) {
+		slog.Warn("config changed outside the runtime subset, restart to apply", "event", "config_reload")
+	}
+	if reflect.DeepEqual(old, next) {
+		return RELOAD_RESULT_UNCHANGED, nil
+	}
+
+	for i, fn := range w.reloads {
+		err = fn(next)
+		if err == nil {
+			continue
+		}
+		for j := i; j >= 0; j-- {
+			rollbackErr := w.reloads[j](old)
+			if rollbackErr != nil {
+				slog.Error("config rollback fail", "event", "config_reload", "error", rollbackErr)
+			}
+		}
+		return RELOAD_RESULT_ROLLBACK, fmt.Errorf("apply runtime config fail : %w", err)
+	}
+	applied := w.cfg.withRuntime(next)
+	w.cfg = &applied
+	w.version = Version{
+		Version:  w.version.Version + 1,
+		Checksum: runtimeChecksum(next),
+		LoadedAt: time.Now(),
+	}
+	_reloadMetrics.Version.Set(float64(w.version.Version))
+
+	return RELOAD_RESULT_APPLIED, nil
+}
+
+func runtimeChecksum(r RuntimeCfg) string {
+	b, _ := yaml.Marshal(r)
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:8])
+}
+
+type ReloadMetrics struct {
+	ReloadTotal *prometheus.CounterVec
+	Version     prometheus.Gauge
+}
+
+func (m *ReloadMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.ReloadTotal.Collect(ch)
+	m.Version.Collect(ch)
+}
+
+func (m *ReloadMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.ReloadTotal.Describe(ch)
+	m.Version.Describe(ch)
+}
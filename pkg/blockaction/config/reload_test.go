@@ -0,0 +1,87 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const reloadTestConfig = `
+mysql-options:
+  username: "root"
+  db: "blockaction"
+auth-options:
+  secret: "secret"
+  token-ttl: %s
+log-options:
+  level: "%s"
+`
+
+func TestWatcherReload(t *testing.T) {
+	path := writeConfig(t, fmt.Sprintf(reloadTestConfig, "15m", "info"))
+	v := NewViper(path)
+	cfg, err := Load(v, false)
+	assert.Nil(t, err)
+	w := NewWatcher(v, cfg)
+	var applied []RuntimeCfg
+	w.OnReload(func(r RuntimeCfg) error {
+		applied = append(applied, r)
+		return nil
+	})
+
+	assert.Equal(t, RELOAD_RESULT_UNCHANGED, w.Reload())
+
+	err = os.WriteFile(path, []byte(fmt.Sprintf(reloadTestConfig, "30m", "debug")), 0600)
+	assert.Nil(t, err)
+	assert.Equal(t, RELOAD_RESULT_APPLIED, w.Reload())
+	assert.Equal(t, 30*time.Minute, applied[0].TokenTTL)
+	assert.Equal(t, "debug", applied[0].LogLevel)
+	assert.Equal(t, int64(2), w.Version().Version)
+
+	err = os.WriteFile(path, []byte(fmt.Sprintf(reloadTestConfig, "-1m", "debug")), 0600)
+	assert.Nil(t, err)
+	assert.Equal(t, RELOAD_RESULT_INVALID, w.Reload())
+	assert.Len(t, applied, 1)
+	assert.Equal(t, int64(2), w.Version().Version)
+}
+
+func TestCopySecrets(t *testing.T) {
+	var src, dst Config
+	walkSecrets(reflect.ValueOf(&src).Elem(), "", func(key string, field reflect.Value) {
+		field.SetString("resolved " + key)
+	})
+	dst.MySQL.Password = "file:/run/secrets/mysql"
+	copySecrets(&dst, &src)
+	assert.Equal(t, src, dst)
+	assert.Equal(t, "resolved auth-options.signing-key", dst.Auth.SigningKey)
+}
+
+func TestWatcherRollback(t *testing.T) {
+	path := writeConfig(t, fmt.Sprintf(reloadTestConfig, "15m", "info"))
+	v := NewViper(path)
+	cfg, err := Load(v, false)
+	assert.Nil(t, err)
+	w := NewWatcher(v, cfg)
+	var active RuntimeCfg
+	w.OnReload(func(r RuntimeCfg) error {
+		active = r
+		return nil
+	})
+	w.OnReload(func(r RuntimeCfg) error {
+		if r.LogLevel == "warn" {
+			return errors.New("rejected")
+		}
+		return nil
+	})
+
+	err = os.WriteFile(path, []byte(fmt.Sprintf(reloadTestConfig, "30m", "warn")), 0600)
+	assert.Nil(t, err)
+	assert.Equal(t, RELOAD_RESULT_ROLLBACK, w.Reload())
+	assert.Equal(t, 15*time.Minute, active.TokenTTL)
+	assert.Equal(t, int64(1), w.Version().Version)
+}
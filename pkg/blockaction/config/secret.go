@@ -0,0 +1,96 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/secret"
+)
+
+const MIN_PRODUCTION_SECRET_LEN = 32
+
+// _defaultSecrets were committed to the repository at some point and must
+// never protect a production deployment.
+var _defaultSecrets = []string{
+	"!QAZ2wsx",
+	"8w+uSC4vD136hOaT1m1fWeuuULid9LiLSJ52kAPHC33bY9lK5/3ZAS+nm+HaJz93qCWDXcrJLl/9mcXzwUL3DQ==",
+}
+
+// NewSecretResolver returns the resolver for the secret references in the
+// config, with the local vault registered when configured.
+func (c *Config) NewSecretResolver() *secret.Resolver {
+	r := secret.NewResolver()
+	if c.Secret.VaultFile != "" {
+		r.Register("vault", secret.NewLocalVault(c.Secret.VaultFile))
+	}
+
+	return r
+}
+
+// ResolveSecrets replaces every field tagged `secret:"true"` holding a
+// reference such as env:DB_PASSWORD by the secret it references. In
+// production, known default secrets are refused.
+func (c *Config) ResolveSecrets(ctx context.Context, r *secret.Resolver) error {
+	var errs []error
+	walkSecrets(reflect.ValueOf(c).Elem(), "", func(key string, field reflect.Value) {
+		if field.String() == "" {
+			return
+		}
+		value, err := r.Resolve(ctx, field.String())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			return
+		}
+		field.SetString(value)
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config :\n%w", errors.Join(errs...))
+	}
+	if c.Env != ENV_PRODUCTION {
+		return nil
+	}
+
+	walkSecrets(reflect.ValueOf(c).Elem(), "", func(key string, field reflect.Value) {
+		if slices.Contains(_defaultSecrets, field.String()) {
+			errs = append(errs, fmt.Errorf("%s: a known default secret is not allowed in production", key))
+		}
+	})
+	if len(c.Auth.Secret) < MIN_PRODUCTION_SECRET_LEN {
+		errs = append(errs, fmt.Errorf("auth-options.secret: must be at least %d bytes in production", MIN_PRODUCTION_SECRET_LEN))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config :\n%w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// copySecrets sets every secret of dst to the one of src.
+func copySecrets(dst, src *Config) {
+	secrets := make(map[string]string)
+	walkSecrets(reflect.ValueOf(src).Elem(), "", func(key string, field reflect.Value) {
+		secrets[key] = field.String()
+	})
+	walkSecrets(reflect.ValueOf(dst).Elem(), "", func(key string, field reflect.Value) {
+		field.SetString(secrets[key])
+	})
+}
+
+// walkSecrets calls fn with every string field tagged `secret:"true"`, empty
+// ones included, keyed by its config key.
+func walkSecrets(v reflect.Value, prefix string, fn func(key string, field reflect.Value)) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		structField := v.Type().Field(i)
+		key := prefix + structField.Tag.Get("mapstructure")
+		switch {
+		case field.Kind() == reflect.Struct:
+			walkSecrets(field, key+".", fn)
+		case structField.Tag.Get("secret") == "true" && field.Kind() == reflect.String:
+			fn(key, field)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SHARD_SLOTS is the number of slots user IDs hash into. Shards own ranges
+// of slots, so resharding moves slots instead of rehashing every user.
+const SHARD_SLOTS = 1024
+
+type ShardCfg struct {
+	Directory string         `mapstructure:"directory" yaml:"directory"` // 存放帳號目錄的 shard
+	Shards    []ShardNodeCfg `mapstructure:"shards" yaml:"shards"`
+}
+
+// ShardNodeCfg is a MySQL database of the sharded backend, it shares the
+// credentials and pool settings of mysql-options.
+type ShardNodeCfg struct {
+	Name     string   `mapstructure:"name" yaml:"name"`
+	Addr     string   `mapstructure:"addr" yaml:"addr"`
+	DB       string   `mapstructure:"db" yaml:"db"`
+	Slots    string   `mapstructure:"slots" yaml:"slots"` // 例: 0-511,768-1023
+	Replicas []string `mapstructure:"replicas" yaml:"replicas"`
+}
+
+// SlotOwners returns the shard name of every slot of a validated config.
+func (c ShardCfg) SlotOwners() []string {
+	owners := make([]string, SHARD_SLOTS)
+	for _, node := range c.Shards {
+		ranges, _ := ParseSlots(node.Slots)
+		for _, r := range ranges {
+			for slot := r[0]; slot <= r[1]; slot++ {
+				owners[slot] = node.Name
+			}
+		}
+	}
+
+	return owners
+}
+
+// ParseSlots parses comma separated slots and inclusive slot ranges.
+func ParseSlots(s string) ([][2]int, error) {
+	var ranges [][2]int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		from, to, isRange := strings.Cut(part, "-")
+		if !isRange {
+			to = from
+		}
+		lo, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("invalid slot %q", part)
+		}
+		hi, err := strconv.Atoi(strings.TrimSpace(to))
+		if err != nil {
+			return nil, fmt.Errorf("invalid slot %q", part)
+		}
+		if lo < 0 || hi >= SHARD_SLOTS || lo > hi {
+			return nil, fmt.Errorf("slot range %q must be within 0-%d", part, SHARD_SLOTS-1)
+		}
+		ranges = append(ranges, [2]int{lo, hi})
+	}
+
+	return ranges, nil
+}
+
+func (c ShardCfg) validate(invalid func(key, format string, args ...interface{})) {
+	if len(c.Shards) == 0 {
+		invalid("shard-options.shards", "is required when backend is %q", BACKEND_SHARDED)
+		return
+	}
+	names := make(map[string]bool)
+	owners := make([]string, SHARD_SLOTS)
+	complete := true
+nodes:
+	for i, node := range c.Shards {
+		key := fmt.Sprintf("shard-options.shards[%d]", i)
+		if node.Name == "" || names[node.Name] {
+			invalid(key+".name", "must be unique and not empty, got %q", node.Name)
+		}
+		names[node.Name] = true
+		if node.Addr == "" {
+			invalid(key+".addr", "is required")
+		}
+		if node.DB == "" {
+			invalid(key+".db", "is required")
+		}
+		ranges, err := ParseSlots(node.Slots)
+		if err != nil {
+			invalid(key+".slots", "%s", err)
+			complete = false
+			continue
+		}
+		for _, r := range ranges {
+			for slot := r[0]; slot <= r[1]; slot++ {
+				if owners[slot] != "" {
+					invalid(key+".slots", "slot %d is also owned by %q", slot, owners[slot])
+					complete = false
+					continue nodes
+				}
+				owners[slot] = node.Name
+			}
+		}
+	}
+	for slot, owner := range owners {
+		if complete && owner == "" {
+			invalid("shard-options.shards", "slot %d has no shard, slots 0-%d must all be owned", slot, SHARD_SLOTS-1)
+			break
+		}
+	}
+	if !names[c.Directory] {
+		invalid("shard-options.directory", "must name a shard, got %q", c.Directory)
+	}
+}
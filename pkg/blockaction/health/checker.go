@@ -0,0 +1,31 @@
+package health
+
+import (
+	"context"
+	"fmt"
+)
+
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// PingChecker reports a dependency as healthy when it answers a ping.
+func PingChecker(p Pinger) Checker {
+	return CheckerFunc(p.Ping)
+}
+
+// MigrationChecker fails until the schema reaches the version the binary
+// was built against, so a replica is not served before migrations run.
+func MigrationChecker(current func(ctx context.Context) (int64, error), expected int64) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		version, err := current(ctx)
+		if err != nil {
+			return fmt.Errorf("get schema version fail : %w", err)
+		}
+		if version < expected {
+			return fmt.Errorf("schema version %d is behind expected %d", version, expected)
+		}
+
+		return nil
+	})
+}
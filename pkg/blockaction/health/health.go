@@ -0,0 +1,257 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	STATUS_OK   = "ok"
+	STATUS_FAIL = "fail"
+)
+
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+type Result struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Optional  bool      `json:"optional,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Duration  string    `json:"duration"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks,omitempty"`
+}
+
+func (r Report) OK() bool {
+	return r.Status == STATUS_OK
+}
+
+// Redacted returns the report without the check errors, which may hold
+// hosts or driver messages, for listeners reachable by anyone.
+func (r Report) Redacted() Report {
+	checks := make([]Result, len(r.Checks))
+	for i, c := range r.Checks {
+		c.Error = ""
+		checks[i] = c
+	}
+	r.Checks = checks
+
+	return r
+}
+
+type Health struct {
+	opts         HealthOptions
+	mu           sync.RWMutex
+	liveness     []*check
+	readiness    []*check
+	shuttingDown atomic.Bool
+}
+
+type HealthOptions struct {
+	timeout  time.Duration
+	cacheTTL time.Duration
+}
+
+type HealthOption func(*HealthOptions)
+
+func DefaultOptions() HealthOptions {
+	return HealthOptions{
+		timeout:  2 * time.Second,
+		cacheTTL: 1 * time.Second,
+	}
+}
+
+func SetTimeout(timeout time.Duration) HealthOption {
+	return func(o *HealthOptions) {
+		o.timeout = timeout
+	}
+}
+
+func SetCacheTTL(ttl time.Duration) HealthOption {
+	return func(o *HealthOptions) {
+		o.cacheTTL = ttl
+	}
+}
+
+func New(opts ...HealthOption) *Health {
+	h := new(Health)
+	h.opts = DefaultOptions()
+	for _, opt := range opts {
+		opt(&h.opts)
+	}
+
+	return h
+}
+
+// AddLivenessCheck registers a check that restarts the process when failing,
+// so it should only cover the process itself, never its dependencies.
+func (h *Health) AddLivenessCheck(name string, checker Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.liveness = append(h.liveness, h.newCheck(name, checker))
+}
+
+// AddReadinessCheck registers a check that takes the instance out of load
+// balancing while failing.
+func (h *Health) AddReadinessCheck(name string, checker Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.readiness = append(h.readiness, h.newCheck(name, checker))
+}
+
+// AddOptionalReadinessCheck registers a check that is reported but keeps the
+// instance ready while failing, for dependencies the service can route around.
+func (h *Health) AddOptionalReadinessCheck(name string, checker Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := h.newCheck(name, checker)
+	c.optional = true
+	h.readiness = append(h.readiness, c)
+}
+
+// Shutdown makes readiness fail from now on, so the instance is drained
+// before the server stops accepting connections.
+func (h *Health) Shutdown() {
+	h.shuttingDown.Store(true)
+}
+
+func (h *Health) IsShuttingDown() bool {
+	return h.shuttingDown.Load()
+}
+
+func (h *Health) Live(ctx context.Context) Report {
+	h.mu.RLock()
+	checks := h.liveness
+	h.mu.RUnlock()
+
+	return run(ctx, checks)
+}
+
+func (h *Health) Ready(ctx context.Context) Report {
+	h.mu.RLock()
+	checks := h.readiness
+	h.mu.RUnlock()
+
+	report := run(ctx, checks)
+	if h.IsShuttingDown() {
+		report.Status = STATUS_FAIL
+		report.Checks = append(report.Checks, Result{
+			Name:      "shutdown",
+			Status:    STATUS_FAIL,
+			Error:     "server is shutting down",
+			Duration:  "0s",
+			CheckedAt: time.Now(),
+		})
+	}
+
+	return report
+}
+
+func (h *Health) newCheck(name string, checker Checker) *check {
+	return &check{
+		name:     name,
+		checker:  checker,
+		timeout:  h.opts.timeout,
+		cacheTTL: h.opts.cacheTTL,
+	}
+}
+
+func run(ctx context.Context, checks []*check) Report {
+	report := Report{
+		Status: STATUS_OK,
+		Checks: make([]Result, len(checks)),
+	}
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+	for _, r := range report.Checks {
+		if r.Status != STATUS_OK && !r.Optional {
+			report.Status = STATUS_FAIL
+		}
+	}
+
+	return report
+}
+
+type check struct {
+	name     string
+	optional bool
+	checker  Checker
+	timeout  time.Duration
+	cacheTTL time.Duration
+
+	mu      sync.Mutex
+	last    Result
+	expires time.Time
+}
+
+// run serves the cached result while it is fresh. The lock is held during
+// the check so concurrent probes share a single call to the dependency. A
+// result is not cached when the caller gave up, as opposed to the check
+// timing out, since it says nothing about the dependency.
+func (c *check) run(ctx context.Context) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Now().Before(c.expires) {
+		return c.last
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	startTime := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errCh <- fmt.Errorf("check panic : %v", r)
+			}
+		}()
+		errCh <- c.checker.Check(checkCtx)
+	}()
+	var err error
+	select {
+	case err = <-errCh:
+	case <-checkCtx.Done():
+		err = fmt.Errorf("check timeout : %w", checkCtx.Err())
+	}
+
+	result := Result{
+		Name:      c.name,
+		Status:    STATUS_OK,
+		Optional:  c.optional,
+		Duration:  time.Since(startTime).String(),
+		CheckedAt: startTime,
+	}
+	if err != nil {
+		result.Status = STATUS_FAIL
+		result.Error = err.Error()
+	}
+	if ctx.Err() != nil {
+		return result
+	}
+	c.last = result
+	c.expires = time.Now().Add(c.cacheTTL)
+
+	return result
+}
@@ -0,0 +1,88 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReady(t *testing.T) {
+	h := New()
+	h.AddReadinessCheck("ok", CheckerFunc(func(ctx context.Context) error { return nil }))
+	assert.True(t, h.Ready(context.Background()).OK())
+
+	h.AddReadinessCheck("fail", CheckerFunc(func(ctx context.Context) error { return errors.New("down") }))
+	report := h.Ready(context.Background())
+	assert.False(t, report.OK())
+	assert.Equal(t, "down", report.Checks[1].Error)
+}
+
+func TestReadyShutdown(t *testing.T) {
+	h := New()
+	assert.True(t, h.Ready(context.Background()).OK())
+	h.Shutdown()
+	assert.False(t, h.Ready(context.Background()).OK())
+	assert.True(t, h.Live(context.Background()).OK())
+}
+
+func TestCheckTimeout(t *testing.T) {
+	h := New(SetTimeout(10 * time.Millisecond))
+	h.AddReadinessCheck("slow", CheckerFunc(func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}))
+	report := h.Ready(context.Background())
+	assert.False(t, report.OK())
+	assert.Contains(t, report.Checks[0].Error, "timeout")
+}
+
+func TestCheckCache(t *testing.T) {
+	var calls atomic.Int32
+	h := New(SetCacheTTL(time.Minute))
+	h.AddReadinessCheck("db", CheckerFunc(func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	}))
+	h.Ready(context.Background())
+	h.Ready(context.Background())
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestCheckCacheCallerGaveUp(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	h := New(SetCacheTTL(time.Minute))
+	h.AddReadinessCheck("db", CheckerFunc(func(ctx context.Context) error {
+		if down.Load() {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.False(t, h.Ready(ctx).OK())
+
+	// the failure of a probe that gave up is not served to the next one
+	down.Store(false)
+	assert.True(t, h.Ready(context.Background()).OK())
+}
+
+func TestMigrationChecker(t *testing.T) {
+	current := func(ctx context.Context) (int64, error) { return 2, nil }
+	assert.Nil(t, MigrationChecker(current, 2).Check(context.Background()))
+	assert.NotNil(t, MigrationChecker(current, 3).Check(context.Background()))
+}
+
+func TestReadyOptional(t *testing.T) {
+	h := New()
+	h.AddOptionalReadinessCheck("replica", CheckerFunc(func(ctx context.Context) error { return errors.New("down") }))
+	report := h.Ready(context.Background())
+	assert.True(t, report.OK())
+	assert.Equal(t, STATUS_FAIL, report.Checks[0].Status)
+	assert.True(t, report.Checks[0].Optional)
+}
@@ -0,0 +1,61 @@
+// Package idgen generates snowflake IDs, unique across instances as long as
+// every instance runs with its own node ID.
+package idgen
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/snowflake"
+)
+
+// MAX_NODE_ID is the highest node ID the snowflake layout holds.
+const MAX_NODE_ID = -1 ^ (-1 << 10)
+
+var ErrNoNodeID = errors.New("no snowflake node id available")
+
+// Snowflake generates IDs from one node, safe for concurrent use.
+type Snowflake struct {
+	node *snowflake.Node
+	id   int64
+}
+
+func NewSnowflake(nodeID int64) (*Snowflake, error) {
+	if nodeID < 0 || nodeID > MAX_NODE_ID {
+		return nil, fmt.Errorf("%w : node id %d is not within 0-%d", ErrNoNodeID, nodeID, MAX_NODE_ID)
+	}
+	node, err := snowflake.NewNode(nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Snowflake{node: node, id: nodeID}, nil
+}
+
+func (s *Snowflake) Generate() int64 {
+	return s.node.Generate().Int64()
+}
+
+func (s *Snowflake) NodeID() int64 {
+	return s.id
+}
+
+// NodeIDFromEnv reads the node ID from the environment variable name. The
+// value is the ID itself or a name ending in it, like the pod name api-2 of
+// a StatefulSet.
+func NodeIDFromEnv(name string) (int64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, fmt.Errorf("%w : %s is not set", ErrNoNodeID, name)
+	}
+	ordinal := value[strings.LastIndex(value, "-")+1:]
+	id, err := strconv.ParseInt(ordinal, 10, 64)
+	if err != nil || id < 0 || id > MAX_NODE_ID {
+		return 0, fmt.Errorf("%w : %s=%q does not end in a node id within 0-%d", ErrNoNodeID, name, value, MAX_NODE_ID)
+	}
+
+	return id, nil
+}
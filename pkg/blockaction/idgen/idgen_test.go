@@ -0,0 +1,113 @@
+package idgen
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+)
+
+func TestNewSnowflake(t *testing.T) {
+	_, err := NewSnowflake(MAX_NODE_ID + 1)
+	assert.ErrorIs(t, err, ErrNoNodeID)
+	_, err = NewSnowflake(-1)
+	assert.ErrorIs(t, err, ErrNoNodeID)
+
+	a, err := NewSnowflake(1)
+	require.NoError(t, err)
+	b, err := NewSnowflake(2)
+	require.NoError(t, err)
+	assert.NotEqual(t, a.Generate(), b.Generate())
+	assert.Equal(t, int64(2), b.NodeID())
+}
+
+func TestNodeIDFromEnv(t *testing.T) {
+	for value, expected := range map[string]int64{
+		"7":                  7,
+		"blockaction-api-12": 12,
+		"1023":               1023,
+	} {
+		t.Setenv("TEST_NODE_ID", value)
+		id, err := NodeIDFromEnv("TEST_NODE_ID")
+		require.NoError(t, err, value)
+		assert.Equal(t, expected, id, value)
+	}
+	for _, value := range []string{"", "api", "api-1024", "api-x"} {
+		t.Setenv("TEST_NODE_ID", value)
+		_, err := NodeIDFromEnv("TEST_NODE_ID")
+		assert.ErrorIs(t, err, ErrNoNodeID, value)
+	}
+}
+
+type fakeLeaser struct {
+	mu       sync.Mutex
+	acquire  error
+	renew    error
+	renewed  int
+	released bool
+}
+
+func (f *fakeLeaser) AcquireNodeID(ctx context.Context, owner string, maxID int64, ttl time.Duration) (int64, error) {
+	return 5, f.acquire
+}
+
+func (f *fakeLeaser) RenewNodeID(ctx context.Context, id int64, owner string, ttl time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.renewed++
+	return f.renew
+}
+
+func (f *fakeLeaser) ReleaseNodeID(ctx context.Context, id int64, owner string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.released = true
+	return nil
+}
+
+func TestLease(t *testing.T) {
+	ctx := context.Background()
+	_, err := NewLease(ctx, &fakeLeaser{acquire: storage.ErrConflict}, "pod", time.Second, time.Millisecond)
+	assert.ErrorIs(t, err, ErrNoNodeID)
+
+	leaser := &fakeLeaser{}
+	l, err := NewLease(ctx, leaser, "pod", time.Second, time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), l.NodeID())
+	assert.Eventually(t, func() bool {
+		leaser.mu.Lock()
+		defer leaser.mu.Unlock()
+		return leaser.renewed > 2
+	}, time.Second, time.Millisecond)
+	require.NoError(t, l.Close(ctx))
+	assert.True(t, leaser.released)
+}
+
+func TestLeaseLost(t *testing.T) {
+	ctx := context.Background()
+	leaser := &fakeLeaser{renew: storage.ErrNotFound}
+	l, err := NewLease(ctx, leaser, "pod", time.Second, time.Millisecond)
+	require.NoError(t, err)
+	select {
+	case <-l.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lease is not lost")
+	}
+	// a lost lease belongs to another instance
+	require.NoError(t, l.Close(ctx))
+	assert.False(t, leaser.released)
+
+	// renew errors are tolerated until the lease may have expired
+	leaser = &fakeLeaser{renew: storage.ErrUnavailable}
+	l, err = NewLease(ctx, leaser, "pod", 50*time.Millisecond, 10*time.Millisecond)
+	require.NoError(t, err)
+	start := time.Now()
+	<-l.Lost()
+	assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond)
+	l.Close(ctx)
+}
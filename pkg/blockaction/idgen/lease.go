@@ -0,0 +1,106 @@
+package idgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+)
+
+// Leaser stores node ID leases, see storage.BlockActionDB.
+type Leaser interface {
+	AcquireNodeID(ctx context.Context, owner string, maxID int64, ttl time.Duration) (int64, error)
+	RenewNodeID(ctx context.Context, id int64, owner string, ttl time.Duration) error
+	ReleaseNodeID(ctx context.Context, id int64, owner string) error
+}
+
+// Lease holds a node ID leased from a database and renews it every
+// interval. Once the lease may have expired the ID is no longer safe to
+// use, Lost is closed and the instance must stop generating IDs.
+type Lease struct {
+	leaser   Leaser
+	owner    string
+	id       int64
+	ttl      time.Duration
+	interval time.Duration
+	lost     chan struct{}
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func NewLease(ctx context.Context, leaser Leaser, owner string, ttl, interval time.Duration) (*Lease, error) {
+	id, err := leaser.AcquireNodeID(ctx, owner, MAX_NODE_ID, ttl)
+	if errors.Is(err, storage.ErrConflict) {
+		return nil, fmt.Errorf("%w : every node id is leased", ErrNoNodeID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lease node id fail : %w", err)
+	}
+	heartbeatCtx, cancel := context.WithCancel(context.Background())
+	l := &Lease{
+		leaser:   leaser,
+		owner:    owner,
+		id:       id,
+		ttl:      ttl,
+		interval: interval,
+		lost:     make(chan struct{}),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go l.heartbeat(heartbeatCtx, time.Now())
+
+	return l, nil
+}
+
+func (l *Lease) NodeID() int64 {
+	return l.id
+}
+
+// Lost is closed when the lease could not be renewed in time.
+func (l *Lease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *Lease) heartbeat(ctx context.Context, renewed time.Time) {
+	defer close(l.done)
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := l.leaser.RenewNodeID(ctx, l.id, l.owner, l.ttl)
+		if err == nil {
+			renewed = time.Now()
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		// the next heartbeat would come after the lease expired
+		if errors.Is(err, storage.ErrNotFound) || time.Since(renewed)+l.interval >= l.ttl {
+			slog.Error("snowflake node id lease lost", "node_id", l.id, "error", err)
+			close(l.lost)
+			return
+		}
+		slog.Warn("snowflake node id lease renew fail", "node_id", l.id, "error", err)
+	}
+}
+
+// Close stops the heartbeat and releases the node ID.
+func (l *Lease) Close(ctx context.Context) error {
+	l.cancel()
+	<-l.done
+	select {
+	case <-l.lost:
+		return nil
+	default:
+	}
+
+	return l.leaser.ReleaseNodeID(ctx, l.id, l.owner)
+}
@@ -0,0 +1,54 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/go-playground/validator/v10"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/service"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+)
+
+// toStatus returns the status of a service error. Failed fields are sent as
+// BadRequest details, unexpected errors are logged and answered with
+// Internal so their text never reaches the client.
+func toStatus(ctx context.Context, err error) error {
+	var validationErrs validator.ValidationErrors
+	switch {
+	case errors.As(err, &validationErrs):
+		badRequest := &errdetails.BadRequest{}
+		for _, fe := range validationErrs {
+			description := fe.Tag()
+			if fe.Param() != "" {
+				description += "=" + fe.Param()
+			}
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       fe.Field(),
+				Description: description,
+			})
+		}
+		st, detailErr := status.New(codes.InvalidArgument, "request validation failed").WithDetails(badRequest)
+		if detailErr != nil {
+			return status.Error(codes.InvalidArgument, "request validation failed")
+		}
+		return st.Err()
+	case errors.Is(err, service.ErrAccountExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, service.ErrInvalidCredentials), errors.Is(err, service.ErrInvalidToken):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, storage.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, storage.ErrConflict):
+		return status.Error(codes.Aborted, "resource was changed concurrently")
+	case errors.Is(err, storage.ErrUnavailable), errors.Is(err, storage.ErrDeadlock):
+		return status.Error(codes.Unavailable, "service unavailable, retry later")
+	}
+	slog.Error("grpc request fail", "request_id", RequestID(ctx), "error", err)
+
+	return status.Error(codes.Internal, "internal server error")
+}
@@ -0,0 +1,196 @@
+package rpc
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/auth"
+	"github.com/reddtsai/goAPI/pkg/blockaction/rpc/pb"
+	"github.com/reddtsai/goAPI/pkg/blockaction/service"
+)
+
+const (
+	MD_AUTHORIZATION = auth.MD_AUTHORIZATION
+	MD_REQUEST_ID    = "x-request-id"
+	MD_RETRY_AFTER   = "retry-after"
+)
+
+type ctxKey int
+
+const (
+	ctxRequestID ctxKey = iota
+	ctxClaims
+	ctxClientID
+)
+
+var (
+	_grpcMetrics *GRPCMetrics
+
+	// _publicMethods are called without credentials
+	_publicMethods = map[string]bool{
+		pb.BlockAction_Signup_FullMethodName:        true,
+		pb.BlockAction_Signin_FullMethodName:        true,
+		pb.BlockAction_ValidateToken_FullMethodName: true,
+	}
+)
+
+func init() {
+	_grpcMetrics = &GRPCMetrics{
+		RequestTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "api_grpc_requests_total",
+				Help: "gRPC requests total count",
+			},
+			[]string{"grpc_method", "grpc_code"},
+		),
+		RequestDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name: "api_grpc_request_duration_seconds",
+				Help: "gRPC requests duration seconds histogram",
+			},
+			[]string{"grpc_method", "grpc_code"},
+		),
+	}
+}
+
+type GRPCMetrics struct {
+	RequestTotal    *prometheus.CounterVec
+	RequestDuration *prometheus.HistogramVec
+}
+
+func (m *GRPCMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.RequestTotal.Collect(ch)
+	m.RequestDuration.Collect(ch)
+}
+
+func (m *GRPCMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.RequestTotal.Describe(ch)
+	m.RequestDuration.Describe(ch)
+}
+
+// RequestID returns the ID of the request, sent back in the x-request-id
+// header.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(ctxRequestID).(string)
+	return id
+}
+
+// Claims returns the claims of the token the request was authorized with,
+// nil for trusted clients and public methods.
+func Claims(ctx context.Context) *service.UserClaims {
+	claims, _ := ctx.Value(ctxClaims).(*service.UserClaims)
+	return claims
+}
+
+// ClientIdentity returns the identity of the trusted client the request was
+// authorized with.
+func ClientIdentity(ctx context.Context) string {
+	id, _ := ctx.Value(ctxClientID).(string)
+	return id
+}
+
+func (s *Server) requestIDInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	requestID := s.opts.service.NewRequestID()
+	grpc.SetHeader(ctx, metadata.Pairs(MD_REQUEST_ID, requestID))
+
+	return handler(context.WithValue(ctx, ctxRequestID, requestID), req)
+}
+
+func loggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	startTime := time.Now()
+	resp, err := handler(ctx, req)
+	slog.Info("grpc request", "request_id", RequestID(ctx), "method", info.FullMethod, "code", status.Code(err).String(), "duration", time.Since(startTime))
+
+	return resp, err
+}
+
+func metricsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	startTime := time.Now()
+	resp, err := handler(ctx, req)
+	code := status.Code(err).String()
+	_grpcMetrics.RequestDuration.WithLabelValues(info.FullMethod, code).Observe(time.Since(startTime).Seconds())
+	_grpcMetrics.RequestTotal.WithLabelValues(info.FullMethod, code).Inc()
+
+	return resp, err
+}
+
+// rateLimitInterceptor limits the requests per peer address with the limit
+// of the service, shared with HTTP. The public methods are limited as well.
+func (s *Server) rateLimitInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ok, wait := s.opts.service.Allow(peerAddr(ctx))
+	if !ok {
+		grpc.SetHeader(ctx, metadata.Pairs(MD_RETRY_AFTER, strconv.Itoa(int(math.Ceil(wait.Seconds())))))
+		return nil, status.Error(codes.ResourceExhausted, "too many requests")
+	}
+
+	return handler(ctx, req)
+}
+
+// peerAddr returns the IP of the peer, its whole address when it has no
+// port.
+func peerAddr(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+// authInterceptor lets trusted mTLS clients through, other callers need a
+// bearer token outside the public methods.
+func (s *Server) authInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if _publicMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	identity := peerIdentity(ctx)
+	if identity != "" && slices.Contains(s.opts.trustedClients, identity) {
+		return handler(context.WithValue(ctx, ctxClientID, identity), req)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	if values := md.Get(MD_AUTHORIZATION); len(values) > 0 {
+		token = auth.BearerToken(values[0])
+	}
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "invalid authorization")
+	}
+	claims, err := s.opts.service.ValidateToken(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid authorization")
+	}
+
+	return handler(context.WithValue(ctx, ctxClaims, claims), req)
+}
+
+// peerIdentity returns the identity of a client certificate verified by
+// mutual TLS, see auth.TLSIdentity.
+func peerIdentity(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return ""
+	}
+
+	return auth.TLSIdentity(&tlsInfo.State)
+}
@@ -0,0 +1,152 @@
+//go:generate buf generate
+package rpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/rpc/pb"
+	"github.com/reddtsai/goAPI/pkg/blockaction/service"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+)
+
+var _ pb.BlockActionServer = (*Server)(nil)
+
+// Server serves the service over gRPC.
+type Server struct {
+	pb.UnimplementedBlockActionServer
+	opts ServerOptions
+}
+
+type ServerOptions struct {
+	service        *service.Service
+	trustedClients []string
+	grpcOptions    []grpc.ServerOption
+}
+
+type ServerOption func(*ServerOptions)
+
+func SetService(svc *service.Service) ServerOption {
+	return func(o *ServerOptions) {
+		o.service = svc
+	}
+}
+
+// SetTrustedClients lists the mTLS client identities allowed to call every
+// method without a token.
+func SetTrustedClients(identities []string) ServerOption {
+	return func(o *ServerOptions) {
+		o.trustedClients = identities
+	}
+}
+
+// SetGRPCOptions adds options of the grpc server such as its credentials.
+func SetGRPCOptions(opts ...grpc.ServerOption) ServerOption {
+	return func(o *ServerOptions) {
+		o.grpcOptions = append(o.grpcOptions, opts...)
+	}
+}
+
+// NewServer returns a grpc server serving BlockAction, with the request ID,
+// logging, metrics, rate limit and auth interceptors in that order.
+func NewServer(opts ...ServerOption) (*grpc.Server, error) {
+	s := new(Server)
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	if s.opts.service == nil {
+		return nil, fmt.Errorf("service is nil")
+	}
+	prometheus.Register(_grpcMetrics)
+
+	grpcOptions := append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			s.requestIDInterceptor,
+			loggingInterceptor,
+			metricsInterceptor,
+			s.rateLimitInterceptor,
+			s.authInterceptor,
+		),
+	}, s.opts.grpcOptions...)
+	server := grpc.NewServer(grpcOptions...)
+	pb.RegisterBlockActionServer(server, s)
+
+	return server, nil
+}
+
+func (s *Server) Signup(ctx context.Context, req *pb.SignupRequest) (*pb.SignupResponse, error) {
+	u, err := s.opts.service.Signup(ctx, service.SignupInput{
+		Account:  req.GetAccount(),
+		Password: req.GetPassword(),
+		UserName: req.GetUserName(),
+	})
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return &pb.SignupResponse{User: toUser(u)}, nil
+}
+
+func (s *Server) Signin(ctx context.Context, req *pb.SigninRequest) (*pb.SigninResponse, error) {
+	tokens, err := s.opts.service.Signin(ctx, req.GetAccount(), req.GetPassword())
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return &pb.SigninResponse{
+		Token:        tokens.Token,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt.Unix(),
+	}, nil
+}
+
+func (s *Server) ValidateToken(ctx context.Context, req *pb.ValidateTokenRequest) (*pb.ValidateTokenResponse, error) {
+	claims, err := s.opts.service.ValidateToken(req.GetToken())
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+	resp := &pb.ValidateTokenResponse{
+		UserId:  claims.ID,
+		Account: claims.Account,
+	}
+	if claims.ExpiresAt != nil {
+		resp.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+
+	return resp, nil
+}
+
+func (s *Server) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserResponse, error) {
+	id := req.GetId()
+	if claims := Claims(ctx); claims != nil {
+		if id == 0 {
+			id = claims.ID
+		}
+		if id != claims.ID {
+			return nil, status.Error(codes.PermissionDenied, "token of another user")
+		}
+	}
+	if id == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	u, err := s.opts.service.GetUser(ctx, id)
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return &pb.GetUserResponse{User: toUser(u)}, nil
+}
+
+func toUser(u storage.UserTable) *pb.User {
+	return &pb.User{
+		Id:        u.ID,
+		Account:   u.Account,
+		UserName:  u.Name,
+		CreatedAt: u.CreatedAt,
+	}
+}
@@ -0,0 +1,163 @@
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/rpc/pb"
+	"github.com/reddtsai/goAPI/pkg/blockaction/service"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage/mock"
+)
+
+const (
+	testSecret = "test-secret"
+	testID     = 1234
+)
+
+type fixedID struct{}
+
+func (fixedID) Generate() int64 {
+	return testID
+}
+
+func newTestClient(t *testing.T, opts ...ServerOption) (pb.BlockActionClient, *mock.MockIStorage) {
+	return newTestClientOf(t, nil, opts...)
+}
+
+// newTestClientOf serves a service built with svcOpts.
+func newTestClientOf(t *testing.T, svcOpts []service.ServiceOption, opts ...ServerOption) (pb.BlockActionClient, *mock.MockIStorage) {
+	mockStorage := mock.NewMockIStorage(gomock.NewController(t))
+	svc, err := service.New(append([]service.ServiceOption{service.SetStorage(mockStorage), service.SetSecret(testSecret), service.SetIDGenerator(fixedID{})}, svcOpts...)...)
+	require.NoError(t, err)
+	server, err := NewServer(append([]ServerOption{SetService(svc)}, opts...)...)
+	require.NoError(t, err)
+	lis := bufconn.Listen(1 << 20)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewBlockActionClient(conn), mockStorage
+}
+
+func TestSignup(t *testing.T) {
+	client, mockStorage := newTestClient(t)
+	ctx := context.Background()
+	mockStorage.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Return(nil)
+	var header metadata.MD
+	resp, err := client.Signup(ctx, &pb.SignupRequest{Account: "testuser", Password: "abcd1234", UserName: "testuser"}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Equal(t, int64(testID), resp.GetUser().GetId())
+	assert.Equal(t, []string{"1234"}, header.Get(MD_REQUEST_ID))
+
+	mockStorage.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Return(storage.ErrConflict)
+	_, err = client.Signup(ctx, &pb.SignupRequest{Account: "testuser", Password: "abcd1234", UserName: "testuser"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	_, err = client.Signup(ctx, &pb.SignupRequest{Account: "test", Password: "abcd1234", UserName: "testuser"})
+	st := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 1)
+	badRequest := st.Details()[0].(*errdetails.BadRequest)
+	assert.Equal(t, "account", badRequest.GetFieldViolations()[0].GetField())
+	assert.Equal(t, "min=6", badRequest.GetFieldViolations()[0].GetDescription())
+}
+
+func TestSigninGetUser(t *testing.T) {
+	client, mockStorage := newTestClient(t)
+	ctx := context.Background()
+	secret, err := service.SignPassword("abcd1234", []byte(testSecret))
+	require.NoError(t, err)
+	user := storage.UserTable{ID: 1, Account: "testuser", Name: "tester", Secret: secret}
+	mockStorage.EXPECT().GetUserByAccount(gomock.Any(), "testuser").Return(user, nil)
+	mockStorage.EXPECT().CreateRefreshToken(gomock.Any(), gomock.Any()).Return(nil)
+	signin, err := client.Signin(ctx, &pb.SigninRequest{Account: "testuser", Password: "abcd1234"})
+	require.NoError(t, err)
+
+	validated, err := client.ValidateToken(ctx, &pb.ValidateTokenRequest{Token: signin.GetToken()})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), validated.GetUserId())
+	assert.Equal(t, signin.GetExpiresAt(), validated.GetExpiresAt())
+	_, err = client.ValidateToken(ctx, &pb.ValidateTokenRequest{Token: "nope"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.GetUser(ctx, &pb.GetUserRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	authCtx := metadata.AppendToOutgoingContext(ctx, MD_AUTHORIZATION, "Bearer "+signin.GetToken())
+	mockStorage.EXPECT().GetUser(gomock.Any(), int64(1)).Return(user, nil)
+	got, err := client.GetUser(authCtx, &pb.GetUserRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "tester", got.GetUser().GetUserName())
+
+	_, err = client.GetUser(authCtx, &pb.GetUserRequest{Id: 2})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	mockStorage.EXPECT().GetUser(gomock.Any(), int64(1)).Return(storage.UserTable{}, storage.ErrUnavailable)
+	_, err = client.GetUser(authCtx, &pb.GetUserRequest{Id: 1})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestAuthTrustedClient(t *testing.T) {
+	s := &Server{opts: ServerOptions{trustedClients: []string{"billing.internal"}}}
+	info := &grpc.UnaryServerInfo{FullMethod: pb.BlockAction_GetUser_FullMethodName}
+	var identity string
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		identity = ClientIdentity(ctx)
+		return nil, nil
+	}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{DNSNames: []string{"billing.internal"}}}},
+	}}})
+
+	_, err := s.authInterceptor(ctx, nil, info, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "billing.internal", identity)
+
+	s.opts.trustedClients = nil
+	_, err = s.authInterceptor(ctx, nil, info, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestRateLimit(t *testing.T) {
+	client, mockStorage := newTestClientOf(t, []service.ServiceOption{service.SetRateLimit(1, 1)})
+	ctx := context.Background()
+	mockStorage.EXPECT().GetUserByAccount(gomock.Any(), "testuser").Return(storage.UserTable{}, storage.ErrNotFound)
+
+	_, err := client.Signin(ctx, &pb.SigninRequest{Account: "testuser", Password: "abcd1234"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	var header metadata.MD
+	_, err = client.Signin(ctx, &pb.SigninRequest{Account: "testuser", Password: "abcd1234"}, grpc.Header(&header))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"1"}, header.Get(MD_RETRY_AFTER))
+}
+
+func TestPeerAddr(t *testing.T) {
+	assert.Empty(t, peerAddr(context.Background()))
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 51234}})
+	assert.Equal(t, "192.0.2.1", peerAddr(ctx))
+}
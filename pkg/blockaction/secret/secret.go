@@ -0,0 +1,121 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Provider resolves the secret referenced by ref, whose scheme selected the
+// provider, e.g. env:DB_PASSWORD or file:///run/secrets/db.
+type Provider interface {
+	Resolve(ctx context.Context, ref *url.URL) (string, error)
+}
+
+type ProviderFunc func(ctx context.Context, ref *url.URL) (string, error)
+
+func (f ProviderFunc) Resolve(ctx context.Context, ref *url.URL) (string, error) {
+	return f(ctx, ref)
+}
+
+type Resolver struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+}
+
+// NewResolver returns a resolver with the file and env providers registered.
+func NewResolver() *Resolver {
+	r := &Resolver{
+		providers: make(map[string]Provider),
+	}
+	r.Register("file", ProviderFunc(resolveFile))
+	r.Register("env", ProviderFunc(resolveEnv))
+
+	return r
+}
+
+func (r *Resolver) Register(scheme string, p Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[scheme] = p
+}
+
+// IsRef reports whether value references a secret of a registered provider
+// instead of holding the secret itself, malformed references included.
+func (r *Resolver) IsRef(value string) bool {
+	p, _, _ := r.lookup(value)
+	return p != nil
+}
+
+// Resolve returns the secret value references, or value itself when it is
+// not a reference. A malformed reference is an error, it is never used as
+// the secret.
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	p, ref, err := r.lookup(value)
+	if err != nil {
+		return "", err
+	}
+	if p == nil {
+		return value, nil
+	}
+	secret, err := p.Resolve(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("resolve secret %s fail : %w", redactRef(ref), err)
+	}
+
+	return secret, nil
+}
+
+// lookup returns the provider of value, nil when value is not a reference.
+func (r *Resolver) lookup(value string) (Provider, *url.URL, error) {
+	scheme, _, found := strings.Cut(value, ":")
+	if !found {
+		return nil, nil, nil
+	}
+	r.mu.RLock()
+	p, ok := r.providers[scheme]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, nil, nil
+	}
+	ref, err := url.Parse(value)
+	if err != nil {
+		// the parse error quotes the value, which may be the secret itself
+		return p, nil, fmt.Errorf("resolve secret %s: fail : invalid reference", scheme)
+	}
+
+	return p, ref, nil
+}
+
+func redactRef(ref *url.URL) string {
+	u := *ref
+	u.User = nil
+	return u.String()
+}
+
+// resolveFile accepts file:///abs/path and file:relative/path, trailing
+// newlines are trimmed.
+func resolveFile(ctx context.Context, ref *url.URL) (string, error) {
+	path := ref.Path
+	if ref.Opaque != "" {
+		path = ref.Opaque
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+func resolveEnv(ctx context.Context, ref *url.URL) (string, error) {
+	value, ok := os.LookupEnv(ref.Opaque)
+	if !ok {
+		return "", fmt.Errorf("env %s is not set", ref.Opaque)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,57 @@
+package secret
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "db"), []byte("from-file\n"), 0600)
+	assert.Nil(t, err)
+	t.Setenv("TEST_SECRET", "from-env")
+	r := NewResolver()
+	ctx := context.Background()
+
+	for value, want := range map[string]string{
+		"file://" + filepath.Join(dir, "db"): "from-file",
+		"env:TEST_SECRET":                    "from-env",
+		"plain:text":                         "plain:text",
+		"!QAZ2wsx":                           "!QAZ2wsx",
+	} {
+		got, err := r.Resolve(ctx, value)
+		assert.Nil(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	_, err = r.Resolve(ctx, "env:TEST_SECRET_UNSET")
+	assert.NotNil(t, err)
+	_, err = r.Resolve(ctx, "file:///nonexistent/secret")
+	assert.NotNil(t, err)
+
+	// a malformed reference is not taken for the secret, nor quoted
+	assert.True(t, r.IsRef("file://%zz/db"))
+	_, err = r.Resolve(ctx, "file://%zz/db")
+	assert.NotNil(t, err)
+	assert.NotContains(t, err.Error(), "%zz")
+}
+
+func TestLocalVault(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "vault.yaml")
+	err := os.WriteFile(file, []byte("secret/blockaction:\n  mysql_password: from-vault\n"), 0600)
+	assert.Nil(t, err)
+	r := NewResolver()
+	r.Register("vault", NewLocalVault(file))
+	ctx := context.Background()
+
+	got, err := r.Resolve(ctx, "vault://secret/blockaction#mysql_password")
+	assert.Nil(t, err)
+	assert.Equal(t, "from-vault", got)
+
+	_, err = r.Resolve(ctx, "vault://secret/blockaction#unknown")
+	assert.NotNil(t, err)
+}
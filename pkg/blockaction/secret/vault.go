@@ -0,0 +1,48 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var _ Provider = (*LocalVault)(nil)
+
+// LocalVault stands in for a Vault KV store during development. Secrets are
+// read from a YAML file of path to key/value pairs and referenced as
+// vault://<path>#<key>, e.g. vault://secret/blockaction#mysql_password.
+type LocalVault struct {
+	file string
+}
+
+func NewLocalVault(file string) *LocalVault {
+	return &LocalVault{
+		file: file,
+	}
+}
+
+func (v *LocalVault) Resolve(ctx context.Context, ref *url.URL) (string, error) {
+	path := strings.Trim(ref.Host+ref.Path, "/")
+	if path == "" || ref.Fragment == "" {
+		return "", fmt.Errorf("vault ref must be vault://<path>#<key>")
+	}
+	b, err := os.ReadFile(v.file)
+	if err != nil {
+		return "", err
+	}
+	store := make(map[string]map[string]string)
+	err = yaml.Unmarshal(b, &store)
+	if err != nil {
+		return "", fmt.Errorf("parse vault file fail : %w", err)
+	}
+	value, ok := store[path][ref.Fragment]
+	if !ok {
+		return "", fmt.Errorf("vault key not found")
+	}
+
+	return value, nil
+}
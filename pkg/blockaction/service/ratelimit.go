@@ -0,0 +1,89 @@
+package service
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const RATE_LIMIT_IDLE_TTL = 10 * time.Minute
+
+type rateLimit struct {
+	rps   float64
+	burst int
+}
+
+// rateLimiter keeps a token bucket per client. Rate and burst are passed on
+// every call so reloaded limits apply to existing buckets.
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes a token from the bucket of key, otherwise returns how long
+// until the next token is available.
+func (l *rateLimiter) allow(key string, rps float64, burst int, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) > RATE_LIMIT_IDLE_TTL {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > RATE_LIMIT_IDLE_TTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rps)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rps * float64(time.Second))
+	}
+	b.tokens--
+
+	return true, 0
+}
+
+// SetRateLimit limits the requests of every client to rps with bursts of
+// burst, across the HTTP and gRPC APIs. A zero rps disables the limit.
+func SetRateLimit(rps float64, burst int) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.rateLimit = rps
+		o.rateBurst = burst
+	}
+}
+
+// ReloadRateLimit replaces the rate limit, existing buckets keep their
+// tokens.
+func (s *Service) ReloadRateLimit(rps float64, burst int) {
+	s.rateLimit.Store(&rateLimit{rps: rps, burst: burst})
+}
+
+// Allow takes a request of the client key, its IP or peer address, from
+// the rate limit. Otherwise it returns how long until the client may retry.
+func (s *Service) Allow(key string) (bool, time.Duration) {
+	r := s.rateLimit.Load()
+	if r.rps <= 0 {
+		return true, 0
+	}
+
+	return s.limiter.allow(key, r.rps, r.burst, time.Now())
+}
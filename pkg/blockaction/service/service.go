@@ -0,0 +1,336 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/auth"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+)
+
+const (
+	TOKEN_EXPIRE_TIME   = 900
+	REFRESH_EXPIRE_TIME = 7 * 24 * 3600
+	TOKEN_ISSUER        = auth.TOKEN_ISSUER
+)
+
+var (
+	ErrAccountExists      = errors.New("account already exist")
+	ErrInvalidCredentials = errors.New("account or password incorrect")
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrUserNotFound       = errors.New("user not found")
+
+	_validate *validator.Validate
+)
+
+func init() {
+	_validate = validator.New(validator.WithRequiredStructEnabled())
+	_validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			return f.Name
+		}
+		return name
+	})
+}
+
+// IDGenerator generates the IDs of users and requests, they must be unique
+// across every instance of the service.
+type IDGenerator interface {
+	Generate() int64
+}
+
+// Service holds the business logic of BlockAction, shared by the HTTP and
+// gRPC APIs. Errors are the sentinels above, validator.ValidationErrors or
+// storage errors, each transport maps them to its own status.
+type Service struct {
+	opts          ServiceOptions
+	tokenTTL      atomic.Int64
+	rateLimit     atomic.Pointer[rateLimit]
+	limiter       *rateLimiter
+	verifier      *auth.Verifier
+	signingMethod jwt.SigningMethod
+	jwks          auth.JWKS
+}
+
+type ServiceOptions struct {
+	storage     storage.IStorage
+	idGenerator IDGenerator
+	secret      []byte
+	signingKey  crypto.Signer
+	legacyUntil time.Time // 設定 signing key 後仍接受 secret 簽的 token 至此時間
+	audience    []string
+	tokenTTL    time.Duration
+	refreshTTL  time.Duration
+	rateLimit   float64
+	rateBurst   int
+}
+
+type ServiceOption func(*ServiceOptions)
+
+func DefaultOptions() ServiceOptions {
+	return ServiceOptions{
+		tokenTTL:   TOKEN_EXPIRE_TIME * time.Second,
+		refreshTTL: REFRESH_EXPIRE_TIME * time.Second,
+	}
+}
+
+func New(opts ...ServiceOption) (*Service, error) {
+	s := new(Service)
+	s.opts = DefaultOptions()
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	if s.opts.storage == nil {
+		return nil, fmt.Errorf("storage is nil")
+	}
+	if len(s.opts.secret) == 0 {
+		return nil, fmt.Errorf("secret is empty")
+	}
+	if s.opts.idGenerator == nil {
+		return nil, fmt.Errorf("id generator is nil")
+	}
+	if s.opts.refreshTTL <= 0 {
+		return nil, fmt.Errorf("refresh ttl must be positive")
+	}
+	err := s.newVerifier()
+	if err != nil {
+		return nil, err
+	}
+	s.tokenTTL.Store(int64(s.opts.tokenTTL))
+	s.ReloadRateLimit(s.opts.rateLimit, s.opts.rateBurst)
+	s.limiter = newRateLimiter()
+
+	return s, nil
+}
+
+func SetStorage(storage storage.IStorage) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.storage = storage
+	}
+}
+
+func SetIDGenerator(g IDGenerator) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.idGenerator = g
+	}
+}
+
+// SetSecret sets the key signing tokens and passwords.
+func SetSecret(secret string) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.secret = []byte(secret)
+	}
+}
+
+// SetSigningKey signs tokens with an RSA, ECDSA or Ed25519 key instead of
+// the secret, so other services verify them with the public key of JWKS.
+func SetSigningKey(key crypto.Signer) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.signingKey = key
+	}
+}
+
+// SetLegacySecretUntil keeps accepting the tokens signed with the secret
+// until the cut-off once a signing key is set, so they are not refused the
+// moment the key is rolled out. Without it only the signing key is accepted.
+func SetLegacySecretUntil(until time.Time) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.legacyUntil = until
+	}
+}
+
+// SetAudience sets the services tokens are issued for, checked by their
+// auth.Verifier.
+func SetAudience(audience []string) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.audience = audience
+	}
+}
+
+func SetTokenTTL(ttl time.Duration) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.tokenTTL = ttl
+	}
+}
+
+// SetRefreshTTL sets the lifetime of refresh tokens.
+func SetRefreshTTL(ttl time.Duration) ServiceOption {
+	return func(o *ServiceOptions) {
+		o.refreshTTL = ttl
+	}
+}
+
+// ReloadTokenTTL replaces the lifetime of tokens issued from now on.
+func (s *Service) ReloadTokenTTL(ttl time.Duration) {
+	s.tokenTTL.Store(int64(ttl))
+}
+
+// NewRequestID returns the ID of a request, unique across instances.
+func (s *Service) NewRequestID() string {
+	return strconv.FormatInt(s.opts.idGenerator.Generate(), 10)
+}
+
+type SignupInput struct {
+	Account  string `json:"account" validate:"required,min=6,max=12"`
+	Password string `json:"password" validate:"required,min=8,max=16"`
+	UserName string `json:"user_name" validate:"required,min=2,max=20"`
+}
+
+// Signup creates a user, ErrAccountExists when the account is taken.
+func (s *Service) Signup(ctx context.Context, in SignupInput) (storage.UserTable, error) {
+	err := _validate.Struct(in)
+	if err != nil {
+		return storage.UserTable{}, err
+	}
+	id := s.opts.idGenerator.Generate()
+	now := time.Now().UnixMilli()
+	entity := storage.UserTable{
+		ID:        id,
+		Account:   in.Account,
+		Name:      in.UserName,
+		CreatedAt: now,
+		Creator:   id,
+		UpdatedAt: now,
+		Updater:   id,
+	}
+	entity.Secret, err = SignPassword(in.Password, s.opts.secret)
+	if err != nil {
+		return storage.UserTable{}, err
+	}
+	// the unique account key decides between concurrent signups
+	err = s.opts.storage.CreateUser(ctx, entity)
+	if errors.Is(err, storage.ErrConflict) {
+		return storage.UserTable{}, ErrAccountExists
+	}
+	if err != nil {
+		return storage.UserTable{}, err
+	}
+
+	return entity, nil
+}
+
+type Tokens struct {
+	Token        string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+// Signin checks the password of account and issues its tokens,
+// ErrInvalidCredentials when the account or password is wrong.
+func (s *Service) Signin(ctx context.Context, account, password string) (Tokens, error) {
+	if account == "" || password == "" {
+		return Tokens{}, ErrInvalidCredentials
+	}
+	u, err := s.opts.storage.GetUserByAccount(ctx, account)
+	if errors.Is(err, storage.ErrNotFound) {
+		return Tokens{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+	ok, err := validatePwd(password, u.Secret, s.opts.secret)
+	if err != nil {
+		return Tokens{}, err
+	}
+	if !ok {
+		return Tokens{}, ErrInvalidCredentials
+	}
+
+	return s.issueTokens(ctx, u, "", "")
+}
+
+// Refresh issues new tokens for a refresh token, ErrInvalidToken when it is
+// not one, has expired, was used already or its user is gone. The tokens of
+// a signin form a family, each refresh replaces the only token the family
+// accepts, so other sessions of the user are not affected.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	claims, err := s.verifier.Parse(ctx, refreshToken)
+	if err != nil || claims.Use != TOKEN_USE_REFRESH || claims.ExpiresAt == nil ||
+		claims.Family == "" || claims.RegisteredClaims.ID == "" {
+		return Tokens{}, ErrInvalidToken
+	}
+	u := storage.UserTable{ID: claims.ID, Account: claims.Account}
+
+	return s.issueTokens(ctx, u, claims.Family, claims.RegisteredClaims.ID)
+}
+
+// issueTokens issues the tokens of u. Without a family they start one,
+// otherwise they replace the refresh token jti of the family.
+func (s *Service) issueTokens(ctx context.Context, u storage.UserTable, family, jti string) (Tokens, error) {
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(s.tokenTTL.Load()))
+	refreshExpiresAt := now.Add(s.opts.refreshTTL)
+	next := s.NewRequestID()
+	entity := storage.RefreshTokenTable{
+		Family:    family,
+		UserID:    u.ID,
+		JTI:       next,
+		ExpiresAt: refreshExpiresAt.UnixMilli(),
+	}
+	var err error
+	if family == "" {
+		entity.Family = next
+		err = s.opts.storage.CreateRefreshToken(ctx, entity)
+	} else {
+		err = s.opts.storage.RotateRefreshToken(ctx, jti, entity)
+		if errors.Is(err, storage.ErrNotFound) {
+			return Tokens{}, ErrInvalidToken
+		}
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+	token, err := s.signToken(&UserClaims{
+		ID:               u.ID,
+		Account:          u.Account,
+		RegisteredClaims: jwtClaims(now, expiresAt, s.opts.audience),
+	})
+	if err != nil {
+		return Tokens{}, err
+	}
+	reClaims := &UserClaims{
+		ID:               u.ID,
+		Account:          u.Account,
+		Use:              TOKEN_USE_REFRESH,
+		Family:           entity.Family,
+		RegisteredClaims: jwtClaims(now, refreshExpiresAt, nil),
+	}
+	reClaims.RegisteredClaims.ID = next
+	reToken, err := s.signToken(reClaims)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return Tokens{
+		Token:        token,
+		RefreshToken: reToken,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// GetUser returns a user, ErrUserNotFound when there is none.
+func (s *Service) GetUser(ctx context.Context, id int64) (storage.UserTable, error) {
+	u, err := s.opts.storage.GetUser(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return storage.UserTable{}, ErrUserNotFound
+	}
+
+	return u, err
+}
+
+// GetUserHistory returns the history of a user oldest first, deleted users
+// included.
+func (s *Service) GetUserHistory(ctx context.Context, id int64) ([]storage.UserHistoryTable, error) {
+	return s.opts.storage.GetUserHistory(ctx, id)
+}
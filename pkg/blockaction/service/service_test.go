@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/auth"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage/mock"
+)
+
+const testSecret = "test-secret"
+
+type fixedID struct{}
+
+func (fixedID) Generate() int64 {
+	return 1234
+}
+
+func newTestService(t *testing.T) (*Service, *mock.MockIStorage) {
+	mockStorage := mock.NewMockIStorage(gomock.NewController(t))
+	s, err := New(SetStorage(mockStorage), SetSecret(testSecret), SetIDGenerator(fixedID{}))
+	require.NoError(t, err)
+
+	return s, mockStorage
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(SetSecret(testSecret), SetIDGenerator(fixedID{}))
+	assert.EqualError(t, err, "storage is nil")
+}
+
+func TestSignup(t *testing.T) {
+	s, mockStorage := newTestService(t)
+	ctx := context.Background()
+
+	_, err := s.Signup(ctx, SignupInput{Account: "test", Password: "abcd1234", UserName: "tester"})
+	var validationErrs validator.ValidationErrors
+	require.ErrorAs(t, err, &validationErrs)
+	assert.Equal(t, "account", validationErrs[0].Field())
+
+	mockStorage.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Return(storage.ErrConflict)
+	_, err = s.Signup(ctx, SignupInput{Account: "testuser", Password: "abcd1234", UserName: "tester"})
+	assert.ErrorIs(t, err, ErrAccountExists)
+
+	mockStorage.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Return(nil)
+	u, err := s.Signup(ctx, SignupInput{Account: "testuser", Password: "abcd1234", UserName: "tester"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1234), u.ID)
+	assert.NotEqual(t, "abcd1234", u.Secret)
+}
+
+func TestSigninValidateToken(t *testing.T) {
+	s, mockStorage := newTestService(t)
+	ctx := context.Background()
+	secret, err := SignPassword("abcd1234", []byte(testSecret))
+	require.NoError(t, err)
+	mockStorage.EXPECT().GetUserByAccount(gomock.Any(), "testuser").Return(storage.UserTable{ID: 1, Account: "testuser", Secret: secret}, nil).Times(2)
+	mockStorage.EXPECT().CreateRefreshToken(gomock.Any(), gomock.Any()).Return(nil)
+
+	_, err = s.Signin(ctx, "testuser", "wrong-password")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	s.ReloadTokenTTL(time.Minute)
+	tokens, err := s.Signin(ctx, "testuser", "abcd1234")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), tokens.ExpiresAt, 5*time.Second)
+	claims, err := s.ValidateToken(tokens.Token)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), claims.ID)
+	assert.Equal(t, "testuser", claims.Account)
+
+	// refresh tokens are not access tokens
+	_, err = s.ValidateToken(tokens.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = s.Refresh(ctx, tokens.Token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	mockStorage.EXPECT().RotateRefreshToken(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	refreshed, err := s.Refresh(ctx, tokens.RefreshToken)
+	require.NoError(t, err)
+	claims, err = s.ValidateToken(refreshed.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "testuser", claims.Account)
+
+	// only HS256 tokens of the secret are accepted
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	_, err = s.ValidateToken(none)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	expired, err := SignToken(&UserClaims{ID: 1, RegisteredClaims: jwtClaims(time.Now().Add(-time.Hour), time.Now().Add(-time.Minute), nil)}, []byte(testSecret))
+	require.NoError(t, err)
+	_, err = s.ValidateToken(expired)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+type seqID struct {
+	n int64
+}
+
+func (g *seqID) Generate() int64 {
+	g.n++
+	return g.n
+}
+
+func TestRefresh(t *testing.T) {
+	s, err := New(SetStorage(storage.NewMemoryStorage()), SetSecret(testSecret), SetIDGenerator(&seqID{}), SetRefreshTTL(time.Hour))
+	require.NoError(t, err)
+	ctx := context.Background()
+	u := storage.UserTable{ID: 1, Account: "testuser"}
+	tokens, err := s.issueTokens(ctx, u, "", "")
+	require.NoError(t, err)
+	claims, err := s.verifier.Parse(ctx, tokens.RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, "1", claims.Family)
+	assert.Equal(t, "1", claims.RegisteredClaims.ID)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), claims.ExpiresAt.Time, 5*time.Second)
+	other, err := s.issueTokens(ctx, u, "", "")
+	require.NoError(t, err)
+
+	// a refresh token is used once, the next one carries on its family
+	refreshed, err := s.Refresh(ctx, tokens.RefreshToken)
+	require.NoError(t, err)
+	claims, err = s.verifier.Parse(ctx, refreshed.RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, "1", claims.Family)
+	assert.Equal(t, "testuser", claims.Account)
+	_, err = s.Refresh(ctx, tokens.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = s.Refresh(ctx, refreshed.RefreshToken)
+	require.NoError(t, err)
+
+	// other sessions of the user are not affected
+	_, err = s.Refresh(ctx, other.RefreshToken)
+	require.NoError(t, err)
+
+	// expired refresh tokens and those without expiry or family are refused
+	expired, err := SignToken(&UserClaims{ID: 1, Use: TOKEN_USE_REFRESH, Family: "1", RegisteredClaims: jwtClaims(time.Now().Add(-time.Hour), time.Now().Add(-time.Minute), nil)}, []byte(testSecret))
+	require.NoError(t, err)
+	_, err = s.Refresh(ctx, expired)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	forever, err := SignToken(&UserClaims{ID: 1, Use: TOKEN_USE_REFRESH, Family: "1", RegisteredClaims: jwt.RegisteredClaims{ID: "9", Issuer: TOKEN_ISSUER, IssuedAt: jwt.NewNumericDate(time.Now())}}, []byte(testSecret))
+	require.NoError(t, err)
+	_, err = s.Refresh(ctx, forever)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	orphan, err := SignToken(&UserClaims{ID: 1, Use: TOKEN_USE_REFRESH, RegisteredClaims: jwtClaims(time.Now(), time.Now().Add(time.Minute), nil)}, []byte(testSecret))
+	require.NoError(t, err)
+	_, err = s.Refresh(ctx, orphan)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestSigningKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	mockStorage := mock.NewMockIStorage(gomock.NewController(t))
+	s, err := New(SetStorage(mockStorage), SetSecret(testSecret), SetIDGenerator(fixedID{}),
+		SetSigningKey(key), SetAudience([]string{"billing"}))
+	require.NoError(t, err)
+	ctx := context.Background()
+	secret, err := SignPassword("abcd1234", []byte(testSecret))
+	require.NoError(t, err)
+	mockStorage.EXPECT().GetUserByAccount(gomock.Any(), "testuser").Return(storage.UserTable{ID: 1, Account: "testuser", Secret: secret}, nil)
+	mockStorage.EXPECT().CreateRefreshToken(gomock.Any(), gomock.Any()).Return(nil)
+
+	// other services verify the tokens with the public keys of JWKS
+	tokens, err := s.Signin(ctx, "testuser", "abcd1234")
+	require.NoError(t, err)
+	jwks := s.JWKS()
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "ES256", jwks.Keys[0].Alg)
+	verifier, err := auth.NewVerifier(auth.SetKeySource(jwks.KeySet()), auth.SetAudience("billing"))
+	require.NoError(t, err)
+	claims, err := verifier.Verify(ctx, tokens.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "testuser", claims.Account)
+	_, err = s.ValidateToken(tokens.Token)
+	assert.NoError(t, err)
+
+	// tokens of the secret are refused, or accepted until the cut-off
+	legacy, err := SignToken(&UserClaims{ID: 1, RegisteredClaims: jwtClaims(time.Now(), time.Now().Add(time.Minute), nil)}, []byte(testSecret))
+	require.NoError(t, err)
+	_, err = s.ValidateToken(legacy)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = verifier.Verify(ctx, legacy)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	for until, valid := range map[time.Time]bool{time.Now().Add(time.Hour): true, time.Now().Add(-time.Hour): false} {
+		s, err := New(SetStorage(mockStorage), SetSecret(testSecret), SetIDGenerator(fixedID{}),
+			SetSigningKey(key), SetLegacySecretUntil(until))
+		require.NoError(t, err)
+		_, err = s.ValidateToken(legacy)
+		assert.Equal(t, valid, err == nil)
+	}
+}
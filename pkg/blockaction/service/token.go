@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/auth"
+)
+
+const TOKEN_USE_REFRESH = auth.TOKEN_USE_REFRESH
+
+type UserClaims = auth.Claims
+
+// ValidateToken returns the claims of an access token signed by the
+// service, ErrInvalidToken when it is not or has expired.
+func (s *Service) ValidateToken(token string) (*UserClaims, error) {
+	claims, err := s.verifier.Verify(context.Background(), token)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// JWKS returns the public keys verifying the tokens, empty when they are
+// signed with the secret.
+func (s *Service) JWKS() auth.JWKS {
+	return s.jwks
+}
+
+// newVerifier verifies the tokens of the signing key, and those of the
+// secret until the legacy cut-off. Without a signing key it verifies those
+// of the secret.
+func (s *Service) newVerifier() error {
+	legacy := auth.Key{Key: s.opts.secret, Alg: jwt.SigningMethodHS256.Alg()}
+	keys := auth.KeySet{"": legacy}
+	algorithms := []string{jwt.SigningMethodHS256.Alg()}
+	var source auth.KeySource = keys
+	s.jwks = auth.JWKS{Keys: []auth.JWK{}}
+	if s.opts.signingKey != nil {
+		keys, algorithms = auth.KeySet{}, nil
+		source = keys
+		if !s.opts.legacyUntil.IsZero() {
+			keys[""] = legacy
+			algorithms = append(algorithms, legacy.Alg)
+			source = legacyKeys{KeySet: keys, until: s.opts.legacyUntil}
+		}
+		alg, err := auth.Algorithm(s.opts.signingKey.Public())
+		if err != nil {
+			return fmt.Errorf("signing key : %w", err)
+		}
+		jwk, err := auth.NewJWK("", s.opts.signingKey.Public())
+		if err != nil {
+			return fmt.Errorf("signing key : %w", err)
+		}
+		keys[jwk.Kid] = auth.Key{Key: s.opts.signingKey.Public(), Alg: alg}
+		algorithms = append(algorithms, alg)
+		s.jwks.Keys = append(s.jwks.Keys, jwk)
+		s.signingMethod = jwt.GetSigningMethod(alg)
+	}
+	verifier, err := auth.NewVerifier(auth.SetKeySource(source), auth.SetAlgorithms(algorithms...))
+	if err != nil {
+		return err
+	}
+	s.verifier = verifier
+
+	return nil
+}
+
+// legacyKeys refuse the secret after the cut-off.
+type legacyKeys struct {
+	auth.KeySet
+	until time.Time
+}
+
+func (k legacyKeys) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	if kid == "" && !time.Now().Before(k.until) {
+		return nil, auth.ErrKeyNotFound
+	}
+
+	return k.KeySet.Key(ctx, kid, alg)
+}
+
+// signToken signs claims with the signing key, or HS256 and the secret
+// without one.
+func (s *Service) signToken(claims jwt.Claims) (string, error) {
+	if s.opts.signingKey == nil {
+		return SignToken(claims, s.opts.secret)
+	}
+	token := jwt.NewWithClaims(s.signingMethod, claims)
+	token.Header["kid"] = s.jwks.Keys[0].Kid
+
+	return token.SignedString(s.opts.signingKey)
+}
+
+// SignToken signs claims with HS256.
+func SignToken(claims jwt.Claims, key []byte) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+}
+
+// SignPassword returns the stored secret of a password.
+func SignPassword(pwd string, key []byte) (string, error) {
+	return hmacSignature([]byte(pwd), key)
+}
+
+func validatePwd(pwd, secret string, key []byte) (bool, error) {
+	mac, err := hmacSignature([]byte(pwd), key)
+	if err != nil {
+		return false, err
+	}
+
+	return hmac.Equal([]byte(mac), []byte(secret)), nil
+}
+
+func hmacSignature(msg []byte, key []byte) (string, error) {
+	mac := hmac.New(sha256.New, key)
+	if _, err := mac.Write(msg); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// jwtClaims are the registered claims of a token for audience issued at
+// now and expiring at expiresAt.
+func jwtClaims(now, expiresAt time.Time, audience []string) jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Issuer:    TOKEN_ISSUER,
+		Audience:  audience,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+}
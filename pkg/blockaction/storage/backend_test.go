@@ -0,0 +1,80 @@
+package storage_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage/migration"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage/storagetest"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.IStorage {
+		return storage.NewMemoryStorage()
+	})
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.IStorage {
+		db, err := storage.NewBlockActionSQLite(context.Background(), storage.BlockActionSQLiteCfg{
+			File: filepath.Join(t.TempDir(), "test.db"),
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		migrate(t, db, migration.SQLite{})
+		return db
+	})
+}
+
+// TestMySQLStorage runs against BLOCKACTION_TEST_MYSQL_DSN and is skipped
+// when it is unset. The user table is emptied before every test.
+func TestMySQLStorage(t *testing.T) {
+	dsn := os.Getenv("BLOCKACTION_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("BLOCKACTION_TEST_MYSQL_DSN is not set")
+	}
+	storagetest.Run(t, func(t *testing.T) storage.IStorage {
+		db, err := storage.NewBlockActionDB(context.Background(), storage.BlockActionDBCfg{DSN: dsn, MaxOpenConn: 10})
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		sqlDB := migrate(t, db, migration.MySQL{})
+		_, err = sqlDB.Exec("DELETE FROM `user`")
+		require.NoError(t, err)
+		return db
+	})
+}
+
+func migrate(t *testing.T, db *storage.BlockActionDB, dialect migration.Dialect) *sql.DB {
+	sqlDB, err := db.SQLDB()
+	require.NoError(t, err)
+	m, err := migration.NewMigrator(sqlDB, dialect)
+	require.NoError(t, err)
+	_, err = m.Up(context.Background(), 0)
+	require.NoError(t, err)
+
+	return sqlDB
+}
+
+// TestPostgresStorage runs against BLOCKACTION_TEST_POSTGRES_DSN and is
+// skipped when it is unset. The user table is emptied before every test.
+func TestPostgresStorage(t *testing.T) {
+	dsn := os.Getenv("BLOCKACTION_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("BLOCKACTION_TEST_POSTGRES_DSN is not set")
+	}
+	storagetest.Run(t, func(t *testing.T) storage.IStorage {
+		db, err := storage.NewBlockActionPostgres(context.Background(), storage.BlockActionPostgresCfg{DSN: dsn, MaxOpenConn: 10})
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		sqlDB := migrate(t, db, migration.Postgres{})
+		_, err = sqlDB.Exec(`DELETE FROM "user"`)
+		require.NoError(t, err)
+		return db
+	})
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+)
+
+// ScanUsers returns up to limit users with an ID above afterID in ID order,
+// soft deleted users included, for jobs walking the whole table.
+func (db *BlockActionDB) ScanUsers(ctx context.Context, afterID int64, limit int) (entities []UserTable, err error) {
+	conn, cancel := db.query(ctx)
+	defer cancel()
+	err = conn.Table(UserTable{}.TableName()).
+		Where("id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Find(&entities).
+		Error
+
+	return entities, db.mapError(err)
+}
+
+// ImportUser copies a user and its history from another database as they
+// are, only the history gets new IDs. It fails with ErrConflict when the
+// user exists.
+func (db *BlockActionDB) ImportUser(ctx context.Context, entity UserTable, history []UserHistoryTable) error {
+	return db.atomic(ctx, func(tx *BlockActionDB) error {
+		err := tx.create(ctx, entity.TableName(), &entity)
+		if err != nil {
+			return err
+		}
+		for _, h := range history {
+			h.ID = 0
+			err = tx.create(ctx, h.TableName(), &h)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PurgeUser removes a user, its history and refresh tokens for good, it is
+// meant for users moved to another database.
+func (db *BlockActionDB) PurgeUser(ctx context.Context, id int64) error {
+	return db.atomic(ctx, func(tx *BlockActionDB) error {
+		err := tx.revokeRefreshTokens(ctx, id)
+		if err != nil {
+			return err
+		}
+		conn, cancel := tx.query(ctx)
+		defer cancel()
+		err = conn.Table(UserHistoryTable{}.TableName()).
+			Where("user_id = ?", id).
+			Delete(&UserHistoryTable{}).
+			Error
+		if err != nil {
+			return err
+		}
+		return conn.Table(UserTable{}.TableName()).
+			Where("id = ?", id).
+			Delete(&UserTable{}).
+			Error
+	})
+}
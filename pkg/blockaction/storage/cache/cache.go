@@ -0,0 +1,370 @@
+// Package cache decorates an IStorage with a read-through cache.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+)
+
+const (
+	RESULT_HIT      = "hit"
+	RESULT_MISS     = "miss"
+	RESULT_NEGATIVE = "negative_hit"
+	RESULT_ERROR    = "error"
+)
+
+var (
+	_cacheMetrics = &CacheMetrics{
+		RequestTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "storage_cache_request_total",
+				Help: "Storage cache lookups by operation and result",
+			},
+			[]string{"op", "result"},
+		),
+	}
+)
+
+var _ storage.IStorage = (*Storage)(nil)
+
+// Storage serves user lookups from the store and invalidates them on writes.
+// Misses of the same key are coalesced into one call to the next storage.
+type Storage struct {
+	next  storage.IStorage
+	store Store
+	opts  CacheOptions
+	group singleflight.Group
+
+	mu          sync.Mutex
+	generations map[string]*generation // 載入中的 key
+}
+
+// generation of a key, bumped by every invalidation while loads of the key
+// are running, so a load that read the record before a write does not
+// cache it.
+type generation struct {
+	n     uint64
+	loads int
+}
+
+type CacheOptions struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+}
+
+type CacheOption func(*CacheOptions)
+
+func DefaultOptions() CacheOptions {
+	return CacheOptions{
+		ttl:         time.Minute,
+		negativeTTL: 10 * time.Second,
+	}
+}
+
+func SetTTL(ttl time.Duration) CacheOption {
+	return func(o *CacheOptions) {
+		o.ttl = ttl
+	}
+}
+
+// SetNegativeTTL sets how long a missing record is remembered, 0 disables
+// negative caching.
+func SetNegativeTTL(ttl time.Duration) CacheOption {
+	return func(o *CacheOptions) {
+		o.negativeTTL = ttl
+	}
+}
+
+func New(next storage.IStorage, store Store, opts ...CacheOption) *Storage {
+	prometheus.Register(_cacheMetrics)
+	s := &Storage{
+		next:        next,
+		store:       store,
+		opts:        DefaultOptions(),
+		generations: make(map[string]*generation),
+	}
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+
+	return s
+}
+
+// entry is the cached form of a lookup, Found false caches ErrNotFound.
+type entry struct {
+	Found bool              `json:"found"`
+	User  storage.UserTable `json:"user"`
+}
+
+func idKey(id int64) string {
+	return "user:id:" + strconv.FormatInt(id, 10)
+}
+
+func accountKey(account string) string {
+	return "user:account:" + account
+}
+
+func (s *Storage) CreateUser(ctx context.Context, entity storage.UserTable) error {
+	err := s.next.CreateUser(ctx, entity)
+	// drop negative entries of the new keys even when the write failed,
+	// a conflict proves the record exists
+	s.invalidate(ctx, idKey(entity.ID), accountKey(entity.Account))
+
+	return err
+}
+
+func (s *Storage) UpdateUser(ctx context.Context, entity storage.UserTable) (storage.UserTable, error) {
+	// a failed update returns no account, the keys are read before
+	keys := userKeys(ctx, s.next, entity.ID, entity.Account)
+	updated, err := s.next.UpdateUser(ctx, entity)
+	s.invalidate(ctx, keys...)
+
+	return updated, err
+}
+
+func (s *Storage) DeleteUser(ctx context.Context, id int64, updater int64) error {
+	keys := userKeys(ctx, s.next, id, "")
+	err := s.next.DeleteUser(ctx, id, updater)
+	s.invalidate(ctx, keys...)
+
+	return err
+}
+
+// userKeys returns the keys of a user about to change. Its account key is
+// that of the stored user, or account when the user is not found.
+func userKeys(ctx context.Context, next storage.IStorage, id int64, account string) []string {
+	keys := []string{idKey(id)}
+	u, err := next.GetUser(ctx, id)
+	if err == nil {
+		account = u.Account
+	}
+	if account != "" {
+		keys = append(keys, accountKey(account))
+	}
+
+	return keys
+}
+
+// GetUserHistory is not cached, it is read rarely and changes on every
+// write.
+func (s *Storage) GetUserHistory(ctx context.Context, id int64) ([]storage.UserHistoryTable, error) {
+	return s.next.GetUserHistory(ctx, id)
+}
+
+// CreateRefreshToken is not cached, refresh tokens are written on use.
+func (s *Storage) CreateRefreshToken(ctx context.Context, entity storage.RefreshTokenTable) error {
+	return s.next.CreateRefreshToken(ctx, entity)
+}
+
+func (s *Storage) RotateRefreshToken(ctx context.Context, jti string, next storage.RefreshTokenTable) error {
+	return s.next.RotateRefreshToken(ctx, jti, next)
+}
+
+// WithTx reads and writes through to the transaction of the next storage,
+// the keys it wrote are invalidated once it ends.
+func (s *Storage) WithTx(ctx context.Context, fn func(tx storage.IStorage) error) error {
+	tx := &txStorage{}
+	err := s.next.WithTx(ctx, func(next storage.IStorage) error {
+		tx.IStorage = next
+		return fn(tx)
+	})
+	// a lookup during the transaction may have cached the keys as missing
+	if len(tx.keys) > 0 {
+		s.invalidate(ctx, tx.keys...)
+	}
+
+	return err
+}
+
+// txStorage records the keys written in a transaction, across retries.
+type txStorage struct {
+	storage.IStorage
+	keys []string
+}
+
+func (tx *txStorage) CreateUser(ctx context.Context, entity storage.UserTable) error {
+	tx.keys = append(tx.keys, idKey(entity.ID), accountKey(entity.Account))
+
+	return tx.IStorage.CreateUser(ctx, entity)
+}
+
+func (tx *txStorage) UpdateUser(ctx context.Context, entity storage.UserTable) (storage.UserTable, error) {
+	tx.keys = append(tx.keys, userKeys(ctx, tx.IStorage, entity.ID, entity.Account)...)
+
+	return tx.IStorage.UpdateUser(ctx, entity)
+}
+
+func (tx *txStorage) DeleteUser(ctx context.Context, id int64, updater int64) error {
+	tx.keys = append(tx.keys, userKeys(ctx, tx.IStorage, id, "")...)
+
+	return tx.IStorage.DeleteUser(ctx, id, updater)
+}
+
+func (tx *txStorage) WithTx(ctx context.Context, fn func(tx storage.IStorage) error) error {
+	return fn(tx)
+}
+
+func (s *Storage) IsExistUserAccount(ctx context.Context, account string) (exist bool, err error) {
+	_, err = s.GetUserByAccount(ctx, account)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *Storage) GetUser(ctx context.Context, id int64) (entity storage.UserTable, err error) {
+	return s.get(ctx, "get_user", idKey(id), func(ctx context.Context) (storage.UserTable, error) {
+		return s.next.GetUser(ctx, id)
+	})
+}
+
+func (s *Storage) GetUserByAccount(ctx context.Context, account string) (entity storage.UserTable, err error) {
+	return s.get(ctx, "get_user_by_account", accountKey(account), func(ctx context.Context) (storage.UserTable, error) {
+		return s.next.GetUserByAccount(ctx, account)
+	})
+}
+
+func (s *Storage) get(ctx context.Context, op, key string, load func(ctx context.Context) (storage.UserTable, error)) (storage.UserTable, error) {
+	if err := ctx.Err(); err != nil {
+		return storage.UserTable{}, err
+	}
+	b, ok, err := s.store.Get(ctx, key)
+	if err != nil {
+		// a failing cache degrades to reading through
+		_cacheMetrics.RequestTotal.WithLabelValues(op, RESULT_ERROR).Inc()
+		slog.Warn("storage cache get fail", "key", key, "error", err)
+	}
+	if ok {
+		var e entry
+		if json.Unmarshal(b, &e) == nil {
+			if !e.Found {
+				_cacheMetrics.RequestTotal.WithLabelValues(op, RESULT_NEGATIVE).Inc()
+				return storage.UserTable{}, storage.ErrNotFound
+			}
+			_cacheMetrics.RequestTotal.WithLabelValues(op, RESULT_HIT).Inc()
+			return e.User, nil
+		}
+	}
+	_cacheMetrics.RequestTotal.WithLabelValues(op, RESULT_MISS).Inc()
+
+	ch := s.group.DoChan(key, func() (interface{}, error) {
+		gen := s.beginLoad(key)
+		// the shared load outlives callers that give up waiting
+		u, err := load(context.WithoutCancel(ctx))
+		if s.isCurrent(key, gen) {
+			switch {
+			case err == nil:
+				s.set(ctx, key, entry{Found: true, User: u}, s.opts.ttl)
+			case errors.Is(err, storage.ErrNotFound) && s.opts.negativeTTL > 0:
+				s.set(ctx, key, entry{Found: false}, s.opts.negativeTTL)
+			}
+		}
+		// an invalidation between the check and the set has deleted the
+		// key before the set, delete it again
+		if !s.endLoad(key, gen) {
+			s.delete(ctx, key)
+		}
+		return u, err
+	})
+	select {
+	case <-ctx.Done():
+		return storage.UserTable{}, ctx.Err()
+	case r := <-ch:
+		if r.Err != nil {
+			return storage.UserTable{}, r.Err
+		}
+		return r.Val.(storage.UserTable), nil
+	}
+}
+
+func (s *Storage) set(ctx context.Context, key string, e entry, ttl time.Duration) {
+	b, err := json.Marshal(e)
+	if err == nil {
+		err = s.store.Set(context.WithoutCancel(ctx), key, b, ttl)
+	}
+	if err != nil {
+		slog.Warn("storage cache set fail", "key", key, "error", err)
+	}
+}
+
+func (s *Storage) beginLoad(key string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.generations[key]
+	if !ok {
+		g = new(generation)
+		s.generations[key] = g
+	}
+	g.loads++
+
+	return g.n
+}
+
+func (s *Storage) isCurrent(key string, gen uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.generations[key].n == gen
+}
+
+// endLoad reports whether the key was not invalidated during the load.
+func (s *Storage) endLoad(key string, gen uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.generations[key]
+	g.loads--
+	if g.loads == 0 {
+		delete(s.generations, key)
+	}
+
+	return g.n == gen
+}
+
+func (s *Storage) invalidate(ctx context.Context, keys ...string) {
+	// the generations are bumped before the delete, a running load either
+	// sees it or has set its entry before the delete
+	s.mu.Lock()
+	for _, key := range keys {
+		if g, ok := s.generations[key]; ok {
+			g.n++
+		}
+	}
+	s.mu.Unlock()
+	for _, key := range keys {
+		s.group.Forget(key)
+	}
+	s.delete(ctx, keys...)
+}
+
+func (s *Storage) delete(ctx context.Context, keys ...string) {
+	err := s.store.Delete(context.WithoutCancel(ctx), keys...)
+	if err != nil {
+		slog.Error("storage cache invalidate fail", "keys", keys, "error", err)
+	}
+}
+
+type CacheMetrics struct {
+	RequestTotal *prometheus.CounterVec
+}
+
+func (m *CacheMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.RequestTotal.Collect(ch)
+}
+
+func (m *CacheMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.RequestTotal.Describe(ch)
+}
@@ -0,0 +1,234 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage/storagetest"
+)
+
+// countingStorage counts the lookups reaching the wrapped storage, gate
+// blocks them until closed when set.
+type countingStorage struct {
+	storage.IStorage
+	gets atomic.Int64
+	gate chan struct{}
+}
+
+func (c *countingStorage) GetUser(ctx context.Context, id int64) (storage.UserTable, error) {
+	c.gets.Add(1)
+	if c.gate != nil {
+		<-c.gate
+	}
+	return c.IStorage.GetUser(ctx, id)
+}
+
+func (c *countingStorage) GetUserByAccount(ctx context.Context, account string) (storage.UserTable, error) {
+	c.gets.Add(1)
+	return c.IStorage.GetUserByAccount(ctx, account)
+}
+
+// slowStorage reads the user at once on the first lookup, then holds it
+// until gate is closed. read is closed after the read.
+type slowStorage struct {
+	storage.IStorage
+	gets atomic.Int64
+	read chan struct{}
+	gate chan struct{}
+}
+
+func (s *slowStorage) GetUser(ctx context.Context, id int64) (storage.UserTable, error) {
+	u, err := s.IStorage.GetUser(ctx, id)
+	if s.gets.Add(1) == 1 {
+		close(s.read)
+		<-s.gate
+	}
+	return u, err
+}
+
+func newRedisStore(t *testing.T) (*Redis, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedis(client, "test:"), mr
+}
+
+func TestConformance(t *testing.T) {
+	t.Run("lru", func(t *testing.T) {
+		storagetest.Run(t, func(t *testing.T) storage.IStorage {
+			return New(storage.NewMemoryStorage(), NewLRU(100))
+		})
+	})
+	t.Run("redis", func(t *testing.T) {
+		storagetest.Run(t, func(t *testing.T) storage.IStorage {
+			store, _ := newRedisStore(t)
+			return New(storage.NewMemoryStorage(), store)
+		})
+	})
+}
+
+func TestReadThrough(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range map[string]func(t *testing.T) Store{
+		"lru":   func(t *testing.T) Store { return NewLRU(100) },
+		"redis": func(t *testing.T) Store { s, _ := newRedisStore(t); return s },
+	} {
+		t.Run(name, func(t *testing.T) {
+			next := &countingStorage{IStorage: storage.NewMemoryStorage()}
+			s := New(next, store(t))
+
+			// negative entry, then invalidated by the write
+			_, err := s.GetUser(ctx, 1)
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+			_, err = s.GetUser(ctx, 1)
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+			assert.Equal(t, int64(1), next.gets.Load())
+
+			require.NoError(t, s.CreateUser(ctx, storage.UserTable{ID: 1, Account: "alice"}))
+			u, err := s.GetUser(ctx, 1)
+			require.NoError(t, err)
+			assert.Equal(t, "alice", u.Account)
+			u, err = s.GetUser(ctx, 1)
+			require.NoError(t, err)
+			assert.Equal(t, "alice", u.Account)
+			assert.Equal(t, int64(2), next.gets.Load())
+		})
+	}
+}
+
+func TestFailedUpdateInvalidates(t *testing.T) {
+	ctx := context.Background()
+	mem := storage.NewMemoryStorage()
+	require.NoError(t, mem.CreateUser(ctx, storage.UserTable{ID: 1, Account: "alice", Version: 1}))
+	store := NewLRU(100)
+	s := New(mem, store)
+	_, err := s.GetUserByAccount(ctx, "alice")
+	require.NoError(t, err)
+
+	// the entity of a failed update carries no account
+	for _, do := range []func(storage.IStorage) error{
+		func(next storage.IStorage) error {
+			_, err := next.UpdateUser(ctx, storage.UserTable{ID: 1, Version: 9})
+			return err
+		},
+		func(next storage.IStorage) error {
+			return next.WithTx(ctx, func(tx storage.IStorage) error {
+				_, err := tx.UpdateUser(ctx, storage.UserTable{ID: 1, Version: 9})
+				return err
+			})
+		},
+	} {
+		_, err = s.GetUserByAccount(ctx, "alice")
+		require.NoError(t, err)
+		assert.Error(t, do(s))
+		_, ok, err := store.Get(ctx, accountKey("alice"))
+		require.NoError(t, err)
+		assert.False(t, ok)
+	}
+}
+
+func TestNegativeTTL(t *testing.T) {
+	ctx := context.Background()
+	store, mr := newRedisStore(t)
+	next := &countingStorage{IStorage: storage.NewMemoryStorage()}
+	s := New(next, store, SetNegativeTTL(time.Second))
+
+	_, err := s.GetUserByAccount(ctx, "bob")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	exist, err := s.IsExistUserAccount(ctx, "bob")
+	require.NoError(t, err)
+	assert.False(t, exist)
+	assert.Equal(t, int64(1), next.gets.Load())
+
+	mr.FastForward(2 * time.Second)
+	_, err = s.GetUserByAccount(ctx, "bob")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.Equal(t, int64(2), next.gets.Load())
+}
+
+func TestSingleflight(t *testing.T) {
+	ctx := context.Background()
+	mem := storage.NewMemoryStorage()
+	require.NoError(t, mem.CreateUser(ctx, storage.UserTable{ID: 1, Account: "alice"}))
+	next := &countingStorage{IStorage: mem, gate: make(chan struct{})}
+	s := New(next, NewLRU(100))
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u, err := s.GetUser(ctx, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, "alice", u.Account)
+		}()
+	}
+	assert.Eventually(t, func() bool { return next.gets.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	close(next.gate)
+	wg.Wait()
+	assert.Equal(t, int64(1), next.gets.Load())
+}
+
+func TestInvalidateDuringLoad(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range map[string]func(t *testing.T) Store{
+		"lru":   func(t *testing.T) Store { return NewLRU(100) },
+		"redis": func(t *testing.T) Store { s, _ := newRedisStore(t); return s },
+	} {
+		t.Run(name, func(t *testing.T) {
+			mem := storage.NewMemoryStorage()
+			require.NoError(t, mem.CreateUser(ctx, storage.UserTable{ID: 1, Account: "alice", Name: "old", Version: 1}))
+			next := &slowStorage{IStorage: mem, read: make(chan struct{}), gate: make(chan struct{})}
+			s := New(next, store(t))
+
+			// the load reads the old row, the update lands before it returns
+			loaded := make(chan storage.UserTable)
+			go func() {
+				u, err := s.GetUser(ctx, 1)
+				assert.NoError(t, err)
+				loaded <- u
+			}()
+			<-next.read
+			u, err := mem.GetUser(ctx, 1)
+			require.NoError(t, err)
+			u.Name = "new"
+			_, err = s.UpdateUser(ctx, u)
+			require.NoError(t, err)
+			close(next.gate)
+			assert.Equal(t, "old", (<-loaded).Name)
+
+			u, err = s.GetUser(ctx, 1)
+			require.NoError(t, err)
+			assert.Equal(t, "new", u.Name)
+			assert.Empty(t, s.generations)
+		})
+	}
+}
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	l := NewLRU(2)
+	require.NoError(t, l.Set(ctx, "a", []byte("1"), time.Minute))
+	require.NoError(t, l.Set(ctx, "b", []byte("2"), time.Minute))
+	_, ok, _ := l.Get(ctx, "a")
+	assert.True(t, ok)
+	require.NoError(t, l.Set(ctx, "c", []byte("3"), time.Minute))
+	assert.Equal(t, 2, l.Len())
+	_, ok, _ = l.Get(ctx, "b")
+	assert.False(t, ok, "least recently used entry is evicted")
+
+	require.NoError(t, l.Set(ctx, "d", []byte("4"), -time.Second))
+	_, ok, _ = l.Get(ctx, "d")
+	assert.False(t, ok, "expired entry is a miss")
+}
@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store holds encoded records, it is either the in-process LRU or Redis.
+type Store interface {
+	// Get reports ok false on a miss.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+var (
+	_ Store = (*LRU)(nil)
+	_ Store = (*Redis)(nil)
+)
+
+// LRU is a size bound in-process store, safe for concurrent use. Expired
+// entries are dropped when read or evicted.
+type LRU struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key      string
+	value    []byte
+	expireAt time.Time
+}
+
+func NewLRU(size int) *LRU {
+	return &LRU{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (l *LRU) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	el, ok := l.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expireAt) {
+		l.remove(el)
+		return nil, false, nil
+	}
+	l.order.MoveToFront(el)
+
+	return entry.value, true, nil
+}
+
+func (l *LRU) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	expireAt := time.Now().Add(ttl)
+	if el, ok := l.entries[key]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.value, entry.expireAt = value, expireAt
+		l.order.MoveToFront(el)
+		return nil
+	}
+	l.entries[key] = l.order.PushFront(&lruEntry{key: key, value: value, expireAt: expireAt})
+	for l.size > 0 && l.order.Len() > l.size {
+		l.remove(l.order.Back())
+	}
+
+	return nil
+}
+
+func (l *LRU) Delete(ctx context.Context, keys ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := l.entries[key]; ok {
+			l.remove(el)
+		}
+	}
+
+	return nil
+}
+
+func (l *LRU) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
+
+func (l *LRU) remove(el *list.Element) {
+	l.order.Remove(el)
+	delete(l.entries, el.Value.(*lruEntry).key)
+}
+
+// Redis shares the cache between instances, keys are prefixed so the
+// database can be shared with other services.
+type Redis struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func NewRedis(client redis.UniversalClient, prefix string) *Redis {
+	return &Redis{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := r.client.Get(ctx, r.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return value, true, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(ctx, r.prefix+key, value, ttl).Err()
+}
+
+func (r *Redis) Delete(ctx context.Context, keys ...string) error {
+	prefixed := make([]string, 0, len(keys))
+	for _, key := range keys {
+		prefixed = append(prefixed, r.prefix+key)
+	}
+
+	return r.client.Del(ctx, prefixed...).Err()
+}
+
+func (r *Redis) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
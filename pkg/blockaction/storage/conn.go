@@ -6,11 +6,30 @@ import (
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/ncruces/go-sqlite3/embed"
+	"github.com/ncruces/go-sqlite3/gormlite"
 	gormmysqldriver "gorm.io/driver/mysql"
+	gormpostgresdriver "gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+// ConnMySQL opens a pool and pings the database within the deadline of ctx.
 func ConnMySQL(ctx context.Context, dsn string, maxOpenConn, maxIdleConn, maxConnLifetime int) (*dbsql.DB, error) {
+	db, err := openMySQL(dsn, maxOpenConn, maxIdleConn, maxConnLifetime)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ping(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func openMySQL(dsn string, maxOpenConn, maxIdleConn, maxConnLifetime int) (*dbsql.DB, error) {
 	db, err := dbsql.Open("mysql", dsn)
 	if err != nil {
 		return nil, err
@@ -23,17 +42,95 @@ func ConnMySQL(ctx context.Context, dsn string, maxOpenConn, maxIdleConn, maxCon
 	return db, nil
 }
 
+// ConnGormMySQL is ConnMySQL for GORM. GORM neither pings nor queries the
+// server version, which it would do without a deadline.
 func ConnGormMySQL(ctx context.Context, dsn string, maxOpenConn, maxIdleConn, maxConnLifetime int) (*gorm.DB, error) {
 	db, err := ConnMySQL(ctx, dsn, maxOpenConn, maxIdleConn, maxConnLifetime)
 	if err != nil {
 		return nil, err
 	}
 
+	return gormMySQL(db)
+}
+
+func gormMySQL(db *dbsql.DB) (*gorm.DB, error) {
 	cfg := gormmysqldriver.Config{
+		Conn:                      db,
+		SkipInitializeWithVersion: true,
+	}
+	conn, err := gorm.Open(gormmysqldriver.New(cfg), &gorm.Config{DisableAutomaticPing: true})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// ping closes db when it cannot be reached within the deadline of ctx.
+func ping(ctx context.Context, db *dbsql.DB) error {
+	err := db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return err
+	}
+
+	return nil
+}
+
+// ConnGormSQLite opens the SQLite database file, writers wait on each other
+// up to the busy timeout.
+func ConnGormSQLite(ctx context.Context, file string) (*gorm.DB, error) {
+	dsn := "file:" + file + "?_pragma=busy_timeout(10000)&_pragma=journal_mode(wal)"
+	conn, err := gorm.Open(gormlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	db, err := conn.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	err = ping(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// ConnPostgres opens a pool and pings the database within the deadline of
+// ctx.
+func ConnPostgres(ctx context.Context, dsn string, maxOpenConn, maxIdleConn, maxConnLifetime int) (*dbsql.DB, error) {
+	db, err := dbsql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetConnMaxLifetime(time.Duration(maxConnLifetime) * time.Second)
+	db.SetMaxOpenConns(maxOpenConn)
+	db.SetMaxIdleConns(maxIdleConn)
+
+	err = ping(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func ConnGormPostgres(ctx context.Context, dsn string, maxOpenConn, maxIdleConn, maxConnLifetime int) (*gorm.DB, error) {
+	db, err := ConnPostgres(ctx, dsn, maxOpenConn, maxIdleConn, maxConnLifetime)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := gormpostgresdriver.Config{
 		Conn: db,
 	}
-	conn, err := gorm.Open(gormmysqldriver.New(cfg), &gorm.Config{})
+	conn, err := gorm.Open(gormpostgresdriver.New(cfg), &gorm.Config{DisableAutomaticPing: true})
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
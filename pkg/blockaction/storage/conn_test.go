@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// silentServer accepts connections and never greets, like a host that hangs.
+func silentServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		var conns []net.Conn
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				for _, conn := range conns {
+					conn.Close()
+				}
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestConnectDeadline(t *testing.T) {
+	cfg := BlockActionDBCfg{UserName: "app", Password: "secret", Address: silentServer(t), DBName: "blockaction"}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := NewBlockActionDB(ctx, cfg)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
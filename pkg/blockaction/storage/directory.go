@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DirectoryTable maps the accounts of active users to their ID, so a
+// sharded storage finds the shard of an account.
+type DirectoryTable struct {
+	Account   string `gorm:"<-:create;column:account;type:varchar(45);primaryKey;"` // 帳號
+	UserID    int64  `gorm:"<-:create;column:user_id;type:bigint;not null;"`        // 會員 ID
+	CreatedAt int64  `gorm:"<-:create;column:created_at;type:bigint;not null;"`     // 建立時間
+}
+
+func (DirectoryTable) TableName() string {
+	return "user_directory"
+}
+
+// ReserveAccount maps account to id, it fails with ErrConflict when the
+// account is taken, by id or another user.
+func (db *BlockActionDB) ReserveAccount(ctx context.Context, account string, id int64) error {
+	markWrite(ctx)
+	entity := DirectoryTable{
+		Account:   account,
+		UserID:    id,
+		CreatedAt: time.Now().UnixMilli(),
+	}
+
+	return db.mapError(db.create(ctx, entity.TableName(), &entity))
+}
+
+func (db *BlockActionDB) LookupAccount(ctx context.Context, account string) (id int64, err error) {
+	var entity DirectoryTable
+	err = db.read(ctx, func(conn *gorm.DB) error {
+		return conn.Table(entity.TableName()).
+			Where("account = ?", account).
+			First(&entity).
+			Error
+	})
+
+	return entity.UserID, err
+}
+
+// ReleaseAccount removes the mapping of account, as long as it maps to id.
+func (db *BlockActionDB) ReleaseAccount(ctx context.Context, account string, id int64) error {
+	markWrite(ctx)
+	conn, cancel := db.query(ctx)
+	defer cancel()
+	err := conn.Table(DirectoryTable{}.TableName()).
+		Where("account = ? AND user_id = ?", account, id).
+		Delete(&DirectoryTable{}).
+		Error
+
+	return db.mapError(err)
+}
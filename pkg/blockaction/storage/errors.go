@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/ncruces/go-sqlite3"
+	"gorm.io/gorm"
+)
+
+const (
+	MYSQL_ER_DUP_ENTRY         = 1062
+	MYSQL_ER_LOCK_WAIT_TIMEOUT = 1205
+	MYSQL_ER_LOCK_DEADLOCK     = 1213
+
+	PG_UNIQUE_VIOLATION        = "23505"
+	PG_SERIALIZATION_FAILURE   = "40001"
+	PG_DEADLOCK_DETECTED       = "40P01"
+	PG_CLASS_CONNECTION        = "08"
+	PG_CLASS_INSUFFICIENT      = "53"
+	PG_CLASS_OPERATOR_INTERVEN = "57"
+)
+
+var (
+	ErrNotFound    = errors.New("record not found")
+	ErrConflict    = errors.New("record conflict")
+	ErrUnavailable = errors.New("storage unavailable")
+	// ErrDeadlock is a transaction aborted by a deadlock or lock wait
+	// timeout, it succeeds when run again.
+	ErrDeadlock = errors.New("transaction deadlock")
+	// ErrStaleVersion is an update of a user changed since it was read, it
+	// is also an ErrConflict.
+	ErrStaleVersion = fmt.Errorf("stale version : %w", ErrConflict)
+)
+
+// mysqlError wraps err with the sentinel error it stands for, the original
+// error is kept in the chain.
+func mysqlError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var myErr *mysql.MySQLError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return fmt.Errorf("%w : %w", ErrNotFound, err)
+	case errors.As(err, &myErr) && myErr.Number == MYSQL_ER_DUP_ENTRY:
+		return fmt.Errorf("%w : %w", ErrConflict, err)
+	case errors.As(err, &myErr) && (myErr.Number == MYSQL_ER_LOCK_DEADLOCK || myErr.Number == MYSQL_ER_LOCK_WAIT_TIMEOUT):
+		return fmt.Errorf("%w : %w", ErrDeadlock, err)
+	case errors.Is(err, driver.ErrBadConn),
+		errors.Is(err, mysql.ErrInvalidConn),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr):
+		return fmt.Errorf("%w : %w", ErrUnavailable, err)
+	}
+
+	return err
+}
+
+func sqliteError(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return fmt.Errorf("%w : %w", ErrNotFound, err)
+	case errors.Is(err, sqlite3.CONSTRAINT_UNIQUE),
+		errors.Is(err, sqlite3.CONSTRAINT_PRIMARYKEY):
+		return fmt.Errorf("%w : %w", ErrConflict, err)
+	case errors.Is(err, sqlite3.BUSY),
+		errors.Is(err, sqlite3.LOCKED),
+		errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w : %w", ErrUnavailable, err)
+	}
+
+	return err
+}
+
+func postgresError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var pgErr *pgconn.PgError
+	var connErr *pgconn.ConnectError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return fmt.Errorf("%w : %w", ErrNotFound, err)
+	case errors.As(err, &pgErr) && pgErr.Code == PG_UNIQUE_VIOLATION:
+		return fmt.Errorf("%w : %w", ErrConflict, err)
+	case errors.As(err, &pgErr) && (pgErr.Code == PG_SERIALIZATION_FAILURE || pgErr.Code == PG_DEADLOCK_DETECTED):
+		return fmt.Errorf("%w : %w", ErrDeadlock, err)
+	case errors.As(err, &pgErr) && (strings.HasPrefix(pgErr.Code, PG_CLASS_CONNECTION) ||
+		strings.HasPrefix(pgErr.Code, PG_CLASS_INSUFFICIENT) ||
+		strings.HasPrefix(pgErr.Code, PG_CLASS_OPERATOR_INTERVEN)),
+		errors.As(err, &connErr),
+		errors.Is(err, driver.ErrBadConn),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr):
+		return fmt.Errorf("%w : %w", ErrUnavailable, err)
+	}
+
+	return err
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestMySQLError(t *testing.T) {
+	assert.Nil(t, mysqlError(nil))
+	assert.ErrorIs(t, mysqlError(gorm.ErrRecordNotFound), ErrNotFound)
+
+	dup := &mysql.MySQLError{Number: MYSQL_ER_DUP_ENTRY, Message: "Duplicate entry"}
+	err := mysqlError(dup)
+	assert.ErrorIs(t, err, ErrConflict)
+	var myErr *mysql.MySQLError
+	assert.True(t, errors.As(err, &myErr))
+
+	assert.ErrorIs(t, mysqlError(&mysql.MySQLError{Number: MYSQL_ER_LOCK_DEADLOCK}), ErrDeadlock)
+	assert.ErrorIs(t, mysqlError(&mysql.MySQLError{Number: MYSQL_ER_LOCK_WAIT_TIMEOUT}), ErrDeadlock)
+	assert.ErrorIs(t, mysqlError(mysql.ErrInvalidConn), ErrUnavailable)
+	assert.ErrorIs(t, mysqlError(context.DeadlineExceeded), ErrUnavailable)
+
+	other := errors.New("syntax error")
+	assert.Equal(t, other, mysqlError(other))
+}
+
+func TestPostgresError(t *testing.T) {
+	assert.ErrorIs(t, postgresError(gorm.ErrRecordNotFound), ErrNotFound)
+	assert.ErrorIs(t, postgresError(&pgconn.PgError{Code: PG_UNIQUE_VIOLATION}), ErrConflict)
+	assert.ErrorIs(t, postgresError(&pgconn.PgError{Code: PG_DEADLOCK_DETECTED}), ErrDeadlock)
+	assert.ErrorIs(t, postgresError(&pgconn.PgError{Code: PG_SERIALIZATION_FAILURE}), ErrDeadlock)
+	assert.ErrorIs(t, postgresError(&pgconn.PgError{Code: "57P01"}), ErrUnavailable)
+	assert.ErrorIs(t, postgresError(&pgconn.PgError{Code: "08006"}), ErrUnavailable)
+
+	syntax := &pgconn.PgError{Code: "42601"}
+	assert.Equal(t, syntax, postgresError(syntax))
+}
+
+func TestPostgresDSN(t *testing.T) {
+	cfg := BlockActionPostgresCfg{UserName: "app", Password: "p@ss/word", Address: "db:5432", DBName: "blockaction", SSLMode: "disable"}
+	assert.Equal(t, "postgres://app:p%40ss%2Fword@db:5432/blockaction?sslmode=disable", cfg.GetDSN())
+}
+
+func TestMySQLDSN(t *testing.T) {
+	cfg := BlockActionDBCfg{UserName: "app", Password: "secret", Address: "db:3306", DBName: "blockaction", ConnectTimeout: 5 * time.Second}
+	c, err := mysql.ParseDSN(cfg.GetDSN())
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, c.Timeout)
+	assert.True(t, c.ParseTime)
+
+	cfg.DSN = "app:secret@tcp(db:3306)/blockaction?timeout=1s"
+	c, err = mysql.ParseDSN(cfg.GetDSN())
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, c.Timeout)
+}
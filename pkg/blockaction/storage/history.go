@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	HISTORY_ACTION_CREATE = "create"
+	HISTORY_ACTION_UPDATE = "update"
+	HISTORY_ACTION_DELETE = "delete"
+)
+
+// UserHistoryTable records a mutation of a user, Before and After are JSON
+// snapshots without the secret.
+type UserHistoryTable struct {
+	ID        int64  `gorm:"<-:create;column:id;type:bigint;primaryKey;autoIncrement;"`                     // ID
+	UserID    int64  `gorm:"<-:create;column:user_id;type:bigint;not null;index:idx_user_history_user_id;"` // 會員 ID
+	Action    string `gorm:"<-:create;column:action;type:varchar(16);not null;"`                            // create, update, delete
+	Version   int64  `gorm:"<-:create;column:version;type:bigint;not null;"`                                // 異動後版本
+	Before    string `gorm:"<-:create;column:before_data;type:text;not null;"`                              // 異動前, create 為空
+	After     string `gorm:"<-:create;column:after_data;type:text;not null;"`                               // 異動後
+	Updater   int64  `gorm:"<-:create;column:updater;type:bigint;not null;"`                                // 修改者
+	CreatedAt int64  `gorm:"<-:create;column:created_at;type:bigint;not null;"`                             // 建立時間
+}
+
+func (UserHistoryTable) TableName() string {
+	return "user_history"
+}
+
+// UserSnapshot is the state of a user kept in its history.
+type UserSnapshot struct {
+	ID        int64  `json:"id"`
+	Account   string `json:"account"`
+	Name      string `json:"name"`
+	Desc      string `json:"description"`
+	State     int    `json:"state"`
+	Version   int64  `json:"version"`
+	CreatedAt int64  `json:"created_at"`
+	Creator   int64  `json:"creator"`
+	UpdatedAt int64  `json:"updated_at"`
+	Updater   int64  `json:"updater"`
+	DeletedAt int64  `json:"deleted_at"`
+}
+
+func (u UserTable) Snapshot() UserSnapshot {
+	return UserSnapshot{
+		ID:        u.ID,
+		Account:   u.Account,
+		Name:      u.Name,
+		Desc:      u.Desc,
+		State:     u.State,
+		Version:   u.Version,
+		CreatedAt: u.CreatedAt,
+		Creator:   u.Creator,
+		UpdatedAt: u.UpdatedAt,
+		Updater:   u.Updater,
+		DeletedAt: u.DeletedAt,
+	}
+}
+
+// newUserHistory records the change of a user from before to after, before
+// is nil for a create.
+func newUserHistory(action string, before *UserTable, after UserTable) UserHistoryTable {
+	h := UserHistoryTable{
+		UserID:    after.ID,
+		Action:    action,
+		Version:   after.Version,
+		Updater:   after.Updater,
+		CreatedAt: time.Now().UnixMilli(),
+	}
+	if before != nil {
+		b, _ := json.Marshal(before.Snapshot())
+		h.Before = string(b)
+	}
+	b, _ := json.Marshal(after.Snapshot())
+	h.After = string(b)
+
+	return h
+}
+
+// applyUpdate returns u with the mutable fields of entity, the next version
+// and the update time.
+func (u UserTable) applyUpdate(entity UserTable, now int64) UserTable {
+	u.Secret = entity.Secret
+	u.Name = entity.Name
+	u.Desc = entity.Desc
+	u.State = entity.State
+	u.Updater = entity.Updater
+	u.UpdatedAt = now
+	u.Version++
+
+	return u
+}
+
+// applyDelete returns u soft deleted at now.
+func (u UserTable) applyDelete(updater int64, now int64) UserTable {
+	u.Updater = updater
+	u.UpdatedAt = now
+	u.DeletedAt = now
+	u.Version++
+
+	return u
+}
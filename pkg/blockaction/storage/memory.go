@@ -0,0 +1,330 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var _ Backend = (*MemoryStorage)(nil)
+
+// MemoryStorage keeps users in process memory, safe for concurrent use. It
+// enforces the same unique keys as the database backends. Writes run one at
+// a time on a copy of the data that replaces it when they succeed, so reads
+// never see a partial transaction.
+type MemoryStorage struct {
+	txMu sync.Mutex // 寫入依序執行
+	data atomic.Pointer[memoryData]
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	m := &MemoryStorage{}
+	m.data.Store(&memoryData{
+		users:     make(map[int64]UserTable),
+		accountID: make(map[string]int64),
+		history:   make(map[int64][]UserHistoryTable),
+		refresh:   make(map[string]RefreshTokenTable),
+	})
+
+	return m
+}
+
+func (m *MemoryStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *MemoryStorage) Close() error {
+	return nil
+}
+
+func (m *MemoryStorage) CreateUser(ctx context.Context, entity UserTable) error {
+	return m.WithTx(ctx, func(tx IStorage) error {
+		return tx.CreateUser(ctx, entity)
+	})
+}
+
+func (m *MemoryStorage) UpdateUser(ctx context.Context, entity UserTable) (updated UserTable, err error) {
+	err = m.WithTx(ctx, func(tx IStorage) error {
+		updated, err = tx.UpdateUser(ctx, entity)
+		return err
+	})
+
+	return
+}
+
+func (m *MemoryStorage) DeleteUser(ctx context.Context, id int64, updater int64) error {
+	return m.WithTx(ctx, func(tx IStorage) error {
+		return tx.DeleteUser(ctx, id, updater)
+	})
+}
+
+func (m *MemoryStorage) IsExistUserAccount(ctx context.Context, account string) (exist bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	return m.data.Load().isExistUserAccount(account), nil
+}
+
+func (m *MemoryStorage) GetUser(ctx context.Context, id int64) (entity UserTable, err error) {
+	if err := ctx.Err(); err != nil {
+		return entity, err
+	}
+
+	return m.data.Load().getUser(id)
+}
+
+func (m *MemoryStorage) GetUserByAccount(ctx context.Context, account string) (entity UserTable, err error) {
+	if err := ctx.Err(); err != nil {
+		return entity, err
+	}
+
+	return m.data.Load().getUserByAccount(account)
+}
+
+func (m *MemoryStorage) GetUserHistory(ctx context.Context, id int64) ([]UserHistoryTable, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return slices.Clone(m.data.Load().history[id]), nil
+}
+
+func (m *MemoryStorage) CreateRefreshToken(ctx context.Context, entity RefreshTokenTable) error {
+	return m.WithTx(ctx, func(tx IStorage) error {
+		return tx.CreateRefreshToken(ctx, entity)
+	})
+}
+
+func (m *MemoryStorage) RotateRefreshToken(ctx context.Context, jti string, next RefreshTokenTable) error {
+	return m.WithTx(ctx, func(tx IStorage) error {
+		return tx.RotateRefreshToken(ctx, jti, next)
+	})
+}
+
+// WithTx runs fn on a copy of the data, which replaces the data when fn
+// returns nil. The tx passed to fn is not safe for concurrent use.
+func (m *MemoryStorage) WithTx(ctx context.Context, fn func(tx IStorage) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+	tx := &memoryTx{data: m.data.Load().clone()}
+	err := fn(tx)
+	if err != nil {
+		return err
+	}
+	m.data.Store(tx.data)
+
+	return nil
+}
+
+// memoryData is never changed once published, writes change a clone.
+type memoryData struct {
+	users     map[int64]UserTable
+	accountID map[string]int64 // 未刪除的帳號
+	history   map[int64][]UserHistoryTable
+	historyID int64
+	refresh   map[string]RefreshTokenTable // family 對應的 refresh token
+}
+
+func (d *memoryData) clone() *memoryData {
+	c := &memoryData{
+		users:     make(map[int64]UserTable, len(d.users)),
+		accountID: make(map[string]int64, len(d.accountID)),
+		history:   make(map[int64][]UserHistoryTable, len(d.history)),
+		historyID: d.historyID,
+		refresh:   make(map[string]RefreshTokenTable, len(d.refresh)),
+	}
+	for id, u := range d.users {
+		c.users[id] = u
+	}
+	for account, id := range d.accountID {
+		c.accountID[account] = id
+	}
+	for id, h := range d.history {
+		// appends of the clone must not reach the shared array
+		c.history[id] = slices.Clip(h)
+	}
+	for family, t := range d.refresh {
+		c.refresh[family] = t
+	}
+
+	return c
+}
+
+func (d *memoryData) isExistUserAccount(account string) bool {
+	_, ok := d.accountID[account]
+
+	return ok
+}
+
+func (d *memoryData) getUser(id int64) (UserTable, error) {
+	entity, ok := d.users[id]
+	if !ok || entity.DeletedAt != 0 {
+		return UserTable{}, ErrNotFound
+	}
+
+	return entity, nil
+}
+
+func (d *memoryData) getUserByAccount(account string) (UserTable, error) {
+	id, ok := d.accountID[account]
+	if !ok {
+		return UserTable{}, ErrNotFound
+	}
+
+	return d.users[id], nil
+}
+
+func (d *memoryData) record(action string, before *UserTable, after UserTable) {
+	d.historyID++
+	h := newUserHistory(action, before, after)
+	h.ID = d.historyID
+	d.history[after.ID] = append(d.history[after.ID], h)
+}
+
+// memoryTx changes a clone of the data, reading its own writes.
+type memoryTx struct {
+	data *memoryData
+}
+
+func (tx *memoryTx) CreateUser(ctx context.Context, entity UserTable) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	d := tx.data
+	if _, ok := d.users[entity.ID]; ok {
+		return ErrConflict
+	}
+	if _, ok := d.accountID[entity.Account]; ok {
+		return ErrConflict
+	}
+	now := time.Now().UnixMilli()
+	entity.CreatedAt = now
+	entity.UpdatedAt = now
+	entity.DeletedAt = 0
+	if entity.Version == 0 {
+		entity.Version = 1
+	}
+	d.users[entity.ID] = entity
+	d.accountID[entity.Account] = entity.ID
+	d.record(HISTORY_ACTION_CREATE, nil, entity)
+
+	return nil
+}
+
+func (tx *memoryTx) UpdateUser(ctx context.Context, entity UserTable) (UserTable, error) {
+	if err := ctx.Err(); err != nil {
+		return UserTable{}, err
+	}
+	before, err := tx.data.getUser(entity.ID)
+	if err != nil {
+		return UserTable{}, err
+	}
+	if before.Version != entity.Version {
+		return UserTable{}, ErrStaleVersion
+	}
+	updated := before.applyUpdate(entity, time.Now().UnixMilli())
+	tx.data.users[updated.ID] = updated
+	tx.data.record(HISTORY_ACTION_UPDATE, &before, updated)
+
+	return updated, nil
+}
+
+func (tx *memoryTx) DeleteUser(ctx context.Context, id int64, updater int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	before, err := tx.data.getUser(id)
+	if err != nil {
+		return err
+	}
+	deleted := before.applyDelete(updater, time.Now().UnixMilli())
+	tx.data.users[id] = deleted
+	delete(tx.data.accountID, deleted.Account)
+	tx.data.record(HISTORY_ACTION_DELETE, &before, deleted)
+	for family, t := range tx.data.refresh {
+		if t.UserID == id {
+			delete(tx.data.refresh, family)
+		}
+	}
+
+	return nil
+}
+
+func (tx *memoryTx) IsExistUserAccount(ctx context.Context, account string) (exist bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	return tx.data.isExistUserAccount(account), nil
+}
+
+func (tx *memoryTx) GetUser(ctx context.Context, id int64) (entity UserTable, err error) {
+	if err := ctx.Err(); err != nil {
+		return entity, err
+	}
+
+	return tx.data.getUser(id)
+}
+
+func (tx *memoryTx) GetUserByAccount(ctx context.Context, account string) (entity UserTable, err error) {
+	if err := ctx.Err(); err != nil {
+		return entity, err
+	}
+
+	return tx.data.getUserByAccount(account)
+}
+
+func (tx *memoryTx) GetUserHistory(ctx context.Context, id int64) ([]UserHistoryTable, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return slices.Clone(tx.data.history[id]), nil
+}
+
+func (tx *memoryTx) CreateRefreshToken(ctx context.Context, entity RefreshTokenTable) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if _, ok := tx.data.refresh[entity.Family]; ok {
+		return ErrConflict
+	}
+	now := time.Now().UnixMilli()
+	for family, t := range tx.data.refresh {
+		if t.UserID == entity.UserID && t.ExpiresAt <= now {
+			delete(tx.data.refresh, family)
+		}
+	}
+	entity.CreatedAt = now
+	entity.UpdatedAt = now
+	tx.data.refresh[entity.Family] = entity
+
+	return nil
+}
+
+func (tx *memoryTx) RotateRefreshToken(ctx context.Context, jti string, next RefreshTokenTable) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := time.Now().UnixMilli()
+	t, ok := tx.data.refresh[next.Family]
+	if !ok || t.UserID != next.UserID || t.JTI != jti || t.ExpiresAt <= now {
+		return ErrNotFound
+	}
+	t.JTI = next.JTI
+	t.ExpiresAt = next.ExpiresAt
+	t.UpdatedAt = now
+	tx.data.refresh[next.Family] = t
+
+	return nil
+}
+
+func (tx *memoryTx) WithTx(ctx context.Context, fn func(tx IStorage) error) error {
+	return fn(tx)
+}
@@ -0,0 +1,353 @@
+package migration
+
+import (
+	"context"
+	dbsql "database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	VERSION_TABLE = "schema_migrations"
+	LOCK_NAME     = "blockaction_schema_migrations"
+	LOCK_TIMEOUT  = 60 // 秒
+)
+
+//go:embed mysql/*.sql postgres/*.sql sqlite/*.sql
+var _fs embed.FS
+
+var _fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int64  `json:"version"`
+	Name      string `json:"name"`
+	Applied   bool   `json:"applied"`
+	AppliedAt int64  `json:"applied_at,omitempty"`
+}
+
+// Dialect holds the database specific parts of migrating.
+type Dialect interface {
+	Name() string
+	// Lock takes a lock held by conn that keeps other replicas from
+	// migrating at the same time.
+	Lock(ctx context.Context, conn *dbsql.Conn) error
+	Unlock(ctx context.Context, conn *dbsql.Conn) error
+	// HasTable reports whether table exists in the current database.
+	HasTable(ctx context.Context, conn *dbsql.Conn, table string) (bool, error)
+	// Rebind rewrites ? placeholders for the database.
+	Rebind(query string) string
+}
+
+// Migrations returns the migrations embedded for dialect, ordered by version.
+func Migrations(dialect string) ([]Migration, error) {
+	sub, err := fs.Sub(_fs, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return Load(sub)
+}
+
+// Load reads <version>_<name>.up.sql and .down.sql files from fsys.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		m := _fileName.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		b, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(b)
+		} else {
+			mig.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Latest returns the highest version of migrations.
+func Latest(migrations []Migration) int64 {
+	if len(migrations) == 0 {
+		return 0
+	}
+
+	return migrations[len(migrations)-1].Version
+}
+
+type Migrator struct {
+	db         *dbsql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+func NewMigrator(db *dbsql.DB, dialect Dialect) (*Migrator, error) {
+	migrations, err := Migrations(dialect.Name())
+	if err != nil {
+		return nil, fmt.Errorf("load migrations fail : %w", err)
+	}
+
+	return &Migrator{
+		db:         db,
+		dialect:    dialect,
+		migrations: migrations,
+	}, nil
+}
+
+func (m *Migrator) Latest() int64 {
+	return Latest(m.migrations)
+}
+
+// Version returns the highest applied version, 0 when none is applied.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	var version dbsql.NullInt64
+	err := m.db.QueryRowContext(ctx, "SELECT MAX(version) FROM "+VERSION_TABLE).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	return version.Int64, nil
+}
+
+// Status lists the migrations and whether they are applied. It only reads,
+// taking no lock and creating no table, so it is safe while another replica
+// migrates.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	exists, err := m.dialect.HasTable(ctx, conn, VERSION_TABLE)
+	if err != nil {
+		return nil, fmt.Errorf("check %s fail : %w", VERSION_TABLE, err)
+	}
+	// nothing is applied before the first migration creates the table
+	applied := make(map[int64]int64)
+	if exists {
+		applied, err = m.applied(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		appliedAt, ok := applied[mig.Version]
+		statuses = append(statuses, Status{
+			Version:   mig.Version,
+			Name:      mig.Name,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+	}
+
+	return statuses, nil
+}
+
+// Up applies at most steps pending migrations in version order, all of them
+// when steps is not positive.
+func (m *Migrator) Up(ctx context.Context, steps int) (applied []Migration, err error) {
+	err = m.withLock(ctx, func(conn *dbsql.Conn) error {
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := done[mig.Version]; ok {
+				continue
+			}
+			if steps > 0 && len(applied) >= steps {
+				break
+			}
+			err = execStatements(ctx, conn, mig.Up)
+			if err != nil {
+				return fmt.Errorf("migrate up %d_%s fail : %w", mig.Version, mig.Name, err)
+			}
+			_, err = conn.ExecContext(ctx, m.dialect.Rebind("INSERT INTO "+VERSION_TABLE+" (version, name, applied_at) VALUES (?, ?, ?)"),
+				mig.Version, mig.Name, time.Now().UnixMilli())
+			if err != nil {
+				return fmt.Errorf("record migration %d_%s fail : %w", mig.Version, mig.Name, err)
+			}
+			applied = append(applied, mig)
+		}
+		return nil
+	})
+
+	return
+}
+
+// Down reverts the last steps applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) (reverted []Migration, err error) {
+	err = m.withLock(ctx, func(conn *dbsql.Conn) error {
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := done[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migration %d_%s is irreversible", mig.Version, mig.Name)
+			}
+			err = execStatements(ctx, conn, mig.Down)
+			if err != nil {
+				return fmt.Errorf("migrate down %d_%s fail : %w", mig.Version, mig.Name, err)
+			}
+			_, err = conn.ExecContext(ctx, m.dialect.Rebind("DELETE FROM "+VERSION_TABLE+" WHERE version = ?"), mig.Version)
+			if err != nil {
+				return fmt.Errorf("record migration %d_%s fail : %w", mig.Version, mig.Name, err)
+			}
+			reverted = append(reverted, mig)
+		}
+		return nil
+	})
+
+	return
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *dbsql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = m.dialect.Lock(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("take migration lock fail : %w", err)
+	}
+	defer m.dialect.Unlock(context.Background(), conn)
+
+	_, err = conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+VERSION_TABLE+" (version BIGINT NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied_at BIGINT NOT NULL)")
+	if err != nil {
+		return fmt.Errorf("create %s fail : %w", VERSION_TABLE, err)
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *dbsql.Conn) (map[int64]int64, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM "+VERSION_TABLE)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[int64]int64)
+	for rows.Next() {
+		var version, appliedAt int64
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// execStatements runs a migration file statement by statement, so the
+// driver does not need multi statement support. Statements end with a
+// semicolon at the end of a line.
+func execStatements(ctx context.Context, conn *dbsql.Conn, script string) error {
+	for _, stmt := range splitStatements(script) {
+		_, err := conn.ExecContext(ctx, stmt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func splitStatements(script string) []string {
+	var stmts []string
+	var sb strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSpace(sb.String()))
+			sb.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(sb.String()); rest != "" {
+		stmts = append(stmts, rest)
+	}
+
+	return stmts
+}
+
+// Create writes empty up and down files for the next version into dir.
+func Create(dir, name string) (up, down string, err error) {
+	if !regexp.MustCompile(`^\w+$`).MatchString(name) {
+		return "", "", fmt.Errorf("migration name must only contain letters, digits and underscores")
+	}
+	migrations, err := Load(os.DirFS(dir))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", "", err
+	}
+	prefix := fmt.Sprintf("%04d_%s", Latest(migrations)+1, name)
+	up = filepath.Join(dir, prefix+".up.sql")
+	down = filepath.Join(dir, prefix+".down.sql")
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", "", err
+	}
+	for _, file := range []string{up, down} {
+		err = os.WriteFile(file, []byte("-- statements end with a semicolon at the end of a line\n"), 0644)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	return up, down, nil
+}
@@ -0,0 +1,154 @@
+package migration
+
+import (
+	"context"
+	dbsql "database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/ncruces/go-sqlite3/driver"
+	_ "github.com/ncruces/go-sqlite3/embed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	var latest []int64
+	for _, dialect := range []Dialect{MySQL{}, Postgres{}, SQLite{}} {
+		migrations, err := Migrations(dialect.Name())
+		require.NoError(t, err)
+		require.NotEmpty(t, migrations)
+		for i, mig := range migrations {
+			assert.Equal(t, int64(i+1), mig.Version)
+			assert.NotEmpty(t, mig.Up)
+			assert.NotEmpty(t, mig.Down)
+		}
+		latest = append(latest, Latest(migrations))
+	}
+	// every dialect carries the same versions
+	assert.Equal(t, []int64{latest[0], latest[0], latest[0]}, latest)
+}
+
+func TestPostgresRebind(t *testing.T) {
+	assert.Equal(t, "INSERT INTO t (a, b) VALUES ($1, $2)", Postgres{}.Rebind("INSERT INTO t (a, b) VALUES (?, ?)"))
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(fstest.MapFS{
+		"0002_add_email.up.sql":     {Data: []byte("ALTER TABLE user ADD email VARCHAR(100);")},
+		"0001_create_user.up.sql":   {Data: []byte("CREATE TABLE user (id BIGINT);")},
+		"0001_create_user.down.sql": {Data: []byte("DROP TABLE user;")},
+		"README.md":                 {Data: []byte("ignored")},
+	})
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, "create_user", migrations[0].Name)
+	assert.Equal(t, "DROP TABLE user;", migrations[0].Down)
+	assert.Equal(t, int64(2), Latest(migrations))
+	assert.Empty(t, migrations[1].Down)
+
+	_, err = Load(fstest.MapFS{
+		"0001_create_user.down.sql": {Data: []byte("DROP TABLE user;")},
+	})
+	assert.Error(t, err)
+}
+
+func TestSplitStatements(t *testing.T) {
+	stmts := splitStatements(`-- comment
+CREATE TABLE a (
+  id BIGINT
+);
+
+INSERT INTO a VALUES (1);
+INSERT INTO a VALUES (2)`)
+	assert.Equal(t, []string{
+		"CREATE TABLE a (\n  id BIGINT\n);",
+		"INSERT INTO a VALUES (1);",
+		"INSERT INTO a VALUES (2)",
+	}, stmts)
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	up, down, err := Create(dir, "create_user")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "0001_create_user.up.sql"), up)
+	assert.Equal(t, filepath.Join(dir, "0001_create_user.down.sql"), down)
+
+	up, _, err = Create(dir, "add_email")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "0002_add_email.up.sql"), up)
+
+	_, _, err = Create(dir, "bad name")
+	assert.Error(t, err)
+}
+
+// TestMySQL runs against the database of BLOCKACTION_TEST_MYSQL_DSN and is
+// skipped when it is unset.
+func TestMySQL(t *testing.T) {
+	dsn := os.Getenv("BLOCKACTION_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("BLOCKACTION_TEST_MYSQL_DSN is not set")
+	}
+	db, err := dbsql.Open("mysql", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+	m, err := NewMigrator(db, MySQL{})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = m.Up(ctx, 0)
+	require.NoError(t, err)
+	version, err := m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, m.Latest(), version)
+
+	reverted, err := m.Down(ctx, 1)
+	require.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.False(t, statuses[len(statuses)-1].Applied)
+
+	applied, err := m.Up(ctx, 0)
+	require.NoError(t, err)
+	assert.Len(t, applied, 1)
+}
+
+func TestSQLite(t *testing.T) {
+	db, err := dbsql.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	m, err := NewMigrator(db, SQLite{})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// status only reads, the tracking table is left to the first migration
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.Len(t, statuses, int(m.Latest()))
+	assert.False(t, statuses[0].Applied)
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	exists, err := SQLite{}.HasTable(ctx, conn, VERSION_TABLE)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	conn.Close()
+
+	// every down migration reverts its up migration
+	applied, err := m.Up(ctx, 0)
+	require.NoError(t, err)
+	assert.Len(t, applied, int(m.Latest()))
+	statuses, err = m.Status(ctx)
+	require.NoError(t, err)
+	assert.True(t, statuses[len(statuses)-1].Applied)
+	reverted, err := m.Down(ctx, len(applied))
+	require.NoError(t, err)
+	assert.Len(t, reverted, len(applied))
+	applied, err = m.Up(ctx, 0)
+	require.NoError(t, err)
+	assert.Len(t, applied, int(m.Latest()))
+}
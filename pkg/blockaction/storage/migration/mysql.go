@@ -0,0 +1,45 @@
+package migration
+
+import (
+	"context"
+	dbsql "database/sql"
+	"fmt"
+)
+
+var _ Dialect = MySQL{}
+
+type MySQL struct{}
+
+func (MySQL) Name() string {
+	return "mysql"
+}
+
+// Lock uses a MySQL advisory lock, released when conn closes.
+func (MySQL) Lock(ctx context.Context, conn *dbsql.Conn) error {
+	var got dbsql.NullInt64
+	err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", LOCK_NAME, LOCK_TIMEOUT).Scan(&got)
+	if err != nil {
+		return err
+	}
+	if got.Int64 != 1 {
+		return fmt.Errorf("lock %s is held by another migration", LOCK_NAME)
+	}
+
+	return nil
+}
+
+func (MySQL) Unlock(ctx context.Context, conn *dbsql.Conn) error {
+	_, err := conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", LOCK_NAME)
+	return err
+}
+
+func (MySQL) HasTable(ctx context.Context, conn *dbsql.Conn, table string) (bool, error) {
+	var n int
+	err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?", table).Scan(&n)
+
+	return n > 0, err
+}
+
+func (MySQL) Rebind(query string) string {
+	return query
+}
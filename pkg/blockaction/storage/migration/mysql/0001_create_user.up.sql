@@ -1,4 +1,4 @@
-CREATE TABLE `user` (
+CREATE TABLE IF NOT EXISTS `user` (
   `id` bigint NOT NULL,
   `account` varchar(45) NOT NULL,
   `secret` varchar(255) NOT NULL,
@@ -11,4 +11,4 @@ CREATE TABLE `user` (
   `updater` bigint NOT NULL,
   PRIMARY KEY (`id`),
   UNIQUE KEY `uk_merchant_user_account` (`account`)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
\ No newline at end of file
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
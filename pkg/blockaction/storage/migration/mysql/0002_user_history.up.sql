@@ -0,0 +1,17 @@
+ALTER TABLE `user`
+  ADD COLUMN `version` bigint NOT NULL DEFAULT 1,
+  ADD COLUMN `deleted_at` bigint NOT NULL DEFAULT 0,
+  DROP INDEX `uk_merchant_user_account`,
+  ADD UNIQUE KEY `uk_merchant_user_account` (`account`, `deleted_at`);
+CREATE TABLE IF NOT EXISTS `user_history` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `user_id` bigint NOT NULL,
+  `action` varchar(16) NOT NULL,
+  `version` bigint NOT NULL,
+  `before_data` text NOT NULL,
+  `after_data` text NOT NULL,
+  `updater` bigint NOT NULL,
+  `created_at` bigint NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_user_history_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
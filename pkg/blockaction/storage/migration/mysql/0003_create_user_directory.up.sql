@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS `user_directory` (
+  `account` varchar(45) NOT NULL,
+  `user_id` bigint NOT NULL,
+  `created_at` bigint NOT NULL,
+  PRIMARY KEY (`account`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
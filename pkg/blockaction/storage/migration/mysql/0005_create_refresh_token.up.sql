@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS `refresh_token` (
+  `family` varchar(32) NOT NULL,
+  `user_id` bigint NOT NULL,
+  `jti` varchar(32) NOT NULL,
+  `expires_at` bigint NOT NULL,
+  `created_at` bigint NOT NULL,
+  `updated_at` bigint NOT NULL,
+  PRIMARY KEY (`family`),
+  KEY `idx_refresh_token_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,56 @@
+package migration
+
+import (
+	"context"
+	dbsql "database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var _ Dialect = Postgres{}
+
+type Postgres struct{}
+
+func (Postgres) Name() string {
+	return "postgres"
+}
+
+// Lock uses a session advisory lock, released when conn closes.
+func (Postgres) Lock(ctx context.Context, conn *dbsql.Conn) error {
+	ctx, cancel := context.WithTimeout(ctx, LOCK_TIMEOUT*time.Second)
+	defer cancel()
+	_, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext($1))", LOCK_NAME)
+
+	return err
+}
+
+func (Postgres) Unlock(ctx context.Context, conn *dbsql.Conn) error {
+	_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtext($1))", LOCK_NAME)
+	return err
+}
+
+// HasTable looks the table up in the search path, as the unqualified queries
+// of the migrator do.
+func (Postgres) HasTable(ctx context.Context, conn *dbsql.Conn, table string) (bool, error) {
+	var exists bool
+	err := conn.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", table).Scan(&exists)
+
+	return exists, err
+}
+
+// Rebind rewrites ? placeholders to $1, $2 and so on.
+func (Postgres) Rebind(query string) string {
+	var sb strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			sb.WriteRune(r)
+			continue
+		}
+		n++
+		sb.WriteString("$" + strconv.Itoa(n))
+	}
+
+	return sb.String()
+}
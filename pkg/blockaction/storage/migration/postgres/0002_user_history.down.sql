@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS user_history;
+-- soft deleted users would break the unique account key
+DELETE FROM "user" WHERE deleted_at <> 0;
+ALTER TABLE "user"
+  DROP CONSTRAINT uk_merchant_user_account,
+  ADD CONSTRAINT uk_merchant_user_account UNIQUE (account),
+  DROP COLUMN deleted_at,
+  DROP COLUMN version;
@@ -0,0 +1,17 @@
+ALTER TABLE "user"
+  ADD COLUMN version bigint NOT NULL DEFAULT 1,
+  ADD COLUMN deleted_at bigint NOT NULL DEFAULT 0,
+  DROP CONSTRAINT uk_merchant_user_account,
+  ADD CONSTRAINT uk_merchant_user_account UNIQUE (account, deleted_at);
+CREATE TABLE IF NOT EXISTS user_history (
+  id bigint GENERATED BY DEFAULT AS IDENTITY,
+  user_id bigint NOT NULL,
+  action varchar(16) NOT NULL,
+  version bigint NOT NULL,
+  before_data text NOT NULL,
+  after_data text NOT NULL,
+  updater bigint NOT NULL,
+  created_at bigint NOT NULL,
+  PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_user_history_user_id ON user_history (user_id);
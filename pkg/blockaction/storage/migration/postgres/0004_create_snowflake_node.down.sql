@@ -0,0 +1 @@
+DROP TABLE IF EXISTS snowflake_node;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS snowflake_node (
+  node_id bigint NOT NULL,
+  owner varchar(100) NOT NULL,
+  expires_at bigint NOT NULL,
+  PRIMARY KEY (node_id)
+);
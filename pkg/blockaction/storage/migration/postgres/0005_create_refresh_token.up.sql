@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS refresh_token (
+  family varchar(32) NOT NULL,
+  user_id bigint NOT NULL,
+  jti varchar(32) NOT NULL,
+  expires_at bigint NOT NULL,
+  created_at bigint NOT NULL,
+  updated_at bigint NOT NULL,
+  PRIMARY KEY (family)
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_token_user_id ON refresh_token (user_id);
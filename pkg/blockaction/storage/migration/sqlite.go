@@ -0,0 +1,35 @@
+package migration
+
+import (
+	"context"
+	dbsql "database/sql"
+)
+
+var _ Dialect = SQLite{}
+
+// SQLite takes no lock, the database file is owned by a single process and
+// SQLite serializes writers itself.
+type SQLite struct{}
+
+func (SQLite) Name() string {
+	return "sqlite"
+}
+
+func (SQLite) Lock(ctx context.Context, conn *dbsql.Conn) error {
+	return nil
+}
+
+func (SQLite) Unlock(ctx context.Context, conn *dbsql.Conn) error {
+	return nil
+}
+
+func (SQLite) HasTable(ctx context.Context, conn *dbsql.Conn, table string) (bool, error) {
+	var n int
+	err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&n)
+
+	return n > 0, err
+}
+
+func (SQLite) Rebind(query string) string {
+	return query
+}
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS `user` (
+  `id` bigint NOT NULL,
+  `account` varchar(45) NOT NULL,
+  `secret` varchar(255) NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `description` varchar(200) NOT NULL,
+  `state` smallint NOT NULL,
+  `created_at` bigint NOT NULL,
+  `creator` bigint NOT NULL,
+  `updated_at` bigint NOT NULL,
+  `updater` bigint NOT NULL,
+  PRIMARY KEY (`id`)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `uk_merchant_user_account` ON `user` (`account`);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS `user_history`;
+-- soft deleted users would break the unique account key
+DELETE FROM `user` WHERE `deleted_at` <> 0;
+DROP INDEX IF EXISTS `uk_merchant_user_account`;
+CREATE UNIQUE INDEX IF NOT EXISTS `uk_merchant_user_account` ON `user` (`account`);
+ALTER TABLE `user` DROP COLUMN `deleted_at`;
+ALTER TABLE `user` DROP COLUMN `version`;
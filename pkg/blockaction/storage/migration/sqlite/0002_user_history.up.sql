@@ -0,0 +1,15 @@
+ALTER TABLE `user` ADD COLUMN `version` bigint NOT NULL DEFAULT 1;
+ALTER TABLE `user` ADD COLUMN `deleted_at` bigint NOT NULL DEFAULT 0;
+DROP INDEX IF EXISTS `uk_merchant_user_account`;
+CREATE UNIQUE INDEX IF NOT EXISTS `uk_merchant_user_account` ON `user` (`account`, `deleted_at`);
+CREATE TABLE IF NOT EXISTS `user_history` (
+  `id` integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+  `user_id` bigint NOT NULL,
+  `action` varchar(16) NOT NULL,
+  `version` bigint NOT NULL,
+  `before_data` text NOT NULL,
+  `after_data` text NOT NULL,
+  `updater` bigint NOT NULL,
+  `created_at` bigint NOT NULL
+);
+CREATE INDEX IF NOT EXISTS `idx_user_history_user_id` ON `user_history` (`user_id`);
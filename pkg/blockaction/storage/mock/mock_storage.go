@@ -5,6 +5,7 @@
 package mock
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -34,61 +35,343 @@ func (m *MockIStorage) EXPECT() *MockIStorageMockRecorder {
 	return m.recorder
 }
 
+// CreateRefreshToken mocks base method.
+func (m *MockIStorage) CreateRefreshToken(ctx context.Context, entity storage.RefreshTokenTable) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateRefreshToken", ctx, entity)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateRefreshToken indicates an expected call of CreateRefreshToken.
+func (mr *MockIStorageMockRecorder) CreateRefreshToken(ctx, entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRefreshToken", reflect.TypeOf((*MockIStorage)(nil).CreateRefreshToken), ctx, entity)
+}
+
 // CreateUser mocks base method.
-func (m *MockIStorage) CreateUser(entity storage.UserTable) error {
+func (m *MockIStorage) CreateUser(ctx context.Context, entity storage.UserTable) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateUser", entity)
+	ret := m.ctrl.Call(m, "CreateUser", ctx, entity)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // CreateUser indicates an expected call of CreateUser.
-func (mr *MockIStorageMockRecorder) CreateUser(entity interface{}) *gomock.Call {
+func (mr *MockIStorageMockRecorder) CreateUser(ctx, entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockIStorage)(nil).CreateUser), ctx, entity)
+}
+
+// DeleteUser mocks base method.
+func (m *MockIStorage) DeleteUser(ctx context.Context, id, updater int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", ctx, id, updater)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockIStorageMockRecorder) DeleteUser(ctx, id, updater interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockIStorage)(nil).CreateUser), entity)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockIStorage)(nil).DeleteUser), ctx, id, updater)
 }
 
 // GetUser mocks base method.
-func (m *MockIStorage) GetUser(id int64) (storage.UserTable, error) {
+func (m *MockIStorage) GetUser(ctx context.Context, id int64) (storage.UserTable, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUser", id)
+	ret := m.ctrl.Call(m, "GetUser", ctx, id)
 	ret0, _ := ret[0].(storage.UserTable)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUser indicates an expected call of GetUser.
-func (mr *MockIStorageMockRecorder) GetUser(id interface{}) *gomock.Call {
+func (mr *MockIStorageMockRecorder) GetUser(ctx, id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockIStorage)(nil).GetUser), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockIStorage)(nil).GetUser), ctx, id)
 }
 
 // GetUserByAccount mocks base method.
-func (m *MockIStorage) GetUserByAccount(account string) (storage.UserTable, error) {
+func (m *MockIStorage) GetUserByAccount(ctx context.Context, account string) (storage.UserTable, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserByAccount", account)
+	ret := m.ctrl.Call(m, "GetUserByAccount", ctx, account)
 	ret0, _ := ret[0].(storage.UserTable)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUserByAccount indicates an expected call of GetUserByAccount.
-func (mr *MockIStorageMockRecorder) GetUserByAccount(account interface{}) *gomock.Call {
+func (mr *MockIStorageMockRecorder) GetUserByAccount(ctx, account interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByAccount", reflect.TypeOf((*MockIStorage)(nil).GetUserByAccount), account)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByAccount", reflect.TypeOf((*MockIStorage)(nil).GetUserByAccount), ctx, account)
+}
+
+// GetUserHistory mocks base method.
+func (m *MockIStorage) GetUserHistory(ctx context.Context, id int64) ([]storage.UserHistoryTable, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserHistory", ctx, id)
+	ret0, _ := ret[0].([]storage.UserHistoryTable)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserHistory indicates an expected call of GetUserHistory.
+func (mr *MockIStorageMockRecorder) GetUserHistory(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserHistory", reflect.TypeOf((*MockIStorage)(nil).GetUserHistory), ctx, id)
 }
 
 // IsExistUserAccount mocks base method.
-func (m *MockIStorage) IsExistUserAccount(account string) (bool, error) {
+func (m *MockIStorage) IsExistUserAccount(ctx context.Context, account string) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "IsExistUserAccount", account)
+	ret := m.ctrl.Call(m, "IsExistUserAccount", ctx, account)
 	ret0, _ := ret[0].(bool)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // IsExistUserAccount indicates an expected call of IsExistUserAccount.
-func (mr *MockIStorageMockRecorder) IsExistUserAccount(account interface{}) *gomock.Call {
+func (mr *MockIStorageMockRecorder) IsExistUserAccount(ctx, account interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsExistUserAccount", reflect.TypeOf((*MockIStorage)(nil).IsExistUserAccount), ctx, account)
+}
+
+// RotateRefreshToken mocks base method.
+func (m *MockIStorage) RotateRefreshToken(ctx context.Context, jti string, next storage.RefreshTokenTable) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateRefreshToken", ctx, jti, next)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RotateRefreshToken indicates an expected call of RotateRefreshToken.
+func (mr *MockIStorageMockRecorder) RotateRefreshToken(ctx, jti, next interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateRefreshToken", reflect.TypeOf((*MockIStorage)(nil).RotateRefreshToken), ctx, jti, next)
+}
+
+// UpdateUser mocks base method.
+func (m *MockIStorage) UpdateUser(ctx context.Context, entity storage.UserTable) (storage.UserTable, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUser", ctx, entity)
+	ret0, _ := ret[0].(storage.UserTable)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateUser indicates an expected call of UpdateUser.
+func (mr *MockIStorageMockRecorder) UpdateUser(ctx, entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockIStorage)(nil).UpdateUser), ctx, entity)
+}
+
+// WithTx mocks base method.
+func (m *MockIStorage) WithTx(ctx context.Context, fn func(storage.IStorage) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithTx", ctx, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WithTx indicates an expected call of WithTx.
+func (mr *MockIStorageMockRecorder) WithTx(ctx, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithTx", reflect.TypeOf((*MockIStorage)(nil).WithTx), ctx, fn)
+}
+
+// MockBackend is a mock of Backend interface.
+type MockBackend struct {
+	ctrl     *gomock.Controller
+	recorder *MockBackendMockRecorder
+}
+
+// MockBackendMockRecorder is the mock recorder for MockBackend.
+type MockBackendMockRecorder struct {
+	mock *MockBackend
+}
+
+// NewMockBackend creates a new mock instance.
+func NewMockBackend(ctrl *gomock.Controller) *MockBackend {
+	mock := &MockBackend{ctrl: ctrl}
+	mock.recorder = &MockBackendMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBackend) EXPECT() *MockBackendMockRecorder {
+	return m.recorder
+}
+
+// Close mocks base method.
+func (m *MockBackend) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockBackendMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockBackend)(nil).Close))
+}
+
+// CreateRefreshToken mocks base method.
+func (m *MockBackend) CreateRefreshToken(ctx context.Context, entity storage.RefreshTokenTable) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateRefreshToken", ctx, entity)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateRefreshToken indicates an expected call of CreateRefreshToken.
+func (mr *MockBackendMockRecorder) CreateRefreshToken(ctx, entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRefreshToken", reflect.TypeOf((*MockBackend)(nil).CreateRefreshToken), ctx, entity)
+}
+
+// CreateUser mocks base method.
+func (m *MockBackend) CreateUser(ctx context.Context, entity storage.UserTable) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUser", ctx, entity)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateUser indicates an expected call of CreateUser.
+func (mr *MockBackendMockRecorder) CreateUser(ctx, entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockBackend)(nil).CreateUser), ctx, entity)
+}
+
+// DeleteUser mocks base method.
+func (m *MockBackend) DeleteUser(ctx context.Context, id, updater int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", ctx, id, updater)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockBackendMockRecorder) DeleteUser(ctx, id, updater interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockBackend)(nil).DeleteUser), ctx, id, updater)
+}
+
+// GetUser mocks base method.
+func (m *MockBackend) GetUser(ctx context.Context, id int64) (storage.UserTable, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUser", ctx, id)
+	ret0, _ := ret[0].(storage.UserTable)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUser indicates an expected call of GetUser.
+func (mr *MockBackendMockRecorder) GetUser(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockBackend)(nil).GetUser), ctx, id)
+}
+
+// GetUserByAccount mocks base method.
+func (m *MockBackend) GetUserByAccount(ctx context.Context, account string) (storage.UserTable, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByAccount", ctx, account)
+	ret0, _ := ret[0].(storage.UserTable)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByAccount indicates an expected call of GetUserByAccount.
+func (mr *MockBackendMockRecorder) GetUserByAccount(ctx, account interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByAccount", reflect.TypeOf((*MockBackend)(nil).GetUserByAccount), ctx, account)
+}
+
+// GetUserHistory mocks base method.
+func (m *MockBackend) GetUserHistory(ctx context.Context, id int64) ([]storage.UserHistoryTable, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserHistory", ctx, id)
+	ret0, _ := ret[0].([]storage.UserHistoryTable)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserHistory indicates an expected call of GetUserHistory.
+func (mr *MockBackendMockRecorder) GetUserHistory(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserHistory", reflect.TypeOf((*MockBackend)(nil).GetUserHistory), ctx, id)
+}
+
+// IsExistUserAccount mocks base method.
+func (m *MockBackend) IsExistUserAccount(ctx context.Context, account string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsExistUserAccount", ctx, account)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsExistUserAccount indicates an expected call of IsExistUserAccount.
+func (mr *MockBackendMockRecorder) IsExistUserAccount(ctx, account interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsExistUserAccount", reflect.TypeOf((*MockBackend)(nil).IsExistUserAccount), ctx, account)
+}
+
+// Ping mocks base method.
+func (m *MockBackend) Ping(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ping indicates an expected call of Ping.
+func (mr *MockBackendMockRecorder) Ping(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockBackend)(nil).Ping), ctx)
+}
+
+// RotateRefreshToken mocks base method.
+func (m *MockBackend) RotateRefreshToken(ctx context.Context, jti string, next storage.RefreshTokenTable) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateRefreshToken", ctx, jti, next)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RotateRefreshToken indicates an expected call of RotateRefreshToken.
+func (mr *MockBackendMockRecorder) RotateRefreshToken(ctx, jti, next interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateRefreshToken", reflect.TypeOf((*MockBackend)(nil).RotateRefreshToken), ctx, jti, next)
+}
+
+// UpdateUser mocks base method.
+func (m *MockBackend) UpdateUser(ctx context.Context, entity storage.UserTable) (storage.UserTable, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUser", ctx, entity)
+	ret0, _ := ret[0].(storage.UserTable)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateUser indicates an expected call of UpdateUser.
+func (mr *MockBackendMockRecorder) UpdateUser(ctx, entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockBackend)(nil).UpdateUser), ctx, entity)
+}
+
+// WithTx mocks base method.
+func (m *MockBackend) WithTx(ctx context.Context, fn func(storage.IStorage) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithTx", ctx, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WithTx indicates an expected call of WithTx.
+func (mr *MockBackendMockRecorder) WithTx(ctx, fn interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsExistUserAccount", reflect.TypeOf((*MockIStorage)(nil).IsExistUserAccount), account)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithTx", reflect.TypeOf((*MockBackend)(nil).WithTx), ctx, fn)
 }
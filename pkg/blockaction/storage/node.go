@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// NodeTable leases snowflake node IDs to instances, a lease not renewed
+// before it expires can be taken by another instance.
+type NodeTable struct {
+	NodeID    int64  `gorm:"<-:create;column:node_id;type:bigint;primaryKey;autoIncrement:false;"` // 節點 ID
+	Owner     string `gorm:"column:owner;type:varchar(100);not null;"`                             // 持有者
+	ExpiresAt int64  `gorm:"column:expires_at;type:bigint;not null;"`                              // 到期時間
+}
+
+func (NodeTable) TableName() string {
+	return "snowflake_node"
+}
+
+// AcquireNodeID leases the lowest free or expired node ID up to maxID to
+// owner, it fails with ErrConflict when every ID is leased.
+func (db *BlockActionDB) AcquireNodeID(ctx context.Context, owner string, maxID int64, ttl time.Duration) (int64, error) {
+	markWrite(ctx)
+	var leases []NodeTable
+	conn, cancel := db.query(ctx)
+	defer cancel()
+	err := conn.Table(NodeTable{}.TableName()).
+		Order("node_id").
+		Find(&leases).
+		Error
+	if err != nil {
+		return 0, db.mapError(err)
+	}
+	leased := make(map[int64]NodeTable, len(leases))
+	for _, l := range leases {
+		leased[l.NodeID] = l
+	}
+	for id := int64(0); id <= maxID; id++ {
+		now := time.Now()
+		entity := NodeTable{
+			NodeID:    id,
+			Owner:     owner,
+			ExpiresAt: now.Add(ttl).UnixMilli(),
+		}
+		l, ok := leased[id]
+		if !ok {
+			err = db.mapError(db.create(ctx, entity.TableName(), &entity))
+			if errors.Is(err, ErrConflict) {
+				// taken by another instance since the read
+				continue
+			}
+			if err != nil {
+				return 0, err
+			}
+			return id, nil
+		}
+		if l.ExpiresAt >= now.UnixMilli() {
+			continue
+		}
+		// only one instance takes over the expired lease it read
+		result := conn.Table(entity.TableName()).
+			Where("node_id = ? AND expires_at = ?", id, l.ExpiresAt).
+			Updates(map[string]interface{}{
+				"owner":      entity.Owner,
+				"expires_at": entity.ExpiresAt,
+			})
+		if result.Error != nil {
+			return 0, db.mapError(result.Error)
+		}
+		if result.RowsAffected == 1 {
+			return id, nil
+		}
+	}
+
+	return 0, ErrConflict
+}
+
+// RenewNodeID extends the lease of owner, it fails with ErrNotFound when
+// the lease has been taken over.
+func (db *BlockActionDB) RenewNodeID(ctx context.Context, id int64, owner string, ttl time.Duration) error {
+	markWrite(ctx)
+	conn, cancel := db.query(ctx)
+	defer cancel()
+	result := conn.Table(NodeTable{}.TableName()).
+		Where("node_id = ? AND owner = ?", id, owner).
+		Update("expires_at", time.Now().Add(ttl).UnixMilli())
+	if result.Error != nil {
+		return db.mapError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ReleaseNodeID ends the lease of owner, so the ID is free at once.
+func (db *BlockActionDB) ReleaseNodeID(ctx context.Context, id int64, owner string) error {
+	markWrite(ctx)
+	conn, cancel := db.query(ctx)
+	defer cancel()
+	err := conn.Table(NodeTable{}.TableName()).
+		Where("node_id = ? AND owner = ?", id, owner).
+		Delete(&NodeTable{}).
+		Error
+
+	return db.mapError(err)
+}
@@ -0,0 +1,46 @@
+package storage_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage/migration"
+)
+
+func TestNodeIDLease(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.NewBlockActionSQLite(ctx, storage.BlockActionSQLiteCfg{
+		File: filepath.Join(t.TempDir(), "test.db"),
+	})
+	require.NoError(t, err)
+	defer db.Close()
+	migrate(t, db, migration.SQLite{})
+
+	a, err := db.AcquireNodeID(ctx, "pod-a", 1, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), a)
+	b, err := db.AcquireNodeID(ctx, "pod-b", 1, 10*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), b)
+	_, err = db.AcquireNodeID(ctx, "pod-c", 1, time.Minute)
+	assert.ErrorIs(t, err, storage.ErrConflict)
+
+	// an expired lease is taken over and can no longer be renewed
+	time.Sleep(20 * time.Millisecond)
+	c, err := db.AcquireNodeID(ctx, "pod-c", 1, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, b, c)
+	assert.ErrorIs(t, db.RenewNodeID(ctx, b, "pod-b", time.Minute), storage.ErrNotFound)
+	assert.NoError(t, db.RenewNodeID(ctx, a, "pod-a", time.Minute))
+
+	require.NoError(t, db.ReleaseNodeID(ctx, a, "pod-a"))
+	d, err := db.AcquireNodeID(ctx, "pod-d", 1, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, a, d)
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+type BlockActionPostgresCfg struct {
+	DSN             string
+	UserName        string
+	Password        string
+	Address         string
+	DBName          string
+	SSLMode         string
+	MaxOpenConn     int
+	MaxIdleConn     int
+	ConnMaxLifetime int
+	QueryTimeout    time.Duration // 0 leaves the deadline to the caller's context
+}
+
+// GetDSN returns DSN when set, otherwise builds a postgres url from the
+// address and credentials.
+func (cfg BlockActionPostgresCfg) GetDSN() string {
+	if cfg.DSN != "" {
+		return cfg.DSN
+	}
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(cfg.UserName, cfg.Password),
+		Host:   cfg.Address,
+		Path:   "/" + cfg.DBName,
+	}
+	if cfg.SSLMode != "" {
+		u.RawQuery = url.Values{"sslmode": {cfg.SSLMode}}.Encode()
+	}
+
+	return u.String()
+}
+
+// NewBlockActionPostgres connects and pings the database within the deadline
+// of ctx. It shares BlockActionDB with MySQL, only errors are mapped apart.
+func NewBlockActionPostgres(ctx context.Context, cfg BlockActionPostgresCfg) (*BlockActionDB, error) {
+	conn, err := ConnGormPostgres(ctx, cfg.GetDSN(), cfg.MaxOpenConn, cfg.MaxIdleConn, cfg.ConnMaxLifetime)
+	if err != nil {
+		return nil, fmt.Errorf("conn postgres fail : %w", postgresError(err))
+	}
+
+	return &BlockActionDB{
+		conn:         conn,
+		queryTimeout: cfg.QueryTimeout,
+		mapError:     postgresError,
+	}, nil
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// RefreshTokenTable is the state of a refresh token family, the tokens
+// issued from one signin, each replacing the one before. Only the token
+// JTI is accepted.
+type RefreshTokenTable struct {
+	Family    string `gorm:"<-:create;column:family;type:varchar(32);primaryKey;"`                           // 家族 ID, 首個 token 的 jti
+	UserID    int64  `gorm:"<-:create;column:user_id;type:bigint;not null;index:idx_refresh_token_user_id;"` // 會員 ID
+	JTI       string `gorm:"column:jti;type:varchar(32);not null;"`                                          // 目前有效的 token
+	ExpiresAt int64  `gorm:"column:expires_at;type:bigint;not null;"`                                        // 到期時間
+	CreatedAt int64  `gorm:"<-:create;column:created_at;type:bigint;not null;"`                              // 建立時間
+	UpdatedAt int64  `gorm:"column:updated_at;type:bigint;not null;"`                                        // 修改時間
+}
+
+func (RefreshTokenTable) TableName() string {
+	return "refresh_token"
+}
+
+// CreateRefreshToken starts a refresh token family, removing the expired
+// families of its user.
+func (db *BlockActionDB) CreateRefreshToken(ctx context.Context, entity RefreshTokenTable) error {
+	now := time.Now().UnixMilli()
+	entity.CreatedAt = now
+	entity.UpdatedAt = now
+
+	return db.atomic(ctx, func(tx *BlockActionDB) error {
+		conn, cancel := tx.query(ctx)
+		defer cancel()
+		err := conn.Table(entity.TableName()).
+			Where("user_id = ? AND expires_at <= ?", entity.UserID, now).
+			Delete(&RefreshTokenTable{}).
+			Error
+		if err != nil {
+			return err
+		}
+		return tx.create(ctx, entity.TableName(), &entity)
+	})
+}
+
+// RotateRefreshToken replaces the token jti of the family of next with
+// next.JTI, on the primary and only while jti is current and unexpired, so
+// a token is used once. It fails with ErrNotFound otherwise.
+func (db *BlockActionDB) RotateRefreshToken(ctx context.Context, jti string, next RefreshTokenTable) error {
+	markWrite(ctx)
+	now := time.Now().UnixMilli()
+	conn, cancel := db.query(ctx)
+	defer cancel()
+	result := conn.Table(next.TableName()).
+		Where("family = ? AND user_id = ? AND jti = ? AND expires_at > ?", next.Family, next.UserID, jti, now).
+		Updates(map[string]interface{}{
+			"jti":        next.JTI,
+			"expires_at": next.ExpiresAt,
+			"updated_at": now,
+		})
+	if result.Error != nil {
+		return db.mapError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// revokeRefreshTokens removes the refresh token families of a user.
+func (db *BlockActionDB) revokeRefreshTokens(ctx context.Context, userID int64) error {
+	conn, cancel := db.query(ctx)
+	defer cancel()
+
+	return conn.Table(RefreshTokenTable{}.TableName()).
+		Where("user_id = ?", userID).
+		Delete(&RefreshTokenTable{}).
+		Error
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+const (
+	// REPLICA_RETRY_INTERVAL is how long a failed replica is skipped before
+	// reads try it again.
+	REPLICA_RETRY_INTERVAL = 10 * time.Second
+
+	TARGET_PRIMARY = "primary"
+	TARGET_REPLICA = "replica"
+)
+
+var (
+	_replicaMetrics = &ReplicaMetrics{
+		ReadTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "storage_read_total",
+				Help: "Storage reads by the target they were served from",
+			},
+			[]string{"target"},
+		),
+		FailoverTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "storage_replica_failover_total",
+				Help: "Reads moved away from an unavailable replica",
+			},
+			[]string{"replica"},
+		),
+		Up: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "storage_replica_up",
+				Help: "Whether the replica takes reads, 1 for up and 0 for down",
+			},
+			[]string{"replica"},
+		),
+	}
+)
+
+type replica struct {
+	addr      string
+	conn      *gorm.DB
+	downUntil atomic.Int64
+}
+
+func newReplica(addr string, conn *gorm.DB) *replica {
+	prometheus.Register(_replicaMetrics)
+	_replicaMetrics.Up.WithLabelValues(addr).Set(1)
+
+	return &replica{
+		addr: addr,
+		conn: conn,
+	}
+}
+
+func (r *replica) available(now time.Time) bool {
+	return now.UnixNano() >= r.downUntil.Load()
+}
+
+func (r *replica) markDown() {
+	r.downUntil.Store(time.Now().Add(REPLICA_RETRY_INTERVAL).UnixNano())
+	_replicaMetrics.Up.WithLabelValues(r.addr).Set(0)
+}
+
+func (r *replica) markUp() {
+	r.downUntil.Store(0)
+	_replicaMetrics.Up.WithLabelValues(r.addr).Set(1)
+}
+
+type sessionKey struct{}
+
+type session struct {
+	wrote atomic.Bool
+}
+
+// WithSession returns a context whose reads go to the primary once a write
+// went through it, so a request reads its own writes despite replica lag.
+func WithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &session{})
+}
+
+func markWrite(ctx context.Context) {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		s.wrote.Store(true)
+	}
+}
+
+func wroteInSession(ctx context.Context) bool {
+	s, ok := ctx.Value(sessionKey{}).(*session)
+	return ok && s.wrote.Load()
+}
+
+// Replicas returns the addresses of the read replicas.
+func (db *BlockActionDB) Replicas() []string {
+	addrs := make([]string, 0, len(db.replicas))
+	for _, r := range db.replicas {
+		addrs = append(addrs, r.addr)
+	}
+
+	return addrs
+}
+
+// PingReplica pings the i-th replica and takes it in or out of rotation.
+func (db *BlockActionDB) PingReplica(ctx context.Context, i int) error {
+	r := db.replicas[i]
+	sqlDB, err := r.conn.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		r.markDown()
+		return db.mapError(err)
+	}
+	r.markUp()
+
+	return nil
+}
+
+func (db *BlockActionDB) replicaConns() []*gorm.DB {
+	conns := make([]*gorm.DB, 0, len(db.replicas))
+	for _, r := range db.replicas {
+		conns = append(conns, r.conn)
+	}
+
+	return conns
+}
+
+// read runs fn on the replicas in round-robin order, moving on when one is
+// unavailable, and on the primary when none is left or the session wrote.
+func (db *BlockActionDB) read(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	if len(db.replicas) > 0 && !wroteInSession(ctx) {
+		now := time.Now()
+		start := db.next.Add(1)
+		for i := range db.replicas {
+			r := db.replicas[(start+uint64(i))%uint64(len(db.replicas))]
+			if !r.available(now) {
+				continue
+			}
+			conn, cancel := db.session(ctx, r.conn)
+			err := db.mapError(fn(conn))
+			cancel()
+			if errors.Is(err, ErrUnavailable) && ctx.Err() == nil {
+				r.markDown()
+				_replicaMetrics.FailoverTotal.WithLabelValues(r.addr).Inc()
+				continue
+			}
+			_replicaMetrics.ReadTotal.WithLabelValues(TARGET_REPLICA).Inc()
+			return err
+		}
+	}
+
+	conn, cancel := db.query(ctx)
+	defer cancel()
+	if len(db.replicas) > 0 {
+		_replicaMetrics.ReadTotal.WithLabelValues(TARGET_PRIMARY).Inc()
+	}
+
+	return db.mapError(fn(conn))
+}
+
+type ReplicaMetrics struct {
+	ReadTotal     *prometheus.CounterVec
+	FailoverTotal *prometheus.CounterVec
+	Up            *prometheus.GaugeVec
+}
+
+func (m *ReplicaMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.ReadTotal.Collect(ch)
+	m.FailoverTotal.Collect(ch)
+	m.Up.Collect(ch)
+}
+
+func (m *ReplicaMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.ReadTotal.Describe(ch)
+	m.FailoverTotal.Describe(ch)
+	m.Up.Describe(ch)
+}
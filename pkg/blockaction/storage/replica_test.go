@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newReplicaDB returns a BlockActionDB over SQLite files, the primary and
+// every replica hold a user 1 named after the database.
+func newReplicaDB(t *testing.T, replicas ...string) *BlockActionDB {
+	open := func(name string) *gorm.DB {
+		conn, err := ConnGormSQLite(context.Background(), filepath.Join(t.TempDir(), name+".db"))
+		require.NoError(t, err)
+		require.NoError(t, conn.AutoMigrate(Models()...))
+		require.NoError(t, conn.Create(&UserTable{ID: 1, Account: "user1", Name: name}).Error)
+		return conn
+	}
+	db := &BlockActionDB{
+		conn:     open("primary"),
+		mapError: mysqlError,
+	}
+	for _, name := range replicas {
+		db.replicas = append(db.replicas, newReplica(name, open(name)))
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestReplicaRoundRobin(t *testing.T) {
+	db := newReplicaDB(t, "replica-a", "replica-b")
+	names := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		user, err := db.GetUser(context.Background(), 1)
+		require.NoError(t, err)
+		names[user.Name]++
+	}
+	assert.Equal(t, map[string]int{"replica-a": 2, "replica-b": 2}, names)
+}
+
+func TestReplicaReadYourWrites(t *testing.T) {
+	db := newReplicaDB(t, "replica-a")
+	ctx := WithSession(context.Background())
+	user, err := db.GetUserByAccount(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "replica-a", user.Name)
+
+	require.NoError(t, db.CreateUser(ctx, UserTable{ID: 2, Account: "user2", Name: "primary"}))
+	user, err = db.GetUserByAccount(ctx, "user2")
+	require.NoError(t, err)
+	assert.Equal(t, "primary", user.Name)
+	user, err = db.GetUser(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "primary", user.Name)
+
+	// another request does not see the write until the replica catches up
+	_, err = db.GetUserByAccount(WithSession(context.Background()), "user2")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+// breakReplica makes every query on the i-th replica fail like a dropped
+// MySQL connection.
+func breakReplica(t *testing.T, db *BlockActionDB, i int) {
+	err := db.replicas[i].conn.Callback().Query().Before("gorm:query").Register("test:bad_conn", func(tx *gorm.DB) {
+		tx.AddError(driver.ErrBadConn)
+	})
+	require.NoError(t, err)
+}
+
+func TestReplicaFailover(t *testing.T) {
+	db := newReplicaDB(t, "replica-a", "replica-b")
+	breakReplica(t, db, 0)
+	for i := 0; i < 4; i++ {
+		user, err := db.GetUser(context.Background(), 1)
+		require.NoError(t, err)
+		assert.Equal(t, "replica-b", user.Name)
+	}
+	assert.False(t, db.replicas[0].available(time.Now()))
+
+	breakReplica(t, db, 1)
+	user, err := db.GetUser(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, "primary", user.Name)
+}
+
+func TestPingReplica(t *testing.T) {
+	db := newReplicaDB(t, "replica-a", "replica-b")
+	sqlDB, err := db.replicas[0].conn.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+
+	assert.Error(t, db.PingReplica(context.Background(), 0))
+	assert.False(t, db.replicas[0].available(time.Now()))
+	assert.NoError(t, db.PingReplica(context.Background(), 1))
+	assert.True(t, db.replicas[1].available(time.Now()))
+	assert.Equal(t, []string{"replica-a", "replica-b"}, db.Replicas())
+}
+
+func TestReplicaUnreachableAtStartup(t *testing.T) {
+	db := newReplicaDB(t)
+	cfg := BlockActionDBCfg{UserName: "app", Password: "secret", Address: silentServer(t), DBName: "blockaction"}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	require.NoError(t, db.addReplica(ctx, cfg.Address, cfg))
+	require.Len(t, db.replicas, 1)
+	assert.False(t, db.replicas[0].available(time.Now()))
+
+	user, err := db.GetUser(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, "primary", user.Name)
+}
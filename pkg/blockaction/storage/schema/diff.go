@@ -0,0 +1,129 @@
+package schema
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+)
+
+const (
+	DIFF_MISSING_TABLE  = "missing_table"
+	DIFF_MISSING_COLUMN = "missing_column"
+	DIFF_EXTRA_COLUMN   = "extra_column"
+	DIFF_COLUMN_TYPE    = "column_type"
+	DIFF_NULLABLE       = "nullable"
+	DIFF_MISSING_INDEX  = "missing_index"
+	DIFF_EXTRA_INDEX    = "extra_index"
+	DIFF_INDEX          = "index"
+)
+
+// Difference is one mismatch between the models (expected) and the database
+// (actual).
+type Difference struct {
+	Kind     string `json:"kind"`
+	Table    string `json:"table"`
+	Name     string `json:"name,omitempty"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+func (d Difference) String() string {
+	switch d.Kind {
+	case DIFF_MISSING_TABLE:
+		return fmt.Sprintf("table %s: missing in database", d.Table)
+	case DIFF_MISSING_COLUMN:
+		return fmt.Sprintf("table %s: column %s missing in database, model has %s", d.Table, d.Name, d.Expected)
+	case DIFF_EXTRA_COLUMN:
+		return fmt.Sprintf("table %s: column %s %s not in model", d.Table, d.Name, d.Actual)
+	case DIFF_MISSING_INDEX:
+		return fmt.Sprintf("table %s: index %s %s missing in database", d.Table, d.Name, d.Expected)
+	case DIFF_EXTRA_INDEX:
+		return fmt.Sprintf("table %s: index %s %s not in model", d.Table, d.Name, d.Actual)
+	default:
+		return fmt.Sprintf("table %s: %s of %s differs, model %s, database %s", d.Table, d.Kind, d.Name, d.Expected, d.Actual)
+	}
+}
+
+type Report struct {
+	Drift       bool         `json:"drift"`
+	Differences []Difference `json:"differences"`
+}
+
+func (r Report) WriteText(w io.Writer) error {
+	if !r.Drift {
+		_, err := fmt.Fprintln(w, "no drift")
+		return err
+	}
+	for _, d := range r.Differences {
+		_, err := fmt.Fprintln(w, d.String())
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d difference(s)\n", len(r.Differences))
+	return err
+}
+
+// Diff compares every expected table with the actual table of the same name.
+func Diff(expected, actual []Table) Report {
+	diffs := []Difference{}
+	for _, want := range expected {
+		var got *Table
+		for i := range actual {
+			if actual[i].Name == want.Name {
+				got = &actual[i]
+				break
+			}
+		}
+		if got == nil {
+			diffs = append(diffs, Difference{Kind: DIFF_MISSING_TABLE, Table: want.Name})
+			continue
+		}
+		diffs = append(diffs, diffTable(want, *got)...)
+	}
+
+	return Report{
+		Drift:       len(diffs) > 0,
+		Differences: diffs,
+	}
+}
+
+func diffTable(want, got Table) []Difference {
+	var diffs []Difference
+	for _, c := range want.Columns {
+		a, ok := got.column(c.Name)
+		if !ok {
+			diffs = append(diffs, Difference{Kind: DIFF_MISSING_COLUMN, Table: want.Name, Name: c.Name, Expected: c.Type})
+			continue
+		}
+		if c.Type != a.Type {
+			diffs = append(diffs, Difference{Kind: DIFF_COLUMN_TYPE, Table: want.Name, Name: c.Name, Expected: c.Type, Actual: a.Type})
+		}
+		if c.Nullable != a.Nullable {
+			diffs = append(diffs, Difference{Kind: DIFF_NULLABLE, Table: want.Name, Name: c.Name, Expected: strconv.FormatBool(c.Nullable), Actual: strconv.FormatBool(a.Nullable)})
+		}
+	}
+	for _, a := range got.Columns {
+		if _, ok := want.column(a.Name); !ok {
+			diffs = append(diffs, Difference{Kind: DIFF_EXTRA_COLUMN, Table: want.Name, Name: a.Name, Actual: a.Type})
+		}
+	}
+	for _, idx := range want.Indexes {
+		a, ok := got.index(idx.Name)
+		if !ok {
+			diffs = append(diffs, Difference{Kind: DIFF_MISSING_INDEX, Table: want.Name, Name: idx.Name, Expected: idx.String()})
+			continue
+		}
+		if idx.Unique != a.Unique || !reflect.DeepEqual(idx.Columns, a.Columns) {
+			diffs = append(diffs, Difference{Kind: DIFF_INDEX, Table: want.Name, Name: idx.Name, Expected: idx.String(), Actual: a.String()})
+		}
+	}
+	for _, a := range got.Indexes {
+		if _, ok := want.index(a.Name); !ok {
+			diffs = append(diffs, Difference{Kind: DIFF_EXTRA_INDEX, Table: want.Name, Name: a.Name, Actual: a.String()})
+		}
+	}
+
+	return diffs
+}
@@ -0,0 +1,87 @@
+package schema
+
+import (
+	"context"
+	dbsql "database/sql"
+	"strings"
+)
+
+// Inspect reads the named tables of the connected database from
+// information_schema. Tables that do not exist are left out.
+func Inspect(ctx context.Context, db *dbsql.DB, names ...string) ([]Table, error) {
+	tables := make([]Table, 0, len(names))
+	for _, name := range names {
+		table, ok, err := inspectTable(ctx, db, name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			tables = append(tables, table)
+		}
+	}
+
+	return tables, nil
+}
+
+func inspectTable(ctx context.Context, db *dbsql.DB, name string) (table Table, ok bool, err error) {
+	table.Name = name
+	rows, err := db.QueryContext(ctx, `SELECT COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+		ORDER BY ORDINAL_POSITION`, name)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c Column
+		var nullable string
+		err = rows.Scan(&c.Name, &c.Type, &nullable)
+		if err != nil {
+			return
+		}
+		c.Type = NormalizeType(c.Type)
+		c.Nullable = strings.EqualFold(nullable, "YES")
+		table.Columns = append(table.Columns, c)
+	}
+	err = rows.Err()
+	if err != nil || len(table.Columns) == 0 {
+		return
+	}
+
+	rows, err = db.QueryContext(ctx, `SELECT INDEX_NAME, COLUMN_NAME, NON_UNIQUE
+		FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+		ORDER BY INDEX_NAME, SEQ_IN_INDEX`, name)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	byName := make(map[string]*Index)
+	var order []string
+	for rows.Next() {
+		var indexName, column string
+		var nonUnique int
+		err = rows.Scan(&indexName, &column, &nonUnique)
+		if err != nil {
+			return
+		}
+		idx, found := byName[indexName]
+		if !found {
+			idx = &Index{Name: indexName, Unique: nonUnique == 0}
+			byName[indexName] = idx
+			order = append(order, indexName)
+		}
+		idx.Columns = append(idx.Columns, column)
+	}
+	err = rows.Err()
+	if err != nil {
+		return
+	}
+	for _, indexName := range order {
+		table.Indexes = append(table.Indexes, *byName[indexName])
+	}
+	sortIndexes(table.Indexes)
+
+	return table, true, nil
+}
@@ -0,0 +1,126 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	gormmysqldriver "gorm.io/driver/mysql"
+	gormschema "gorm.io/gorm/schema"
+)
+
+const PRIMARY_INDEX = "PRIMARY"
+
+// display widths such as bigint(20) are dropped by MySQL 8
+var _intWidth = regexp.MustCompile(`^(tinyint|smallint|mediumint|int|integer|bigint)\(\d+\)`)
+
+type Table struct {
+	Name    string   `json:"name"`
+	Columns []Column `json:"columns"`
+	Indexes []Index  `json:"indexes"`
+}
+
+type Column struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+}
+
+type Index struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+}
+
+func (t Table) column(name string) (Column, bool) {
+	for _, c := range t.Columns {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Column{}, false
+}
+
+func (t Table) index(name string) (Index, bool) {
+	for _, idx := range t.Indexes {
+		if idx.Name == name {
+			return idx, true
+		}
+	}
+	return Index{}, false
+}
+
+func (idx Index) String() string {
+	s := "(" + strings.Join(idx.Columns, ", ") + ")"
+	if idx.Unique {
+		s = "unique " + s
+	}
+	return s
+}
+
+// FromModels returns the tables the GORM models describe. Column types are
+// taken from the type tag, or from the MySQL type GORM would create.
+func FromModels(models ...interface{}) ([]Table, error) {
+	dialector := gormmysqldriver.Dialector{Config: &gormmysqldriver.Config{}}
+	cache := &sync.Map{}
+	tables := make([]Table, 0, len(models))
+	for _, model := range models {
+		sch, err := gormschema.Parse(model, cache, gormschema.NamingStrategy{})
+		if err != nil {
+			return nil, fmt.Errorf("parse model %T fail : %w", model, err)
+		}
+		table := Table{Name: sch.Table}
+		var primary []string
+		for _, field := range sch.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			dataType := field.TagSettings["TYPE"]
+			if dataType == "" {
+				dataType = dialector.DataTypeOf(field)
+			}
+			table.Columns = append(table.Columns, Column{
+				Name:     field.DBName,
+				Type:     NormalizeType(dataType),
+				Nullable: !field.NotNull && !field.PrimaryKey,
+			})
+			if field.PrimaryKey {
+				primary = append(primary, field.DBName)
+			}
+		}
+		if len(primary) > 0 {
+			table.Indexes = append(table.Indexes, Index{Name: PRIMARY_INDEX, Columns: primary, Unique: true})
+		}
+		for _, idx := range sch.ParseIndexes() {
+			columns := make([]string, 0, len(idx.Fields))
+			for _, f := range idx.Fields {
+				columns = append(columns, f.DBName)
+			}
+			table.Indexes = append(table.Indexes, Index{
+				Name:    idx.Name,
+				Columns: columns,
+				Unique:  idx.Class == "UNIQUE",
+			})
+		}
+		sortIndexes(table.Indexes)
+		tables = append(tables, table)
+	}
+
+	return tables, nil
+}
+
+// NormalizeType lowercases t and drops integer display widths, so types
+// written by hand compare equal to the ones MySQL reports.
+func NormalizeType(t string) string {
+	t = strings.ToLower(strings.TrimSpace(t))
+	t = _intWidth.ReplaceAllString(t, "$1")
+	return strings.Join(strings.Fields(t), " ")
+}
+
+func sortIndexes(indexes []Index) {
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i].Name < indexes[j].Name
+	})
+}
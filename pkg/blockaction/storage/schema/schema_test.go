@@ -0,0 +1,96 @@
+package schema
+
+import (
+	"context"
+	dbsql "database/sql"
+	"os"
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+)
+
+func TestFromModels(t *testing.T) {
+	tables, err := FromModels(storage.Models()...)
+	require.NoError(t, err)
+	require.Len(t, tables, 5)
+	user := tables[0]
+	assert.Equal(t, "user", user.Name)
+	c, ok := user.column("account")
+	require.True(t, ok)
+	assert.Equal(t, Column{Name: "account", Type: "varchar(45)", Nullable: false}, c)
+	assert.Equal(t, []Index{
+		{Name: PRIMARY_INDEX, Columns: []string{"id"}, Unique: true},
+		{Name: "uk_merchant_user_account", Columns: []string{"account", "deleted_at"}, Unique: true},
+	}, user.Indexes)
+	assert.Equal(t, "user_history", tables[1].Name)
+}
+
+func TestNormalizeType(t *testing.T) {
+	assert.Equal(t, "bigint", NormalizeType("BIGINT(20)"))
+	assert.Equal(t, "int unsigned", NormalizeType("int(10)  unsigned"))
+	assert.Equal(t, "varchar(45)", NormalizeType("varchar(45)"))
+}
+
+func TestDiff(t *testing.T) {
+	expected := []Table{
+		{
+			Name: "user",
+			Columns: []Column{
+				{Name: "id", Type: "bigint"},
+				{Name: "account", Type: "varchar(45)"},
+				{Name: "name", Type: "varchar(100)"},
+			},
+			Indexes: []Index{
+				{Name: PRIMARY_INDEX, Columns: []string{"id"}, Unique: true},
+				{Name: "uk_account", Columns: []string{"account"}, Unique: true},
+			},
+		},
+		{Name: "role"},
+	}
+	actual := []Table{
+		{
+			Name: "user",
+			Columns: []Column{
+				{Name: "id", Type: "bigint"},
+				{Name: "account", Type: "varchar(64)", Nullable: true},
+				{Name: "email", Type: "varchar(100)"},
+			},
+			Indexes: []Index{
+				{Name: PRIMARY_INDEX, Columns: []string{"id"}, Unique: true},
+				{Name: "uk_account", Columns: []string{"account"}},
+			},
+		},
+	}
+	report := Diff(expected, actual)
+	assert.True(t, report.Drift)
+	kinds := make([]string, 0, len(report.Differences))
+	for _, d := range report.Differences {
+		kinds = append(kinds, d.Kind)
+	}
+	assert.Equal(t, []string{
+		DIFF_COLUMN_TYPE, DIFF_NULLABLE, DIFF_MISSING_COLUMN, DIFF_EXTRA_COLUMN, DIFF_INDEX, DIFF_MISSING_TABLE,
+	}, kinds)
+
+	assert.False(t, Diff(expected[:1], expected[:1]).Drift)
+}
+
+// TestInspect compares the models with the migrated database of
+// BLOCKACTION_TEST_MYSQL_DSN and is skipped when it is unset.
+func TestInspect(t *testing.T) {
+	dsn := os.Getenv("BLOCKACTION_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("BLOCKACTION_TEST_MYSQL_DSN is not set")
+	}
+	db, err := dbsql.Open("mysql", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+	expected, err := FromModels(storage.Models()...)
+	require.NoError(t, err)
+	actual, err := Inspect(context.Background(), db, "user", "user_history", "user_directory", "snowflake_node", "refresh_token")
+	require.NoError(t, err)
+	assert.Empty(t, Diff(expected, actual).Differences)
+}
@@ -0,0 +1,148 @@
+package shard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+)
+
+const BACKFILL_BATCH = 500
+
+type BackfillOptions struct {
+	Batch  int  // 每次讀取筆數
+	Prune  bool // 刪除已搬移的來源資料
+	DryRun bool // 只統計不寫入
+}
+
+type BackfillStats struct {
+	Scanned   int // 讀取的會員
+	Moved     int // 複製到所屬 shard 的會員
+	Pruned    int // 從來源 shard 刪除的會員
+	Reserved  int // 新增的目錄帳號
+	Conflicts int // 帳號已屬於其他會員, 或目標 shard 已有不同的會員資料
+}
+
+// Backfill moves every user to the shard owning it, then fills the
+// directory with the accounts of active users. It can run again at any
+// time, users already copied are skipped. Prune removes the copies left on
+// the old shard, it must only run after every instance routes with the new
+// slots. Refresh tokens are not moved, moved users sign in again.
+func (s *Storage) Backfill(ctx context.Context, opts BackfillOptions) (stats BackfillStats, err error) {
+	if opts.Batch <= 0 {
+		opts.Batch = BACKFILL_BATCH
+	}
+	err = s.scan(ctx, opts.Batch, func(from int, u storage.UserTable) error {
+		stats.Scanned++
+		if s.route(u.ID) == from {
+			return nil
+		}
+		stats.Moved++
+		return s.move(ctx, from, u, opts, &stats)
+	})
+	if err != nil || opts.DryRun {
+		return stats, err
+	}
+	err = s.scan(ctx, opts.Batch, func(from int, u storage.UserTable) error {
+		if u.DeletedAt != 0 || s.route(u.ID) != from {
+			return nil
+		}
+		return s.reserve(ctx, u, &stats)
+	})
+
+	return stats, err
+}
+
+// scan calls fn with every user of every shard.
+func (s *Storage) scan(ctx context.Context, batch int, fn func(from int, u storage.UserTable) error) error {
+	for i, node := range s.nodes {
+		var afterID int64
+		for {
+			users, err := node.ScanUsers(ctx, afterID, batch)
+			if err != nil {
+				return fmt.Errorf("scan shard %s fail : %w", s.names[i], err)
+			}
+			for _, u := range users {
+				err = fn(i, u)
+				if err != nil {
+					return fmt.Errorf("backfill user %d of shard %s fail : %w", u.ID, s.names[i], err)
+				}
+			}
+			if len(users) < batch {
+				break
+			}
+			afterID = users[len(users)-1].ID
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) move(ctx context.Context, from int, u storage.UserTable, opts BackfillOptions, stats *BackfillStats) error {
+	if !opts.DryRun {
+		to := s.route(u.ID)
+		history, err := s.nodes[from].GetUserHistory(ctx, u.ID)
+		if err != nil {
+			return err
+		}
+		err = s.nodes[to].ImportUser(ctx, u, history)
+		if errors.Is(err, storage.ErrConflict) {
+			// a conflict is a copy of an earlier run, or another row that
+			// must not be taken for it
+			copied, err := s.copied(ctx, s.nodes[to], u)
+			if err != nil {
+				return err
+			}
+			if !copied {
+				stats.Conflicts++
+				slog.Warn("shard backfill copy conflict, source kept", "id", u.ID, "from", s.names[from], "to", s.names[to])
+				return nil
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+	if !opts.Prune {
+		return nil
+	}
+	stats.Pruned++
+	if opts.DryRun {
+		return nil
+	}
+
+	return s.nodes[from].PurgeUser(ctx, u.ID)
+}
+
+// copied reports whether node holds u at its version or a later one, soft
+// deleted users included.
+func (s *Storage) copied(ctx context.Context, node Node, u storage.UserTable) (bool, error) {
+	users, err := node.ScanUsers(ctx, u.ID-1, 1)
+	if err != nil {
+		return false, err
+	}
+
+	return len(users) == 1 && users[0].ID == u.ID && users[0].Version >= u.Version, nil
+}
+
+func (s *Storage) reserve(ctx context.Context, u storage.UserTable, stats *BackfillStats) error {
+	err := s.directory.ReserveAccount(ctx, u.Account, u.ID)
+	if errors.Is(err, storage.ErrConflict) {
+		id, err := s.directory.LookupAccount(ctx, u.Account)
+		if err != nil {
+			return err
+		}
+		if id != u.ID {
+			stats.Conflicts++
+			slog.Warn("shard backfill account conflict", "account", u.Account, "id", u.ID, "owner", id)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	stats.Reserved++
+
+	return nil
+}
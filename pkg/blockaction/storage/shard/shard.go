@@ -0,0 +1,207 @@
+// Package shard spreads users over several databases by their ID.
+package shard
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+)
+
+var ErrCrossShard = errors.New("transaction spans shards")
+
+// Node is a shard, a storage users can be moved in and out of.
+type Node interface {
+	storage.Backend
+	ScanUsers(ctx context.Context, afterID int64, limit int) ([]storage.UserTable, error)
+	ImportUser(ctx context.Context, entity storage.UserTable, history []storage.UserHistoryTable) error
+	PurgeUser(ctx context.Context, id int64) error
+}
+
+// Directory maps the accounts of active users to their ID.
+type Directory interface {
+	ReserveAccount(ctx context.Context, account string, id int64) error
+	LookupAccount(ctx context.Context, account string) (int64, error)
+	ReleaseAccount(ctx context.Context, account string, id int64) error
+}
+
+var _ storage.Backend = (*Storage)(nil)
+
+// Storage routes every user to the shard owning the slot of its ID, account
+// lookups go through the directory first. Accounts are reserved in the
+// directory before the user is created, so they stay unique across shards.
+type Storage struct {
+	names     []string
+	nodes     []Node
+	slots     []int // slot 對應的 node index
+	directory Directory
+}
+
+// New builds a Storage from the shard of every slot, the number of slots is
+// len(slots) and must not change without moving users.
+func New(nodes map[string]Node, slots []string, directory Directory) (*Storage, error) {
+	if len(slots) == 0 {
+		return nil, fmt.Errorf("no slot is given")
+	}
+	s := &Storage{
+		slots:     make([]int, len(slots)),
+		directory: directory,
+	}
+	index := make(map[string]int)
+	for slot, name := range slots {
+		i, ok := index[name]
+		if !ok {
+			node, found := nodes[name]
+			if !found {
+				return nil, fmt.Errorf("slot %d is owned by unknown shard %q", slot, name)
+			}
+			i = len(s.nodes)
+			index[name] = i
+			s.names = append(s.names, name)
+			s.nodes = append(s.nodes, node)
+		}
+		s.slots[slot] = i
+	}
+
+	return s, nil
+}
+
+// Slot returns the slot of a user ID. Snowflake IDs are hashed first, their
+// low bits are a sequence that is mostly 0.
+func Slot(id int64, slots int) int {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(id))
+	h := fnv.New32a()
+	h.Write(b[:])
+
+	return int(h.Sum32() % uint32(slots))
+}
+
+// ShardOf returns the name of the shard owning id.
+func (s *Storage) ShardOf(id int64) string {
+	return s.names[s.slots[Slot(id, len(s.slots))]]
+}
+
+// Shards returns the shard names in the order of their first slot.
+func (s *Storage) Shards() []string {
+	return s.names
+}
+
+// Node returns the shard named name, nil when there is none.
+func (s *Storage) Node(name string) Node {
+	for i, n := range s.names {
+		if n == name {
+			return s.nodes[i]
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) route(id int64) int {
+	return s.slots[Slot(id, len(s.slots))]
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	var errs []error
+	for i, node := range s.nodes {
+		err := node.Ping(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("shard %s : %w", s.names[i], err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Storage) Close() error {
+	var errs []error
+	for _, node := range s.nodes {
+		errs = append(errs, node.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Storage) CreateUser(ctx context.Context, entity storage.UserTable) error {
+	err := s.directory.ReserveAccount(ctx, entity.Account, entity.ID)
+	if err != nil {
+		return err
+	}
+	err = s.nodes[s.route(entity.ID)].CreateUser(ctx, entity)
+	if err != nil {
+		s.release(ctx, entity.Account, entity.ID)
+	}
+
+	return err
+}
+
+func (s *Storage) UpdateUser(ctx context.Context, entity storage.UserTable) (storage.UserTable, error) {
+	return s.nodes[s.route(entity.ID)].UpdateUser(ctx, entity)
+}
+
+func (s *Storage) DeleteUser(ctx context.Context, id int64, updater int64) error {
+	node := s.nodes[s.route(id)]
+	u, err := node.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = node.DeleteUser(ctx, id, updater)
+	if err != nil {
+		return err
+	}
+	s.release(ctx, u.Account, id)
+
+	return nil
+}
+
+// release frees an account in the directory. A failure only leaves the
+// account taken, so it is logged instead of failing the request.
+func (s *Storage) release(ctx context.Context, account string, id int64) {
+	err := s.directory.ReleaseAccount(context.WithoutCancel(ctx), account, id)
+	if err != nil {
+		slog.Error("shard directory release fail", "account", account, "id", id, "error", err)
+	}
+}
+
+func (s *Storage) IsExistUserAccount(ctx context.Context, account string) (exist bool, err error) {
+	_, err = s.GetUserByAccount(ctx, account)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *Storage) GetUser(ctx context.Context, id int64) (entity storage.UserTable, err error) {
+	return s.nodes[s.route(id)].GetUser(ctx, id)
+}
+
+func (s *Storage) GetUserByAccount(ctx context.Context, account string) (entity storage.UserTable, err error) {
+	id, err := s.directory.LookupAccount(ctx, account)
+	if err != nil {
+		return entity, err
+	}
+
+	return s.nodes[s.route(id)].GetUserByAccount(ctx, account)
+}
+
+func (s *Storage) GetUserHistory(ctx context.Context, id int64) ([]storage.UserHistoryTable, error) {
+	return s.nodes[s.route(id)].GetUserHistory(ctx, id)
+}
+
+// CreateRefreshToken keeps refresh tokens on the shard of their user.
+func (s *Storage) CreateRefreshToken(ctx context.Context, entity storage.RefreshTokenTable) error {
+	return s.nodes[s.route(entity.UserID)].CreateRefreshToken(ctx, entity)
+}
+
+func (s *Storage) RotateRefreshToken(ctx context.Context, jti string, next storage.RefreshTokenTable) error {
+	return s.nodes[s.route(next.UserID)].RotateRefreshToken(ctx, jti, next)
+}
@@ -0,0 +1,237 @@
+package shard_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage/migration"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage/shard"
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage/storagetest"
+)
+
+func newNode(t *testing.T, name string) *storage.BlockActionDB {
+	db, err := storage.NewBlockActionSQLite(context.Background(), storage.BlockActionSQLiteCfg{
+		File: filepath.Join(t.TempDir(), name+".db"),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	sqlDB, err := db.SQLDB()
+	require.NoError(t, err)
+	m, err := migration.NewMigrator(sqlDB, migration.SQLite{})
+	require.NoError(t, err)
+	_, err = m.Up(context.Background(), 0)
+	require.NoError(t, err)
+
+	return db
+}
+
+// newNodes returns shard0 and shard1 and a directory of their own, SQLite
+// allows one writer per file.
+func newNodes(t *testing.T) (map[string]shard.Node, shard.Directory) {
+	return map[string]shard.Node{
+		"shard0": newNode(t, "shard0"),
+		"shard1": newNode(t, "shard1"),
+	}, newNode(t, "directory")
+}
+
+func newUser(id int64, account string) storage.UserTable {
+	return storage.UserTable{
+		ID:      id,
+		Account: account,
+		Secret:  "secret",
+		Name:    "name of " + account,
+		State:   1,
+		Creator: 1,
+		Updater: 1,
+	}
+}
+
+// idOn returns the first ID from start on the shard named name.
+func idOn(s *shard.Storage, name string, start int64) int64 {
+	for id := start; ; id++ {
+		if s.ShardOf(id) == name {
+			return id
+		}
+	}
+}
+
+// TestShardStorage runs the conformance suite on one shard, a transaction
+// of the suite touches several users.
+func TestShardStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.IStorage {
+		nodes, directory := newNodes(t)
+		s, err := shard.New(nodes, []string{"shard0"}, directory)
+		require.NoError(t, err)
+		return s
+	})
+}
+
+func TestNew(t *testing.T) {
+	nodes, directory := newNodes(t)
+	_, err := shard.New(nodes, nil, directory)
+	assert.Error(t, err)
+	_, err = shard.New(nodes, []string{"shard0", "shard2"}, directory)
+	assert.ErrorContains(t, err, "shard2")
+
+	s, err := shard.New(nodes, []string{"shard1", "shard0", "shard1"}, directory)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shard1", "shard0"}, s.Shards())
+	assert.Nil(t, s.Node("shard2"))
+	assert.NoError(t, s.Ping(context.Background()))
+}
+
+func TestRouting(t *testing.T) {
+	ctx := context.Background()
+	nodes, directory := newNodes(t)
+	s, err := shard.New(nodes, []string{"shard0", "shard1"}, directory)
+	require.NoError(t, err)
+
+	placed := map[string]int{}
+	for id := int64(1); id <= 20; id++ {
+		account := "user" + string(rune('a'+id))
+		require.NoError(t, s.CreateUser(ctx, newUser(id, account)))
+		owner := s.ShardOf(id)
+		placed[owner]++
+		for name, node := range nodes {
+			_, err := node.GetUser(ctx, id)
+			if name == owner {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, storage.ErrNotFound)
+			}
+		}
+		got, err := s.GetUserByAccount(ctx, account)
+		require.NoError(t, err)
+		assert.Equal(t, id, got.ID)
+	}
+	assert.Len(t, placed, 2)
+
+	// accounts are unique across shards
+	a, b := idOn(s, "shard0", 100), idOn(s, "shard1", 100)
+	require.NoError(t, s.CreateUser(ctx, newUser(a, "alice")))
+	assert.ErrorIs(t, s.CreateUser(ctx, newUser(b, "alice")), storage.ErrConflict)
+	require.NoError(t, s.DeleteUser(ctx, a, 1))
+	require.NoError(t, s.CreateUser(ctx, newUser(b, "alice")))
+	got, err := s.GetUserByAccount(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, b, got.ID)
+}
+
+func TestCrossShardTx(t *testing.T) {
+	ctx := context.Background()
+	nodes, directory := newNodes(t)
+	s, err := shard.New(nodes, []string{"shard0", "shard1"}, directory)
+	require.NoError(t, err)
+	a, b := idOn(s, "shard0", 1), idOn(s, "shard1", 1)
+
+	err = s.WithTx(ctx, func(tx storage.IStorage) error {
+		if err := tx.CreateUser(ctx, newUser(a, "alice")); err != nil {
+			return err
+		}
+		return tx.CreateUser(ctx, newUser(b, "bob"))
+	})
+	assert.ErrorIs(t, err, shard.ErrCrossShard)
+	for _, account := range []string{"alice", "bob"} {
+		exist, err := s.IsExistUserAccount(ctx, account)
+		require.NoError(t, err)
+		assert.False(t, exist, account)
+	}
+	_, err = directory.LookupAccount(ctx, "alice")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// the released account of a deleted user is freed after commit
+	require.NoError(t, s.CreateUser(ctx, newUser(a, "alice")))
+	require.NoError(t, s.WithTx(ctx, func(tx storage.IStorage) error {
+		return tx.DeleteUser(ctx, a, 1)
+	}))
+	_, err = directory.LookupAccount(ctx, "alice")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestBackfill(t *testing.T) {
+	ctx := context.Background()
+	nodes, directory := newNodes(t)
+	before, err := shard.New(nodes, []string{"shard0", "shard0"}, directory)
+	require.NoError(t, err)
+	for id := int64(1); id <= 20; id++ {
+		require.NoError(t, before.CreateUser(ctx, newUser(id, "user"+string(rune('a'+id)))))
+	}
+	require.NoError(t, before.DeleteUser(ctx, 1, 1))
+
+	after, err := shard.New(nodes, []string{"shard0", "shard1"}, directory)
+	require.NoError(t, err)
+	moving := 0
+	for id := int64(1); id <= 20; id++ {
+		if after.ShardOf(id) == "shard1" {
+			moving++
+		}
+	}
+	require.NotZero(t, moving)
+
+	stats, err := after.Backfill(ctx, shard.BackfillOptions{Batch: 3, DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, shard.BackfillStats{Scanned: 20, Moved: moving}, stats)
+	users, err := nodes["shard1"].ScanUsers(ctx, 0, 1)
+	require.NoError(t, err)
+	assert.Empty(t, users)
+
+	// the copies are scanned again on shard1
+	stats, err = after.Backfill(ctx, shard.BackfillOptions{Batch: 3})
+	require.NoError(t, err)
+	assert.Equal(t, shard.BackfillStats{Scanned: 20 + moving, Moved: moving}, stats)
+	for id := int64(2); id <= 20; id++ {
+		got, err := after.GetUserByAccount(ctx, "user"+string(rune('a'+id)))
+		require.NoError(t, err)
+		assert.Equal(t, id, got.ID)
+		history, err := after.GetUserHistory(ctx, id)
+		require.NoError(t, err)
+		assert.Len(t, history, 1)
+	}
+
+	// a directory entry of another user is reported, not overwritten
+	require.NoError(t, directory.ReleaseAccount(ctx, "userc", 2))
+	require.NoError(t, directory.ReserveAccount(ctx, "userc", 99))
+	stats, err = after.Backfill(ctx, shard.BackfillOptions{Prune: true})
+	require.NoError(t, err)
+	assert.Equal(t, shard.BackfillStats{Scanned: 20 + moving, Moved: moving, Pruned: moving, Conflicts: 1}, stats)
+	users, err = nodes["shard0"].ScanUsers(ctx, 0, 100)
+	require.NoError(t, err)
+	for _, u := range users {
+		assert.Equal(t, "shard0", after.ShardOf(u.ID), u.ID)
+	}
+}
+
+func TestBackfillStaleCopy(t *testing.T) {
+	ctx := context.Background()
+	nodes, directory := newNodes(t)
+	before, err := shard.New(nodes, []string{"shard0", "shard0"}, directory)
+	require.NoError(t, err)
+	after, err := shard.New(nodes, []string{"shard0", "shard1"}, directory)
+	require.NoError(t, err)
+	id := idOn(after, "shard1", 1)
+	require.NoError(t, before.CreateUser(ctx, newUser(id, "alice")))
+	stats, err := after.Backfill(ctx, shard.BackfillOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Moved)
+
+	// updated on the old shard after the copy, by an instance routing with
+	// the old slots
+	u, err := nodes["shard0"].GetUser(ctx, id)
+	require.NoError(t, err)
+	u.Name = "updated"
+	_, err = nodes["shard0"].UpdateUser(ctx, u)
+	require.NoError(t, err)
+
+	stats, err = after.Backfill(ctx, shard.BackfillOptions{Prune: true})
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.Pruned)
+	assert.Equal(t, 1, stats.Conflicts)
+	u, err = nodes["shard0"].GetUser(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "updated", u.Name)
+}
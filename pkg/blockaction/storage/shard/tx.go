@@ -0,0 +1,222 @@
+package shard
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+)
+
+// errReplay stops a shard from retrying a transaction by itself, fn can only
+// be run again from the start.
+var errReplay = errors.New("transaction must be replayed")
+
+// WithTx runs fn in a transaction on the shard of the first user it
+// touches, touching a user of another shard fails with ErrCrossShard.
+// Directory changes are not part of the transaction, accounts reserved by a
+// failed transaction are released again.
+func (s *Storage) WithTx(ctx context.Context, fn func(tx storage.IStorage) error) error {
+	backoff := storage.TX_RETRY_BACKOFF
+	for attempt := 1; ; attempt++ {
+		tx := &txStorage{s: s, ctx: ctx, node: -1}
+		err := tx.end(fn(tx))
+		if err != nil {
+			for _, r := range tx.reserved {
+				s.release(ctx, r.account, r.id)
+			}
+		} else {
+			for _, r := range tx.released {
+				s.release(ctx, r.account, r.id)
+			}
+		}
+		if !errors.Is(err, errReplay) {
+			return err
+		}
+		if attempt >= storage.TX_MAX_ATTEMPTS {
+			return tx.err
+		}
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff)))
+		select {
+		case <-ctx.Done():
+			return tx.err
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+type account struct {
+	account string
+	id      int64
+}
+
+// txStorage binds to a transaction of one shard on first use. The shard
+// transaction runs in its own goroutine and waits for the result of fn to
+// commit or roll back.
+type txStorage struct {
+	s        *Storage
+	ctx      context.Context
+	node     int
+	tx       storage.IStorage
+	finish   chan error
+	result   chan error
+	err      error // 最後一次送出的 fn 結果
+	reserved []account
+	released []account
+}
+
+func (t *txStorage) bind(id int64) (storage.IStorage, error) {
+	node := t.s.route(id)
+	if t.tx != nil {
+		if node != t.node {
+			return nil, ErrCrossShard
+		}
+		return t.tx, nil
+	}
+	ready := make(chan storage.IStorage)
+	t.finish = make(chan error)
+	t.result = make(chan error, 1)
+	go func() {
+		started := false
+		t.result <- t.s.nodes[node].WithTx(t.ctx, func(tx storage.IStorage) error {
+			if started {
+				return errReplay
+			}
+			started = true
+			ready <- tx
+			return <-t.finish
+		})
+	}()
+	select {
+	case tx := <-ready:
+		t.node, t.tx = node, tx
+		return tx, nil
+	case err := <-t.result:
+		return nil, err
+	}
+}
+
+// end commits when err is nil and rolls back otherwise, returning err or
+// the commit error.
+func (t *txStorage) end(err error) error {
+	t.err = err
+	if t.tx == nil {
+		return err
+	}
+	t.finish <- err
+	result := <-t.result
+	if errors.Is(result, errReplay) && t.err == nil {
+		// the commit deadlocked
+		t.err = storage.ErrDeadlock
+	}
+
+	return result
+}
+
+func (t *txStorage) CreateUser(ctx context.Context, entity storage.UserTable) error {
+	tx, err := t.bind(entity.ID)
+	if err != nil {
+		return err
+	}
+	err = t.s.directory.ReserveAccount(ctx, entity.Account, entity.ID)
+	if err != nil {
+		return err
+	}
+	t.reserved = append(t.reserved, account{entity.Account, entity.ID})
+
+	return tx.CreateUser(ctx, entity)
+}
+
+func (t *txStorage) UpdateUser(ctx context.Context, entity storage.UserTable) (storage.UserTable, error) {
+	tx, err := t.bind(entity.ID)
+	if err != nil {
+		return storage.UserTable{}, err
+	}
+
+	return tx.UpdateUser(ctx, entity)
+}
+
+func (t *txStorage) DeleteUser(ctx context.Context, id int64, updater int64) error {
+	tx, err := t.bind(id)
+	if err != nil {
+		return err
+	}
+	u, err := tx.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = tx.DeleteUser(ctx, id, updater)
+	if err != nil {
+		return err
+	}
+	t.released = append(t.released, account{u.Account, id})
+
+	return nil
+}
+
+func (t *txStorage) IsExistUserAccount(ctx context.Context, account string) (exist bool, err error) {
+	_, err = t.GetUserByAccount(ctx, account)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (t *txStorage) GetUser(ctx context.Context, id int64) (storage.UserTable, error) {
+	tx, err := t.bind(id)
+	if err != nil {
+		return storage.UserTable{}, err
+	}
+
+	return tx.GetUser(ctx, id)
+}
+
+func (t *txStorage) GetUserByAccount(ctx context.Context, account string) (storage.UserTable, error) {
+	id, err := t.s.directory.LookupAccount(ctx, account)
+	if err != nil {
+		return storage.UserTable{}, err
+	}
+	tx, err := t.bind(id)
+	if err != nil {
+		return storage.UserTable{}, err
+	}
+
+	return tx.GetUserByAccount(ctx, account)
+}
+
+func (t *txStorage) GetUserHistory(ctx context.Context, id int64) ([]storage.UserHistoryTable, error) {
+	tx, err := t.bind(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.GetUserHistory(ctx, id)
+}
+
+func (t *txStorage) CreateRefreshToken(ctx context.Context, entity storage.RefreshTokenTable) error {
+	tx, err := t.bind(entity.UserID)
+	if err != nil {
+		return err
+	}
+
+	return tx.CreateRefreshToken(ctx, entity)
+}
+
+func (t *txStorage) RotateRefreshToken(ctx context.Context, jti string, next storage.RefreshTokenTable) error {
+	tx, err := t.bind(next.UserID)
+	if err != nil {
+		return err
+	}
+
+	return tx.RotateRefreshToken(ctx, jti, next)
+}
+
+func (t *txStorage) WithTx(ctx context.Context, fn func(tx storage.IStorage) error) error {
+	return fn(t)
+}
@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type BlockActionSQLiteCfg struct {
+	File         string
+	QueryTimeout time.Duration
+}
+
+// NewBlockActionSQLite opens a SQLite file through the pure Go driver, for
+// development and tests without a MySQL server.
+func NewBlockActionSQLite(ctx context.Context, cfg BlockActionSQLiteCfg) (*BlockActionDB, error) {
+	conn, err := ConnGormSQLite(ctx, cfg.File)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite fail : %w", sqliteError(err))
+	}
+
+	return &BlockActionDB{
+		conn:         conn,
+		queryTimeout: cfg.QueryTimeout,
+		mapError:     sqliteError,
+	}, nil
+}
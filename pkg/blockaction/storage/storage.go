@@ -3,25 +3,70 @@ package storage
 
 import (
 	"context"
+	dbsql "database/sql"
+	"errors"
 	"fmt"
+	"sync/atomic"
+	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"gorm.io/gorm"
 )
 
+// IStorage reports missing records with ErrNotFound, unique key violations
+// with ErrConflict, connection failures with ErrUnavailable and deadlocks
+// left after retrying with ErrDeadlock. Lookups skip soft deleted users and
+// every mutation of a user is recorded in its history.
 type IStorage interface {
-	CreateUser(entity UserTable) error
-	IsExistUserAccount(account string) (exist bool, err error)
-	GetUser(id int64) (entity UserTable, err error)
-	GetUserByAccount(account string) (entity UserTable, err error)
+	CreateUser(ctx context.Context, entity UserTable) error
+	// UpdateUser writes the mutable fields of entity when its Version is
+	// still current, otherwise it fails with ErrStaleVersion. It returns the
+	// user with the next version.
+	UpdateUser(ctx context.Context, entity UserTable) (UserTable, error)
+	// DeleteUser soft deletes a user, its account can be signed up again.
+	// Its refresh tokens are revoked.
+	DeleteUser(ctx context.Context, id int64, updater int64) error
+	IsExistUserAccount(ctx context.Context, account string) (exist bool, err error)
+	GetUser(ctx context.Context, id int64) (entity UserTable, err error)
+	GetUserByAccount(ctx context.Context, account string) (entity UserTable, err error)
+	// GetUserHistory returns the history of a user oldest first, deleted
+	// users included.
+	GetUserHistory(ctx context.Context, id int64) ([]UserHistoryTable, error)
+	// CreateRefreshToken starts a refresh token family of entity.UserID.
+	CreateRefreshToken(ctx context.Context, entity RefreshTokenTable) error
+	// RotateRefreshToken replaces the token jti of the family of next with
+	// next.JTI while jti is current and unexpired, otherwise it fails with
+	// ErrNotFound.
+	RotateRefreshToken(ctx context.Context, jti string, next RefreshTokenTable) error
+	// WithTx runs fn in a transaction, committed when fn returns nil and
+	// rolled back otherwise. fn may run again when the transaction hits a
+	// deadlock, so it must not have side effects outside tx. Calling WithTx
+	// on tx runs fn in the same transaction.
+	WithTx(ctx context.Context, fn func(tx IStorage) error) error
 }
 
-var _ IStorage = (*BlockActionDB)(nil)
+// Backend is an IStorage that owns its connection.
+type Backend interface {
+	IStorage
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+var _ Backend = (*BlockActionDB)(nil)
 
+// BlockActionDB implements IStorage with GORM, the dialect specific errors
+// are translated by mapError.
 type BlockActionDB struct {
-	conn *gorm.DB
+	conn         *gorm.DB
+	inTx         bool
+	replicas     []*replica
+	next         atomic.Uint64
+	queryTimeout time.Duration
+	mapError     func(err error) error
 }
 
 type BlockActionDBCfg struct {
+	DSN             string
 	UserName        string
 	Password        string
 	Address         string
@@ -29,47 +74,172 @@ type BlockActionDBCfg struct {
 	MaxOpenConn     int
 	MaxIdleConn     int
 	ConnMaxLifetime int
+	QueryTimeout    time.Duration // 0 leaves the deadline to the caller's context
+	ConnectTimeout  time.Duration // 每次建立連線的期限, 0 為驅動預設
+	Replicas        []string      // 唯讀副本位址, same credentials and database as the primary
 }
 
+// UserTable maps the user table, the schema itself is owned by the
+// migrations in storage/migration.
 type UserTable struct {
-	ID        int64  `gorm:"<-:create;column:id;type:bigint;primaryKey;autoIncrement:false;"`                 // ID
-	Account   string `gorm:"column:account;type:varchar(45);not null;index:uk_merchant_user_account,unique;"` // 帳號
-	Secret    string `gorm:"column:secret;type:varchar(255);not null;"`                                       // Secret
-	Name      string `gorm:"column:name;type:varchar(100);not null;"`                                         // 名稱
-	Desc      string `gorm:"column:description;type:varchar(200);not null;"`                                  // 描述
-	State     int    `gorm:"column:state;type:smallint;not null;"`                                            // 狀態
-	CreatedAt int64  `gorm:"<-:create;column:created_at;type:bigint;not null;autoUpdateTime:milli;"`          // 建立時間
-	Creator   int64  `gorm:"<-:create;column:creator;type:bigint;not null;"`                                  // 建立者
-	UpdatedAt int64  `gorm:"column:updated_at;type:bigint;not null;autoUpdateTime:milli;"`                    // 修改時間
-	Updater   int64  `gorm:"column:updater;type:bigint;not null"`                                             // 修改者
+	ID        int64  `gorm:"<-:create;column:id;type:bigint;primaryKey;autoIncrement:false;"`                                      // ID
+	Account   string `gorm:"<-:create;column:account;type:varchar(45);not null;index:uk_merchant_user_account,unique,priority:1;"` // 帳號
+	Secret    string `gorm:"column:secret;type:varchar(255);not null;"`                                                            // Secret
+	Name      string `gorm:"column:name;type:varchar(100);not null;"`                                                              // 名稱
+	Desc      string `gorm:"column:description;type:varchar(200);not null;"`                                                       // 描述
+	State     int    `gorm:"column:state;type:smallint;not null;"`                                                                 // 狀態
+	Version   int64  `gorm:"column:version;type:bigint;not null;"`                                                                 // 版本, 從 1 開始
+	CreatedAt int64  `gorm:"<-:create;column:created_at;type:bigint;not null;autoUpdateTime:milli;"`                               // 建立時間
+	Creator   int64  `gorm:"<-:create;column:creator;type:bigint;not null;"`                                                       // 建立者
+	UpdatedAt int64  `gorm:"column:updated_at;type:bigint;not null;autoUpdateTime:milli;"`                                         // 修改時間
+	Updater   int64  `gorm:"column:updater;type:bigint;not null"`                                                                  // 修改者
+	DeletedAt int64  `gorm:"column:deleted_at;type:bigint;not null;index:uk_merchant_user_account,unique,priority:2;"`             // 刪除時間, 0 為未刪除
 }
 
 func (UserTable) TableName() string {
 	return "user"
 }
 
+// Models returns the GORM models of every table.
+func Models() []interface{} {
+	return []interface{}{
+		&UserTable{},
+		&UserHistoryTable{},
+		&DirectoryTable{},
+		&NodeTable{},
+		&RefreshTokenTable{},
+	}
+}
+
+// GetDSN returns DSN when set, otherwise builds it from the address and
+// credentials. The connect timeout bounds every dial unless the DSN sets
+// its own.
+func (cfg BlockActionDBCfg) GetDSN() string {
+	dsn := cfg.DSN
+	if dsn == "" {
+		dsn = fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=True", cfg.UserName, cfg.Password, cfg.Address, cfg.DBName)
+	}
+	if cfg.ConnectTimeout <= 0 {
+		return dsn
+	}
+	c, err := mysql.ParseDSN(dsn)
+	if err != nil || c.Timeout != 0 {
+		// an invalid DSN fails on connect with the error of the driver
+		return dsn
+	}
+	c.Timeout = cfg.ConnectTimeout
+
+	return c.FormatDSN()
+}
+
+// NewBlockActionDB connects and pings the database within the deadline of ctx.
 func NewBlockActionDB(ctx context.Context, cfg BlockActionDBCfg) (*BlockActionDB, error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=True", cfg.UserName, cfg.Password, cfg.Address, cfg.DBName)
-	conn, err := ConnGormMySQL(ctx, dsn, cfg.MaxOpenConn, cfg.MaxIdleConn, cfg.ConnMaxLifetime)
+	conn, err := ConnGormMySQL(ctx, cfg.GetDSN(), cfg.MaxOpenConn, cfg.MaxIdleConn, cfg.ConnMaxLifetime)
 	if err != nil {
-		return nil, fmt.Errorf("conn mysql fail : %w", err)
+		return nil, fmt.Errorf("conn mysql fail : %w", mysqlError(err))
+	}
+	db := &BlockActionDB{
+		conn:         conn,
+		queryTimeout: cfg.QueryTimeout,
+		mapError:     mysqlError,
+	}
+	for _, addr := range cfg.Replicas {
+		replicaCfg := cfg
+		replicaCfg.Address = addr
+		err = db.addReplica(ctx, addr, replicaCfg)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("conn mysql replica %s fail : %w", addr, err)
+		}
 	}
-	return &BlockActionDB{
-		conn: conn,
-	}, nil
+
+	return db, nil
 }
 
-func (db *BlockActionDB) CreateUser(entity UserTable) error {
-	err := db.create(entity.TableName(), &entity)
+// addReplica opens a replica without connecting to it first, an unreachable
+// replica does not fail startup, it is marked down and reads go around it
+// until it answers again.
+func (db *BlockActionDB) addReplica(ctx context.Context, addr string, cfg BlockActionDBCfg) error {
+	sqlDB, err := openMySQL(cfg.GetDSN(), cfg.MaxOpenConn, cfg.MaxIdleConn, cfg.ConnMaxLifetime)
+	if err != nil {
+		return err
+	}
+	conn, err := gormMySQL(sqlDB)
 	if err != nil {
 		return err
 	}
+	db.replicas = append(db.replicas, newReplica(addr, conn))
+	// a failed ping only marks it down
+	_ = db.PingReplica(ctx, len(db.replicas)-1)
 
 	return nil
 }
 
-func (db *BlockActionDB) create(table string, entity interface{}) error {
-	err := db.conn.Table(table).
+func (db *BlockActionDB) Dialect() string {
+	return db.conn.Dialector.Name()
+}
+
+func (db *BlockActionDB) SQLDB() (*dbsql.DB, error) {
+	return db.conn.DB()
+}
+
+func (db *BlockActionDB) Ping(ctx context.Context) error {
+	sqlDB, err := db.conn.DB()
+	if err != nil {
+		return err
+	}
+
+	return db.mapError(sqlDB.PingContext(ctx))
+}
+
+func (db *BlockActionDB) Close() error {
+	var errs []error
+	for _, conn := range append([]*gorm.DB{db.conn}, db.replicaConns()...) {
+		sqlDB, err := conn.DB()
+		if err == nil {
+			err = sqlDB.Close()
+		}
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// query returns a primary session bound to ctx, with the query timeout
+// applied.
+func (db *BlockActionDB) query(ctx context.Context) (*gorm.DB, context.CancelFunc) {
+	return db.session(ctx, db.conn)
+}
+
+func (db *BlockActionDB) session(ctx context.Context, conn *gorm.DB) (*gorm.DB, context.CancelFunc) {
+	cancel := context.CancelFunc(func() {})
+	if db.queryTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, db.queryTimeout)
+	}
+
+	return conn.WithContext(ctx), cancel
+}
+
+func (db *BlockActionDB) CreateUser(ctx context.Context, entity UserTable) error {
+	if entity.Version == 0 {
+		entity.Version = 1
+	}
+	entity.DeletedAt = 0
+
+	return db.atomic(ctx, func(tx *BlockActionDB) error {
+		err := tx.create(ctx, entity.TableName(), &entity)
+		if err != nil {
+			return err
+		}
+		history := newUserHistory(HISTORY_ACTION_CREATE, nil, entity)
+		return tx.create(ctx, history.TableName(), &history)
+	})
+}
+
+func (db *BlockActionDB) create(ctx context.Context, table string, entity interface{}) error {
+	conn, cancel := db.query(ctx)
+	defer cancel()
+	err := conn.Table(table).
 		Create(entity).Error
 	if err != nil {
 		return err
@@ -78,30 +248,133 @@ func (db *BlockActionDB) create(table string, entity interface{}) error {
 	return nil
 }
 
-func (db *BlockActionDB) GetUser(id int64) (entity UserTable, err error) {
-	err = db.conn.Table(entity.TableName()).
-		Where("`id` = ?", id).
+func (db *BlockActionDB) UpdateUser(ctx context.Context, entity UserTable) (updated UserTable, err error) {
+	err = db.atomic(ctx, func(tx *BlockActionDB) error {
+		before, err := tx.current(ctx, entity.ID, entity.Version)
+		if err != nil {
+			return err
+		}
+		updated = before.applyUpdate(entity, time.Now().UnixMilli())
+		err = tx.save(ctx, before.Version, updated, map[string]interface{}{
+			"secret":      updated.Secret,
+			"name":        updated.Name,
+			"description": updated.Desc,
+			"state":       updated.State,
+		})
+		if err != nil {
+			return err
+		}
+		history := newUserHistory(HISTORY_ACTION_UPDATE, &before, updated)
+		return tx.create(ctx, history.TableName(), &history)
+	})
+
+	return
+}
+
+func (db *BlockActionDB) DeleteUser(ctx context.Context, id int64, updater int64) error {
+	return db.atomic(ctx, func(tx *BlockActionDB) error {
+		before, err := tx.current(ctx, id, 0)
+		if err != nil {
+			return err
+		}
+		deleted := before.applyDelete(updater, time.Now().UnixMilli())
+		err = tx.save(ctx, before.Version, deleted, map[string]interface{}{
+			"deleted_at": deleted.DeletedAt,
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.revokeRefreshTokens(ctx, id)
+		if err != nil {
+			return err
+		}
+		history := newUserHistory(HISTORY_ACTION_DELETE, &before, deleted)
+		return tx.create(ctx, history.TableName(), &history)
+	})
+}
+
+// current reads a user in the transaction, failing with ErrStaleVersion when
+// version is set and no longer current.
+func (db *BlockActionDB) current(ctx context.Context, id int64, version int64) (entity UserTable, err error) {
+	conn, cancel := db.query(ctx)
+	defer cancel()
+	err = conn.Table(entity.TableName()).
+		Where("id = ? AND deleted_at = 0", id).
 		First(&entity).
 		Error
+	if err != nil {
+		return
+	}
+	if version != 0 && entity.Version != version {
+		err = ErrStaleVersion
+	}
 
 	return
 }
 
-func (db *BlockActionDB) GetUserByAccount(account string) (entity UserTable, err error) {
-	err = db.conn.Table(entity.TableName()).
-		Where("`account` = ?", account).
-		Find(&entity).
-		Error
+// save writes columns with the version and update fields of entity, as long
+// as the stored version is still version.
+func (db *BlockActionDB) save(ctx context.Context, version int64, entity UserTable, columns map[string]interface{}) error {
+	columns["version"] = entity.Version
+	columns["updated_at"] = entity.UpdatedAt
+	columns["updater"] = entity.Updater
+	conn, cancel := db.query(ctx)
+	defer cancel()
+	result := conn.Table(entity.TableName()).
+		Where("id = ? AND version = ?", entity.ID, version).
+		Updates(columns)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrStaleVersion
+	}
+
+	return nil
+}
+
+func (db *BlockActionDB) GetUser(ctx context.Context, id int64) (entity UserTable, err error) {
+	err = db.read(ctx, func(conn *gorm.DB) error {
+		return conn.Table(entity.TableName()).
+			Where("id = ? AND deleted_at = 0", id).
+			First(&entity).
+			Error
+	})
+
+	return
+}
+
+func (db *BlockActionDB) GetUserByAccount(ctx context.Context, account string) (entity UserTable, err error) {
+	err = db.read(ctx, func(conn *gorm.DB) error {
+		return conn.Table(entity.TableName()).
+			Where("account = ? AND deleted_at = 0", account).
+			First(&entity).
+			Error
+	})
 
 	return
 }
 
-func (db *BlockActionDB) IsExistUserAccount(account string) (exist bool, err error) {
+func (db *BlockActionDB) IsExistUserAccount(ctx context.Context, account string) (exist bool, err error) {
 	var cnt int64 = 0
-	err = db.conn.Table(UserTable{}.TableName()).
-		Where("`account` = ?", account).
-		Count(&cnt).
-		Error
+	err = db.read(ctx, func(conn *gorm.DB) error {
+		return conn.Table(UserTable{}.TableName()).
+			Where("account = ? AND deleted_at = 0", account).
+			Count(&cnt).
+			Error
+	})
 	exist = cnt > 0
 	return
 }
+
+func (db *BlockActionDB) GetUserHistory(ctx context.Context, id int64) (entities []UserHistoryTable, err error) {
+	err = db.read(ctx, func(conn *gorm.DB) error {
+		return conn.Table(UserHistoryTable{}.TableName()).
+			Where("user_id = ?", id).
+			Order("id").
+			Find(&entities).
+			Error
+	})
+
+	return
+}
@@ -0,0 +1,307 @@
+// Package storagetest holds the conformance suite every IStorage backend
+// must pass.
+package storagetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/reddtsai/goAPI/pkg/blockaction/storage"
+)
+
+// Run runs the suite, newStorage returns an empty storage for every test.
+func Run(t *testing.T, newStorage func(t *testing.T) storage.IStorage) {
+	suite.Run(t, &conformance{newStorage: newStorage})
+}
+
+type conformance struct {
+	suite.Suite
+	newStorage func(t *testing.T) storage.IStorage
+	s          storage.IStorage
+}
+
+func (c *conformance) SetupTest() {
+	c.s = c.newStorage(c.T())
+}
+
+func newUser(id int64, account string) storage.UserTable {
+	return storage.UserTable{
+		ID:      id,
+		Account: account,
+		Secret:  "secret",
+		Name:    "name of " + account,
+		Desc:    "",
+		State:   1,
+		Creator: id,
+		Updater: id,
+	}
+}
+
+func (c *conformance) TestCreateAndGet() {
+	ctx := context.Background()
+	want := newUser(1, "alice")
+	c.Require().NoError(c.s.CreateUser(ctx, want))
+
+	got, err := c.s.GetUser(ctx, want.ID)
+	c.Require().NoError(err)
+	c.Equal(want.Account, got.Account)
+	c.Equal(want.Secret, got.Secret)
+	c.Equal(want.Name, got.Name)
+	c.Equal(want.State, got.State)
+	c.NotZero(got.CreatedAt)
+
+	got, err = c.s.GetUserByAccount(ctx, want.Account)
+	c.Require().NoError(err)
+	c.Equal(want.ID, got.ID)
+
+	exist, err := c.s.IsExistUserAccount(ctx, want.Account)
+	c.Require().NoError(err)
+	c.True(exist)
+}
+
+func (c *conformance) TestNotFound() {
+	ctx := context.Background()
+	_, err := c.s.GetUser(ctx, 404)
+	c.ErrorIs(err, storage.ErrNotFound)
+	_, err = c.s.GetUserByAccount(ctx, "nobody")
+	c.ErrorIs(err, storage.ErrNotFound)
+
+	exist, err := c.s.IsExistUserAccount(ctx, "nobody")
+	c.NoError(err)
+	c.False(exist)
+}
+
+func (c *conformance) TestConflict() {
+	ctx := context.Background()
+	c.Require().NoError(c.s.CreateUser(ctx, newUser(1, "alice")))
+	c.ErrorIs(c.s.CreateUser(ctx, newUser(2, "alice")), storage.ErrConflict)
+	c.ErrorIs(c.s.CreateUser(ctx, newUser(1, "bob")), storage.ErrConflict)
+}
+
+func (c *conformance) TestConcurrentCreate() {
+	ctx := context.Background()
+	const n = 8
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = c.s.CreateUser(ctx, newUser(int64(i+1), "racer"))
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		c.ErrorIs(err, storage.ErrConflict, fmt.Sprint(err))
+	}
+	c.Equal(1, created)
+}
+
+func (c *conformance) TestCanceledContext() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.s.GetUser(ctx, 1)
+	c.True(errors.Is(err, context.Canceled), "got %v", err)
+}
+
+func (c *conformance) TestWithTxCommit() {
+	ctx := context.Background()
+	err := c.s.WithTx(ctx, func(tx storage.IStorage) error {
+		if err := tx.CreateUser(ctx, newUser(1, "alice")); err != nil {
+			return err
+		}
+		// reads in the transaction see its own writes
+		got, err := tx.GetUserByAccount(ctx, "alice")
+		if err != nil {
+			return err
+		}
+		c.Equal(int64(1), got.ID)
+		return tx.WithTx(ctx, func(tx storage.IStorage) error {
+			return tx.CreateUser(ctx, newUser(2, "bob"))
+		})
+	})
+	c.Require().NoError(err)
+
+	for _, account := range []string{"alice", "bob"} {
+		exist, err := c.s.IsExistUserAccount(ctx, account)
+		c.Require().NoError(err)
+		c.True(exist, account)
+	}
+}
+
+func (c *conformance) TestWithTxRollback() {
+	ctx := context.Background()
+	// a lookup before the transaction must not hide its writes afterwards
+	_, err := c.s.GetUser(ctx, 1)
+	c.Require().ErrorIs(err, storage.ErrNotFound)
+	c.Require().NoError(c.s.CreateUser(ctx, newUser(3, "carol")))
+
+	errRollback := errors.New("rollback")
+	err = c.s.WithTx(ctx, func(tx storage.IStorage) error {
+		if err := tx.CreateUser(ctx, newUser(1, "alice")); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	c.ErrorIs(err, errRollback)
+	_, err = c.s.GetUser(ctx, 1)
+	c.ErrorIs(err, storage.ErrNotFound)
+
+	err = c.s.WithTx(ctx, func(tx storage.IStorage) error {
+		if err := tx.CreateUser(ctx, newUser(2, "bob")); err != nil {
+			return err
+		}
+		return tx.CreateUser(ctx, newUser(4, "carol"))
+	})
+	c.ErrorIs(err, storage.ErrConflict)
+	exist, err := c.s.IsExistUserAccount(ctx, "bob")
+	c.Require().NoError(err)
+	c.False(exist)
+
+	c.Require().NoError(c.s.WithTx(ctx, func(tx storage.IStorage) error {
+		return tx.CreateUser(ctx, newUser(1, "alice"))
+	}))
+	got, err := c.s.GetUser(ctx, 1)
+	c.Require().NoError(err)
+	c.Equal("alice", got.Account)
+}
+
+func (c *conformance) TestUpdateUser() {
+	ctx := context.Background()
+	c.Require().NoError(c.s.CreateUser(ctx, newUser(1, "alice")))
+	got, err := c.s.GetUser(ctx, 1)
+	c.Require().NoError(err)
+	c.Equal(int64(1), got.Version)
+
+	got.Name = "renamed"
+	got.Updater = 2
+	updated, err := c.s.UpdateUser(ctx, got)
+	c.Require().NoError(err)
+	c.Equal(int64(2), updated.Version)
+	c.Equal("renamed", updated.Name)
+	got, err = c.s.GetUserByAccount(ctx, "alice")
+	c.Require().NoError(err)
+	c.Equal("renamed", got.Name)
+	c.Equal(int64(2), got.Version)
+	c.Equal(int64(2), got.Updater)
+
+	// an update based on the first version lost the race
+	stale := updated
+	stale.Version = 1
+	_, err = c.s.UpdateUser(ctx, stale)
+	c.ErrorIs(err, storage.ErrStaleVersion)
+	c.ErrorIs(err, storage.ErrConflict)
+
+	_, err = c.s.UpdateUser(ctx, newUser(404, "nobody"))
+	c.ErrorIs(err, storage.ErrNotFound)
+}
+
+func (c *conformance) TestDeleteUser() {
+	ctx := context.Background()
+	c.Require().NoError(c.s.CreateUser(ctx, newUser(1, "alice")))
+	c.Require().NoError(c.s.DeleteUser(ctx, 1, 9))
+
+	_, err := c.s.GetUser(ctx, 1)
+	c.ErrorIs(err, storage.ErrNotFound)
+	_, err = c.s.GetUserByAccount(ctx, "alice")
+	c.ErrorIs(err, storage.ErrNotFound)
+	exist, err := c.s.IsExistUserAccount(ctx, "alice")
+	c.Require().NoError(err)
+	c.False(exist)
+	c.ErrorIs(c.s.DeleteUser(ctx, 1, 9), storage.ErrNotFound)
+	_, err = c.s.UpdateUser(ctx, newUser(1, "alice"))
+	c.ErrorIs(err, storage.ErrNotFound)
+
+	// the account is free again, the id stays taken
+	c.ErrorIs(c.s.CreateUser(ctx, newUser(1, "bob")), storage.ErrConflict)
+	c.Require().NoError(c.s.CreateUser(ctx, newUser(2, "alice")))
+	got, err := c.s.GetUserByAccount(ctx, "alice")
+	c.Require().NoError(err)
+	c.Equal(int64(2), got.ID)
+}
+
+func (c *conformance) TestUserHistory() {
+	ctx := context.Background()
+	c.Require().NoError(c.s.CreateUser(ctx, newUser(1, "alice")))
+	u, err := c.s.GetUser(ctx, 1)
+	c.Require().NoError(err)
+	u.Name = "renamed"
+	u.Updater = 2
+	_, err = c.s.UpdateUser(ctx, u)
+	c.Require().NoError(err)
+	c.Require().NoError(c.s.DeleteUser(ctx, 1, 3))
+
+	history, err := c.s.GetUserHistory(ctx, 1)
+	c.Require().NoError(err)
+	c.Require().Len(history, 3)
+	actions := []string{}
+	for i, h := range history {
+		actions = append(actions, h.Action)
+		c.Equal(int64(1), h.UserID)
+		c.Equal(int64(i+1), h.Version)
+		c.NotZero(h.CreatedAt)
+		c.NotContains(h.After, "secret")
+	}
+	c.Equal([]string{storage.HISTORY_ACTION_CREATE, storage.HISTORY_ACTION_UPDATE, storage.HISTORY_ACTION_DELETE}, actions)
+	c.Empty(history[0].Before)
+	c.Equal([]int64{1, 2, 3}, []int64{history[0].Updater, history[1].Updater, history[2].Updater})
+
+	var before, after storage.UserSnapshot
+	c.Require().NoError(json.Unmarshal([]byte(history[1].Before), &before))
+	c.Require().NoError(json.Unmarshal([]byte(history[1].After), &after))
+	c.Equal("name of alice", before.Name)
+	c.Equal("renamed", after.Name)
+	c.Require().NoError(json.Unmarshal([]byte(history[2].After), &after))
+	c.NotZero(after.DeletedAt)
+
+	// a rolled back update leaves no history
+	err = c.s.WithTx(ctx, func(tx storage.IStorage) error {
+		if err := tx.CreateUser(ctx, newUser(2, "bob")); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	c.Error(err)
+	history, err = c.s.GetUserHistory(ctx, 2)
+	c.Require().NoError(err)
+	c.Empty(history)
+}
+
+func (c *conformance) TestRefreshToken() {
+	ctx := context.Background()
+	c.Require().NoError(c.s.CreateUser(ctx, newUser(1, "alice")))
+	expiresAt := time.Now().Add(time.Hour).UnixMilli()
+	family := storage.RefreshTokenTable{Family: "f1", UserID: 1, JTI: "f1", ExpiresAt: expiresAt}
+	c.Require().NoError(c.s.CreateRefreshToken(ctx, family))
+	c.ErrorIs(c.s.CreateRefreshToken(ctx, family), storage.ErrConflict)
+
+	// a token is used once
+	next := storage.RefreshTokenTable{Family: "f1", UserID: 1, JTI: "t2", ExpiresAt: expiresAt}
+	c.Require().NoError(c.s.RotateRefreshToken(ctx, "f1", next))
+	c.ErrorIs(c.s.RotateRefreshToken(ctx, "f1", next), storage.ErrNotFound)
+	next.JTI = "t3"
+	c.ErrorIs(c.s.RotateRefreshToken(ctx, "t2", storage.RefreshTokenTable{Family: "f1", UserID: 2, JTI: "t3", ExpiresAt: expiresAt}), storage.ErrNotFound)
+	c.ErrorIs(c.s.RotateRefreshToken(ctx, "t2", storage.RefreshTokenTable{Family: "f9", UserID: 1, JTI: "t3", ExpiresAt: expiresAt}), storage.ErrNotFound)
+
+	// families are independent, the expired ones are refused
+	c.Require().NoError(c.s.CreateRefreshToken(ctx, storage.RefreshTokenTable{Family: "f2", UserID: 1, JTI: "f2", ExpiresAt: time.Now().Add(-time.Minute).UnixMilli()}))
+	c.ErrorIs(c.s.RotateRefreshToken(ctx, "f2", storage.RefreshTokenTable{Family: "f2", UserID: 1, JTI: "u2", ExpiresAt: expiresAt}), storage.ErrNotFound)
+	c.Require().NoError(c.s.RotateRefreshToken(ctx, "t2", next))
+
+	// deleting the user revokes them
+	c.Require().NoError(c.s.DeleteUser(ctx, 1, 1))
+	c.ErrorIs(c.s.RotateRefreshToken(ctx, "t3", storage.RefreshTokenTable{Family: "f1", UserID: 1, JTI: "t4", ExpiresAt: expiresAt}), storage.ErrNotFound)
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	TX_MAX_ATTEMPTS  = 3
+	TX_RETRY_BACKOFF = 20 * time.Millisecond // doubles on every attempt
+)
+
+// WithTx runs fn in a transaction on the primary, a transaction aborted by
+// a deadlock or lock wait timeout is retried with backoff.
+func (db *BlockActionDB) WithTx(ctx context.Context, fn func(tx IStorage) error) error {
+	return db.atomic(ctx, func(tx *BlockActionDB) error {
+		return fn(tx)
+	})
+}
+
+// atomic runs fn in a transaction, or in the current one when db is already
+// bound to a transaction.
+func (db *BlockActionDB) atomic(ctx context.Context, fn func(tx *BlockActionDB) error) error {
+	if db.inTx {
+		return db.mapTxError(fn(db))
+	}
+	markWrite(ctx)
+
+	return db.retry(ctx, func() error {
+		err := db.conn.WithContext(ctx).Transaction(func(conn *gorm.DB) error {
+			return fn(&BlockActionDB{
+				conn:         conn,
+				inTx:         true,
+				queryTimeout: db.queryTimeout,
+				mapError:     db.mapError,
+			})
+		})
+		return db.mapTxError(err)
+	})
+}
+
+// mapTxError maps err unless a nested call already did.
+func (db *BlockActionDB) mapTxError(err error) error {
+	for _, sentinel := range []error{ErrNotFound, ErrConflict, ErrUnavailable, ErrDeadlock} {
+		if errors.Is(err, sentinel) {
+			return err
+		}
+	}
+
+	return db.mapError(err)
+}
+
+// retry runs fn again while it fails with ErrDeadlock, up to TX_MAX_ATTEMPTS.
+// Inside a transaction fn runs once, the caller retries the transaction.
+func (db *BlockActionDB) retry(ctx context.Context, fn func() error) error {
+	if db.inTx {
+		return fn()
+	}
+	backoff := TX_RETRY_BACKOFF
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if !errors.Is(err, ErrDeadlock) || attempt >= TX_MAX_ATTEMPTS {
+			return err
+		}
+		slog.Warn("storage deadlock, retrying", "attempt", attempt, "error", err)
+		// jitter keeps the deadlocked transactions from colliding again
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff)))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTxRetryDeadlock(t *testing.T) {
+	db := newReplicaDB(t)
+	ctx := context.Background()
+	attempts := 0
+	err := db.WithTx(ctx, func(tx IStorage) error {
+		attempts++
+		if err := tx.CreateUser(ctx, UserTable{ID: int64(attempts + 1), Account: "user2"}); err != nil {
+			return err
+		}
+		if attempts < TX_MAX_ATTEMPTS {
+			return &mysql.MySQLError{Number: MYSQL_ER_LOCK_DEADLOCK}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, TX_MAX_ATTEMPTS, attempts)
+
+	// only the writes of the last attempt are committed
+	user, err := db.GetUserByAccount(ctx, "user2")
+	require.NoError(t, err)
+	assert.Equal(t, int64(TX_MAX_ATTEMPTS+1), user.ID)
+	_, err = db.GetUser(ctx, 2)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestWithTxRetryExhausted(t *testing.T) {
+	db := newReplicaDB(t)
+	attempts := 0
+	err := db.WithTx(context.Background(), func(tx IStorage) error {
+		attempts++
+		return &mysql.MySQLError{Number: MYSQL_ER_LOCK_WAIT_TIMEOUT}
+	})
+	assert.ErrorIs(t, err, ErrDeadlock)
+	assert.Equal(t, TX_MAX_ATTEMPTS, attempts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts = 0
+	err = db.WithTx(ctx, func(tx IStorage) error {
+		attempts++
+		cancel()
+		return &mysql.MySQLError{Number: MYSQL_ER_LOCK_DEADLOCK}
+	})
+	assert.ErrorIs(t, err, ErrDeadlock)
+	assert.Equal(t, 1, attempts)
+}